@@ -0,0 +1,275 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michielvha/kustomize-build-check/internal/analyzer"
+	"github.com/michielvha/kustomize-build-check/internal/discovery"
+	"github.com/michielvha/kustomize-build-check/internal/helm"
+	"github.com/michielvha/kustomize-build-check/pkg/check"
+)
+
+// loadConfig builds the Config from command-line flags, falling back to the
+// INPUT_* environment variables set by GitHub Actions when a flag is absent
+func loadConfig(args []string) (check.Config, error) {
+	var cfg check.Config
+
+	// Settings from the config file act as defaults for the flags and environment
+	configFile := getEnv("INPUT_CONFIG-FILE", "")
+	explicit := configFile != ""
+	if !explicit {
+		configFile = DefaultConfigFile
+	}
+	fc, err := loadConfigFile(configFile, explicit)
+	if err != nil {
+		return check.Config{}, err
+	}
+
+	defaultRootDir := "."
+	if len(fc.RootDirs) > 0 {
+		defaultRootDir = strings.Join(fc.RootDirs, ",")
+	}
+	defaultEnableHelm := true
+	if fc.EnableHelm != nil {
+		defaultEnableHelm = *fc.EnableHelm
+	}
+
+	fs := flag.NewFlagSet("kustomize-build-check", flag.ContinueOnError)
+	fs.StringVar(&cfg.BaseRef, "base-ref", getEnv("INPUT_BASE-REF", ""), "Base git reference to compare against (default: HEAD~1)")
+	var rootDir string
+	fs.StringVar(&rootDir, "root-dir", getEnv("INPUT_ROOT-DIR", defaultRootDir), "Comma-separated root directories to search for kustomization files")
+	fs.BoolVar(&cfg.EnableHelm, "enable-helm", getEnvBool("INPUT_ENABLE-HELM", defaultEnableHelm), "Enable Helm chart inflation in kustomize builds")
+	fs.BoolVar(&cfg.FailOnError, "fail-on-error", getEnvBool("INPUT_FAIL-ON-ERROR", true), "Exit non-zero if any kustomize build fails")
+
+	if err := fs.Parse(args); err != nil {
+		return check.Config{}, err
+	}
+
+	cfg.RootDirs = splitList(rootDir)
+	if len(cfg.RootDirs) == 0 {
+		cfg.RootDirs = []string{"."}
+	}
+
+	cfg.Annotations = getEnvBool("INPUT_ANNOTATIONS", false)
+	cfg.JSONOutput = getEnv("INPUT_JSON-OUTPUT", "")
+	cfg.JUnitOutput = getEnv("INPUT_JUNIT-OUTPUT", "")
+	cfg.PRComment = getEnvBool("INPUT_PR-COMMENT", false)
+	cfg.GitHubToken = getEnv("INPUT_GITHUB-TOKEN", "")
+	cfg.DryRun = getEnvBool("INPUT_DRY-RUN", false)
+	cfg.Include = splitList(getEnv("INPUT_INCLUDE", strings.Join(fc.Include, ",")))
+	cfg.Exclude = splitList(getEnv("INPUT_EXCLUDE", strings.Join(fc.Exclude, ",")))
+	cfg.ReportOrphans = getEnvBool("INPUT_REPORT-ORPHANS", false)
+	cfg.GraphOutput = getEnv("INPUT_GRAPH-OUTPUT", "")
+	cfg.RenderGraph = getEnvBool("INPUT_RENDER-GRAPH", false)
+	cfg.RenderDiff = getEnvBool("INPUT_RENDER-DIFF", false)
+	cfg.RegressionsOnly = getEnvBool("INPUT_REGRESSIONS-ONLY", false)
+	cfg.CacheDir = getEnv("INPUT_CACHE-DIR", "")
+	cfg.FollowSymlinks = getEnvBool("INPUT_FOLLOW-SYMLINKS", false)
+	cfg.FailOnCycle = getEnvBool("INPUT_FAIL-ON-CYCLE", false)
+	cfg.StrictRefs = getEnvBool("INPUT_STRICT-REFS", false)
+	cfg.FailOnParseError = getEnvBool("INPUT_FAIL-ON-PARSE-ERROR", false)
+	cfg.ChangedFiles = splitList(getEnv("INPUT_CHANGED-FILES", ""))
+	cfg.RepoRoot = getEnv("INPUT_REPO-ROOT", "")
+	cfg.AutoFetch = getEnvBool("INPUT_AUTO-FETCH", false)
+	cfg.Verbose = getEnvBool("INPUT_VERBOSE", false)
+	cfg.Quiet = getEnvBool("INPUT_QUIET", false)
+	cfg.RedactSecrets = getEnvBool("INPUT_REDACT-SECRETS", true)
+	cfg.KustomizePath = getEnv("INPUT_KUSTOMIZE-PATH", "")
+	cfg.HelmCacheDir = getEnv("INPUT_HELM-CACHE-DIR", "")
+	cfg.KustomizationList = getEnv("INPUT_KUSTOMIZATION-LIST", "")
+	cfg.GraphCache = getEnv("INPUT_GRAPH-CACHE", "")
+	cfg.Query = getEnv("INPUT_QUERY", "")
+	cfg.CoverageReport = getEnvBool("INPUT_COVERAGE-REPORT", false)
+	cfg.KustomizationNames = splitList(getEnv("INPUT_KUSTOMIZATION-NAMES", ""))
+	cfg.RecurseSubmodules = getEnvBool("INPUT_RECURSE-SUBMODULES", false)
+	cfg.TemplateSuffixes = splitList(getEnv("INPUT_TEMPLATE-SUFFIXES", ""))
+	cfg.FailOnUnanalyzed = getEnvBool("INPUT_FAIL-ON-UNANALYZED", false)
+	cfg.JSONLOutput = getEnv("INPUT_JSONL-OUTPUT", "")
+	cfg.FailOnWarning = getEnvBool("INPUT_FAIL-ON-WARNING", false)
+	cfg.IncludeExternalBases = getEnvBool("INPUT_INCLUDE-EXTERNAL-BASES", false)
+	cfg.FailOnUnresolved = getEnvBool("INPUT_FAIL-ON-UNRESOLVED", false)
+	cfg.FailFast = getEnvBool("INPUT_FAIL-FAST", false)
+	cfg.EnableAlphaPlugins = getEnvBool("INPUT_ENABLE-ALPHA-PLUGINS", false)
+	cfg.EnableExec = getEnvBool("INPUT_ENABLE-EXEC", false)
+	cfg.PluginHome = getEnv("INPUT_PLUGIN-HOME", "")
+	cfg.DeployOrderOutput = getEnvBool("INPUT_DEPLOY-ORDER-OUTPUT", false)
+	cfg.AncestorMatch = getEnvBool("INPUT_ANCESTOR-MATCH", false)
+	cfg.DiffPaths = splitList(getEnv("INPUT_DIFF-PATHS", ""))
+	cfg.IgnoreExtensions = getEnvList("INPUT_IGNORE-EXTENSIONS", analyzer.DefaultIgnoreExtensions)
+	cfg.IgnoreFiles = getEnvList("INPUT_IGNORE-FILES", analyzer.DefaultIgnoreFiles)
+	cfg.IncludeDependents = getEnvBool("INPUT_INCLUDE-DEPENDENTS", true)
+	cfg.BuildBases = getEnvBool("INPUT_BUILD-BASES", true)
+	cfg.SkipPaths = splitList(getEnv("INPUT_SKIP-PATHS", ""))
+	cfg.ForcePaths = splitList(getEnv("INPUT_FORCE-PATHS", ""))
+	cfg.NoFanoutPaths = splitList(getEnv("INPUT_NO-FANOUT-PATHS", ""))
+	// Honor the NO_COLOR convention (https://no-color.org) for plain-text log sinks
+	cfg.NoEmoji = getEnvBool("INPUT_NO-EMOJI", false) || os.Getenv("NO_COLOR") != ""
+	cfg.SkipDirs = splitList(getEnv("INPUT_SKIP-DIRS", strings.Join(discovery.DefaultSkipDirs, ",")))
+
+	if cfg.Retries, err = getEnvInt("INPUT_RETRIES", 0); err != nil {
+		return check.Config{}, err
+	}
+	if cfg.MaxDepth, err = getEnvInt("INPUT_MAX-DEPTH", -1); err != nil {
+		return check.Config{}, err
+	}
+	if cfg.MaxBuilds, err = getEnvInt("INPUT_MAX-BUILDS", 0); err != nil {
+		return check.Config{}, err
+	}
+	defaultConcurrency := 1
+	if fc.Concurrency != nil {
+		defaultConcurrency = *fc.Concurrency
+	}
+	if cfg.Concurrency, err = getEnvInt("INPUT_CONCURRENCY", defaultConcurrency); err != nil {
+		return check.Config{}, err
+	}
+	defaultTimeout := "2m"
+	if fc.Timeout != "" {
+		defaultTimeout = fc.Timeout
+	}
+	if cfg.Timeout, err = getEnvDuration("INPUT_TIMEOUT", defaultTimeout); err != nil {
+		return check.Config{}, err
+	}
+	// Unlimited unless set
+	if getEnv("INPUT_TOTAL-TIMEOUT", "") != "" {
+		if cfg.TotalTimeout, err = getEnvDuration("INPUT_TOTAL-TIMEOUT", ""); err != nil {
+			return check.Config{}, err
+		}
+	}
+	if cfg.MaxDependentDepth, err = getEnvInt("INPUT_MAX-DEPENDENT-DEPTH", -1); err != nil {
+		return check.Config{}, err
+	}
+	if cfg.MaxOutputBytes, err = getEnvInt("INPUT_MAX-OUTPUT-BYTES", check.DefaultConfig().MaxOutputBytes); err != nil {
+		return check.Config{}, err
+	}
+	if cfg.BuildEnv, err = getEnvKeyValues("INPUT_BUILD-ENV"); err != nil {
+		return check.Config{}, err
+	}
+	if cfg.HelmRepos, err = helm.ParseRepos(splitList(getEnv("INPUT_HELM-REPOS", ""))); err != nil {
+		return check.Config{}, err
+	}
+	if cfg.Shard, err = getEnvShard("INPUT_SHARD"); err != nil {
+		return check.Config{}, err
+	}
+	switch mode := check.Mode(getEnv("INPUT_MODE", string(check.ModeBuild))); mode {
+	case check.ModeBuild, check.ModeLint:
+		cfg.Mode = mode
+	default:
+		return check.Config{}, fmt.Errorf("INPUT_MODE must be %s or %s, got %q", check.ModeBuild, check.ModeLint, mode)
+	}
+	if getEnv("INPUT_ERROR-LINES", "") == "full" {
+		cfg.ErrorLines = -1
+	} else if cfg.ErrorLines, err = getEnvInt("INPUT_ERROR-LINES", 0); err != nil {
+		return check.Config{}, err
+	}
+	// A missing plugin home only surfaces as an opaque plugin error in every build
+	if cfg.PluginHome != "" {
+		if info, err := os.Stat(cfg.PluginHome); err != nil || !info.IsDir() {
+			return check.Config{}, fmt.Errorf("INPUT_PLUGIN-HOME %q is not a directory", cfg.PluginHome)
+		}
+	}
+
+	return cfg, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvList reads a comma or newline separated list. Unlike getEnv an empty value is an
+// empty list, so a default list can be turned off.
+func getEnvList(key string, defaultValue []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+	return splitList(value)
+}
+
+// getEnvBool reads a boolean environment variable, only "true" and "false" are recognized
+func getEnvBool(key string, defaultValue bool) bool {
+	switch getEnv(key, "") {
+	case "true":
+		return true
+	case "false":
+		return false
+	default:
+		return defaultValue
+	}
+}
+
+// getEnvInt reads a non-negative integer environment variable
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value := getEnv(key, "")
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %q", key, value)
+	}
+	return n, nil
+}
+
+// getEnvDuration reads a positive duration environment variable such as "90s" or "5m"
+func getEnvDuration(key, defaultValue string) (time.Duration, error) {
+	value := getEnv(key, defaultValue)
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration such as 90s or 5m, got %q", key, value)
+	}
+	return d, nil
+}
+
+// splitList splits a comma- or newline-separated input into its trimmed, non-empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvKeyValues reads KEY=VALUE lines, skipping blank lines and # comments.
+// Values may be secrets, so errors only point at the offending line.
+func getEnvKeyValues(key string) ([]string, error) {
+	var pairs []string
+	for i, line := range strings.Split(getEnv(key, ""), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, _, ok := strings.Cut(line, "="); !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%s line %d must be in KEY=VALUE format", key, i+1)
+		}
+		pairs = append(pairs, line)
+	}
+	return pairs, nil
+}
+
+// getEnvShard reads a shard in index/total format such as 2/4, with index counting from 1
+func getEnvShard(key string) (check.Shard, error) {
+	value := getEnv(key, "")
+	if value == "" {
+		return check.Shard{}, nil
+	}
+	index, total, ok := strings.Cut(value, "/")
+	shard := check.Shard{}
+	var errIndex, errTotal error
+	shard.Index, errIndex = strconv.Atoi(strings.TrimSpace(index))
+	shard.Total, errTotal = strconv.Atoi(strings.TrimSpace(total))
+	if !ok || errIndex != nil || errTotal != nil || shard.Total < 1 || shard.Index < 1 || shard.Index > shard.Total {
+		return check.Shard{}, fmt.Errorf("%s must be in index/total format with 1 <= index <= total, such as 2/4, got %q", key, value)
+	}
+	return shard, nil
+}
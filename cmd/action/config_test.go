@@ -0,0 +1,182 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michielvha/kustomize-build-check/internal/analyzer"
+	"github.com/michielvha/kustomize-build-check/pkg/check"
+)
+
+func TestLoadConfigFromFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	content := "rootDirs: [deploy, infra/k8s]\nexclude: [apps/experimental]\ntimeout: 5m\nconcurrency: 4\nenableHelm: false\n"
+	if err := os.WriteFile(DefaultConfigFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+
+	if !slices.Equal(cfg.RootDirs, []string{"deploy", "infra/k8s"}) {
+		t.Errorf("expected root dirs from the file, got %v", cfg.RootDirs)
+	}
+	if !slices.Equal(cfg.Exclude, []string{"apps/experimental"}) {
+		t.Errorf("expected exclude from the file, got %v", cfg.Exclude)
+	}
+	if cfg.Timeout != 5*time.Minute || cfg.Concurrency != 4 || cfg.EnableHelm {
+		t.Errorf("expected timeout, concurrency and helm from the file, got %v %d %t", cfg.Timeout, cfg.Concurrency, cfg.EnableHelm)
+	}
+
+	// Environment variables and flags override the file
+	t.Setenv("INPUT_CONCURRENCY", "2")
+	t.Setenv("INPUT_ENABLE-HELM", "true")
+	cfg, err = loadConfig([]string{"-root-dir", "k8s"})
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if cfg.Concurrency != 2 || !cfg.EnableHelm || !slices.Equal(cfg.RootDirs, []string{"k8s"}) {
+		t.Errorf("expected env and flags to override the file, got %d %t %v", cfg.Concurrency, cfg.EnableHelm, cfg.RootDirs)
+	}
+}
+
+func TestLoadConfigFileMissing(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("a missing default config file should not be an error: %v", err)
+	}
+	if cfg.Timeout != 2*time.Minute || cfg.Concurrency != 1 || !cfg.EnableHelm {
+		t.Errorf("expected built-in defaults, got %v %d %t", cfg.Timeout, cfg.Concurrency, cfg.EnableHelm)
+	}
+
+	t.Setenv("INPUT_CONFIG-FILE", filepath.Join("config", "missing.yaml"))
+	if _, err := loadConfig(nil); err == nil {
+		t.Error("expected an error for a missing explicitly configured file")
+	}
+}
+
+func TestLoadConfigFileUnknownKey(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	if err := os.WriteFile(DefaultConfigFile, []byte("rootdir: deploy\n"), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	if _, err := loadConfig(nil); err == nil {
+		t.Error("expected an error for an unknown config key")
+	}
+}
+
+func TestLoadConfigBuildEnv(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("INPUT_BUILD-ENV", "# registry credentials\nREGISTRY_USER=ci\n\nREGISTRY_PASSWORD=a=b,c\n")
+
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if want := []string{"REGISTRY_USER=ci", "REGISTRY_PASSWORD=a=b,c"}; !slices.Equal(cfg.BuildEnv, want) {
+		t.Errorf("BuildEnv = %v, want %v", cfg.BuildEnv, want)
+	}
+
+	t.Setenv("INPUT_BUILD-ENV", "REGISTRY_USER=ci\nhunter2\n")
+	_, err = loadConfig(nil)
+	if err == nil {
+		t.Fatal("expected an error for a line without =")
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("expected the error not to leak the value, got %v", err)
+	}
+}
+
+func TestLoadConfigShard(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	t.Setenv("INPUT_SHARD", "2/4")
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if cfg.Shard != (check.Shard{Index: 2, Total: 4}) {
+		t.Errorf("Shard = %+v, want 2/4", cfg.Shard)
+	}
+
+	for _, value := range []string{"0/4", "5/4", "2", "a/b", "1/0"} {
+		t.Setenv("INPUT_SHARD", value)
+		if _, err := loadConfig(nil); err == nil {
+			t.Errorf("expected an error for shard %q", value)
+		}
+	}
+}
+
+func TestLoadConfigPluginHome(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("plugins", 0o755); err != nil {
+		t.Fatalf("failed to create plugin home: %v", err)
+	}
+
+	t.Setenv("INPUT_PLUGIN-HOME", "plugins")
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if cfg.PluginHome != "plugins" {
+		t.Errorf("PluginHome = %q, want plugins", cfg.PluginHome)
+	}
+
+	t.Setenv("INPUT_PLUGIN-HOME", "missing")
+	if _, err := loadConfig(nil); err == nil || !strings.Contains(err.Error(), "INPUT_PLUGIN-HOME") {
+		t.Errorf("expected an error for a missing plugin home, got %v", err)
+	}
+}
+
+func TestLoadConfigErrorLines(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	for value, want := range map[string]int{"": 0, "3": 3, "full": -1} {
+		t.Setenv("INPUT_ERROR-LINES", value)
+		cfg, err := loadConfig(nil)
+		if err != nil {
+			t.Fatalf("loadConfig failed for %q: %v", value, err)
+		}
+		if cfg.ErrorLines != want {
+			t.Errorf("ErrorLines for %q = %d, want %d", value, cfg.ErrorLines, want)
+		}
+	}
+
+	t.Setenv("INPUT_ERROR-LINES", "all")
+	if _, err := loadConfig(nil); err == nil {
+		t.Error("expected an error for an invalid error-lines value")
+	}
+}
+
+func TestLoadConfigIgnoreLists(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if !slices.Equal(cfg.IgnoreExtensions, analyzer.DefaultIgnoreExtensions) || !slices.Equal(cfg.IgnoreFiles, analyzer.DefaultIgnoreFiles) {
+		t.Errorf("expected the defaults when unset, got %v and %v", cfg.IgnoreExtensions, cfg.IgnoreFiles)
+	}
+
+	// An empty input turns the defaults off
+	t.Setenv("INPUT_IGNORE-EXTENSIONS", "")
+	t.Setenv("INPUT_IGNORE-FILES", "")
+	cfg, err = loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if len(cfg.IgnoreExtensions) != 0 || len(cfg.IgnoreFiles) != 0 {
+		t.Errorf("expected nothing to be ignored, got %v and %v", cfg.IgnoreExtensions, cfg.IgnoreFiles)
+	}
+}
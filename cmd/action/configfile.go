@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFile is the config file read from the working directory when no other path is set
+const DefaultConfigFile = ".kustomize-build-check.yaml"
+
+// fileConfig holds the settings that can be reviewed in version control.
+// Flags and INPUT_* environment variables override them.
+type fileConfig struct {
+	RootDirs    []string `yaml:"rootDirs"`
+	Include     []string `yaml:"include"`
+	Exclude     []string `yaml:"exclude"`
+	Timeout     string   `yaml:"timeout"`
+	Concurrency *int     `yaml:"concurrency"`
+	EnableHelm  *bool    `yaml:"enableHelm"`
+}
+
+// loadConfigFile reads the config file at path. A missing file is only an error
+// when the path was set explicitly rather than falling back to DefaultConfigFile.
+func loadConfigFile(path string, explicit bool) (fileConfig, error) {
+	var fc fileConfig
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return fc, nil
+	}
+	if err != nil {
+		return fc, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// Reject unknown keys so typos don't silently fall back to defaults
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+		return fc, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return fc, nil
+}
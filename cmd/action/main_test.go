@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/michielvha/kustomize-build-check/pkg/check"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, exitSuccess},
+		{"builds failed", check.ErrBuildsFailed, exitCheckFailed},
+		{"check failed", fmt.Errorf("%w: dependency cycles detected", check.ErrCheckFailed), exitCheckFailed},
+		{"tool error", errors.New("detecting changes: git diff failed"), exitToolError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,16 +1,27 @@
 package analyzer
 
 import (
+	"fmt"
 	"log/slog"
+	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/michielvha/kustomize-build-check/internal/discovery"
 	"github.com/michielvha/kustomize-build-check/internal/graph"
+	"github.com/michielvha/kustomize-build-check/internal/kustfile"
+	"github.com/michielvha/kustomize-build-check/internal/pathglob"
 )
 
 // ImpactAnalyzer determines which kustomizations need testing
 type ImpactAnalyzer interface {
+	Analyze(
+		changedFiles []string,
+		g graph.Graph,
+		allKustomizations []discovery.KustomizeFile,
+	) Affected
 	GetAffectedKustomizations(
 		changedFiles []string,
 		g graph.Graph,
@@ -18,77 +29,232 @@ type ImpactAnalyzer interface {
 	) []string
 }
 
-type analyzer struct{}
+// Reason is a changed file that made a kustomization affected
+type Reason struct {
+	File string // Absolute path of the changed file
+	Base string // Affected kustomization this one depends on, empty when File affects it directly
+}
+
+// String describes the reason with paths relative to the working directory, e.g.
+// "base/deployment.yaml changed (via base)"
+func (r Reason) String() string {
+	if r.Base == "" {
+		return relPath(r.File) + " changed"
+	}
+	return fmt.Sprintf("%s changed (via %s)", relPath(r.File), relPath(r.Base))
+}
+
+// Affected maps each affected kustomization to the reasons it was affected, in the order
+// the changed files were analyzed
+type Affected map[string][]Reason
+
+// Paths returns the affected kustomizations, sorted
+func (a Affected) Paths() []string {
+	paths := make([]string, 0, len(a))
+	for path := range a {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// add records reason for path, unless it was already recorded
+func (a Affected) add(path string, reason Reason) {
+	if !slices.Contains(a[path], reason) {
+		a[path] = append(a[path], reason)
+	}
+}
+
+type analyzer struct {
+	includeDependents bool
+	maxDependentDepth int
+	buildBases        bool
+	names             []string
+	templateSuffixes  []string
+	ancestorMatch     bool
+	ignoreExtensions  []string
+	ignoreNames       []string
+}
+
+// Option configures an ImpactAnalyzer
+type Option func(*analyzer)
+
+// WithIncludeDependents controls whether kustomizations depending on a changed one are
+// also affected. Disabling it only checks kustomizations whose own files changed, which
+// is faster but misses overlays broken by an incompatible base change.
+func WithIncludeDependents(include bool) Option {
+	return func(a *analyzer) {
+		a.includeDependents = include
+	}
+}
+
+// WithMaxDependentDepth limits dependent expansion to n levels, 1 only adds direct
+// dependents of a changed kustomization. A negative n is unlimited.
+func WithMaxDependentDepth(n int) Option {
+	return func(a *analyzer) {
+		a.maxDependentDepth = n
+	}
+}
+
+// WithBuildBases controls whether a changed base is built in isolation, in addition to
+// the overlays depending on it. A broken base doesn't always surface through an overlay
+// that patches over the error, so this is enabled by default.
+func WithBuildBases(build bool) Option {
+	return func(a *analyzer) {
+		a.buildBases = build
+	}
+}
+
+// WithKustomizationNames treats changed files with one of the additional names as
+// kustomization files, matching discovery.WithKustomizationNames
+func WithKustomizationNames(names []string) Option {
+	return func(a *analyzer) {
+		a.names = names
+	}
+}
+
+// WithTemplateSuffixes treats a changed template as a change to the file rendered from it,
+// e.g. with ".j2" a change to foo.yaml.j2 affects the kustomizations referencing foo.yaml.
+// The leading dot is optional.
+func WithTemplateSuffixes(suffixes []string) Option {
+	return func(a *analyzer) {
+		a.templateSuffixes = nil
+		for _, suffix := range suffixes {
+			if suffix != "" && !strings.HasPrefix(suffix, ".") {
+				suffix = "." + suffix
+			}
+			if suffix != "" {
+				a.templateSuffixes = append(a.templateSuffixes, suffix)
+			}
+		}
+	}
+}
+
+// WithAncestorMatch also affects the nearest kustomization at or above the directory of each
+// changed file, catching files the kustomizations reference in ways the parser doesn't
+// understand. This assumes every directory with manifests belongs to a kustomization.
+func WithAncestorMatch(match bool) Option {
+	return func(a *analyzer) {
+		a.ancestorMatch = match
+	}
+}
+
+// WithIgnoredFiles keeps changed files with one of the extensions or base names, e.g.
+// documentation, from affecting the kustomizations whose directories or globs they lie in,
+// or that they lie below with ancestor matching. They still affect the kustomizations
+// naming them, e.g. as a configMapGenerator file.
+func WithIgnoredFiles(extensions, names []string) Option {
+	return func(a *analyzer) {
+		a.ignoreExtensions = extensions
+		a.ignoreNames = names
+	}
+}
 
 // New creates a new impact analyzer
-func New() ImpactAnalyzer {
-	return &analyzer{}
+func New(opts ...Option) ImpactAnalyzer {
+	a := &analyzer{includeDependents: true, maxDependentDepth: -1, buildBases: true}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
-// GetAffectedKustomizations analyzes changed files and returns kustomizations to test
+// GetAffectedKustomizations analyzes changed files and returns kustomizations to test, sorted
 func (a *analyzer) GetAffectedKustomizations(
 	changedFiles []string,
 	g graph.Graph,
 	allKustomizations []discovery.KustomizeFile,
 ) []string {
+	return a.Analyze(changedFiles, g, allKustomizations).Paths()
+}
+
+// Analyze analyzes changed files and returns the kustomizations to test with the changed
+// files that made them affected
+func (a *analyzer) Analyze(
+	changedFiles []string,
+	g graph.Graph,
+	allKustomizations []discovery.KustomizeFile,
+) Affected {
 	slog.Debug("Analyzing impact of changed files", "changed_files_count", len(changedFiles))
 
-	affected := make(map[string]bool)
+	affected := make(Affected)
+
+	var kustomizationDirs map[string]bool
+	if a.ancestorMatch {
+		kustomizationDirs = make(map[string]bool, len(allKustomizations))
+		for _, kust := range allKustomizations {
+			kustomizationDirs[absPath(kust.Dir)] = true
+		}
+	}
 
 	for _, changedFile := range changedFiles {
 		slog.Debug("Processing changed file", "file", changedFile)
 
+		// Git reports paths relative to the working directory while graph nodes are absolute
+		changedFile = a.renderedPath(absPath(changedFile))
+
 		// Check if the changed file is a kustomization file itself
-		if isKustomizationFile(filepath.Base(changedFile)) {
+		if kustfile.Match(filepath.Base(changedFile), a.names...) {
 			dir := filepath.Dir(changedFile)
-			// Convert to absolute path to match graph nodes
-			absDir, err := filepath.Abs(dir)
-			if err != nil {
-				// Fall back to relative if abs fails
-				absDir = dir
-			}
 			slog.Debug("Changed file is kustomization file",
 				"file", changedFile,
-				"dir", absDir)
-			a.addAffected(absDir, g, affected)
+				"dir", dir)
+			a.addAffected(dir, changedFile, g, affected)
 			continue
 		}
 
+		// Ignored files only count where a kustomization names them
+		ignored := isIgnoredFile(changedFile, a.ignoreExtensions, a.ignoreNames)
+		if ignored {
+			slog.Debug("Changed file is ignored unless referenced explicitly", "file", changedFile)
+		}
+
 		// Check if the changed file is referenced by any kustomization
 		for _, kust := range allKustomizations {
-			if a.fileReferencedByKustomization(changedFile, kust) {
+			if a.fileReferencedByKustomization(changedFile, kust, g, !ignored) {
 				slog.Debug("Changed file referenced by kustomization",
 					"file", changedFile,
 					"kustomization", kust.Dir)
-				a.addAffected(kust.Dir, g, affected)
+				a.addAffected(kust.Dir, changedFile, g, affected)
 			}
 		}
-	}
 
-	// Convert map to slice
-	result := make([]string, 0, len(affected))
-	for path := range affected {
-		result = append(result, path)
+		if dir, ok := NearestKustomization(changedFile, kustomizationDirs); ok && !ignored {
+			slog.Debug("Changed file lies below kustomization",
+				"file", changedFile,
+				"kustomization", dir)
+			a.addAffected(dir, changedFile, g, affected)
+		}
 	}
 
 	slog.Debug("Impact analysis complete",
-		"affected_kustomizations", len(result))
+		"affected_kustomizations", len(affected))
 
-	return result
+	return affected
 }
 
-// addAffected adds a kustomization and all its dependents to the affected set
-func (a *analyzer) addAffected(dir string, g graph.Graph, affected map[string]bool) {
-	dir = filepath.Clean(dir)
+// addAffected adds a kustomization and all its dependents to the affected set, because
+// changedFile affects the kustomization in dir
+func (a *analyzer) addAffected(dir, changedFile string, g graph.Graph, affected Affected) {
+	dir = absPath(dir)
 
-	// Always add the directly affected kustomization
-	affected[dir] = true
-	slog.Debug("Added affected kustomization", "path", dir)
-
-	// Recursively add all kustomizations that depend on this one
+	// Recursively collect all kustomizations that depend on this one
 	// This catches the full impact chain: if a base changes, test all overlays,
 	// and if those overlays are also bases, test their dependents too
-	dependents := g.GetAllDependents(dir)
+	var dependents []string
+	if a.includeDependents {
+		dependents = g.GetDependentsWithinDepth(dir, a.maxDependentDepth)
+	}
+
+	// Add the directly affected kustomization. A base is skipped when it isn't built in
+	// isolation, but only if a dependent covers it: a base whose overlays live elsewhere,
+	// a no-fanout base or one whose dependents aren't included is built itself
+	if a.buildBases || len(dependents) == 0 {
+		affected.add(dir, Reason{File: changedFile})
+		slog.Debug("Added affected kustomization", "path", dir)
+	} else {
+		slog.Debug("Skipping changed base, only its dependents are built", "path", dir)
+	}
 
 	if len(dependents) > 0 {
 		slog.Debug("Adding dependents to affected set",
@@ -97,29 +263,60 @@ func (a *analyzer) addAffected(dir string, g graph.Graph, affected map[string]bo
 	}
 
 	for _, dependent := range dependents {
-		cleanDep := filepath.Clean(dependent)
-		affected[cleanDep] = true
-		slog.Debug("Added dependent to affected set", "path", cleanDep)
+		absDep := absPath(dependent)
+		affected.add(absDep, Reason{File: changedFile, Base: dir})
+		slog.Debug("Added dependent to affected set", "path", absDep)
 	}
 }
 
-// fileReferencedByKustomization checks if a file is referenced by a kustomization
-func (a *analyzer) fileReferencedByKustomization(changedFile string, kust discovery.KustomizeFile) bool {
-	changedFile = filepath.Clean(changedFile)
-	kustDir := filepath.Clean(kust.Dir)
-
-	// Check if the changed file is in the same directory or subdirectory
-	if !strings.HasPrefix(changedFile, kustDir) {
-		return false
+// renderedPath strips a template suffix from path, returning the path of the rendered file
+func (a *analyzer) renderedPath(path string) string {
+	for _, suffix := range a.templateSuffixes {
+		if rendered, ok := strings.CutSuffix(path, suffix); ok && !strings.HasSuffix(rendered, string(filepath.Separator)) {
+			slog.Debug("Treating changed template as its rendered file", "template", path, "file", rendered)
+			return rendered
+		}
 	}
+	return path
+}
+
+// fileReferencedByKustomization checks if a file is referenced by a kustomization.
+// Files inside referenced kustomization directories are left to the dependency graph.
+// Unless dirMatches is set, only references naming the file itself count, not directories
+// or glob patterns the file lies in.
+func (a *analyzer) fileReferencedByKustomization(changedFile string, kust discovery.KustomizeFile, g graph.Graph, dirMatches bool) bool {
+	changedFile = absPath(changedFile)
+	kustDir := absPath(kust.Dir)
+
+	// Check if this relative path is in resources, patches, the generator inputs, the
+	// transformer/generator configs, the schema files or the helm values files, which
+	// may also live outside the kustomization directory
+	refs := append(append(append([]string{}, kust.Resources...), kust.Transformers...), kust.Generators...)
+	refs = append(append(refs, kust.Patches...), kust.GeneratorFiles...)
+	refs = append(append(refs, kust.SchemaFiles...), kust.HelmValues...)
+	for _, resource := range refs {
+		if discovery.IsRemoteRef(resource) {
+			continue
+		}
 
-	// Check if this relative path is in resources
-	for _, resource := range kust.Resources {
 		// Resource could be a file or directory
 		resourcePath := filepath.Clean(filepath.Join(kustDir, resource))
 
+		// Resource could also be a glob pattern matching newly added files
+		if pathglob.HasMeta(resource) {
+			if dirMatches && pathglob.Match(resourcePath, changedFile) {
+				return true
+			}
+			continue
+		}
+
+		// Referenced kustomizations are affected through the graph, their dependents follow from there
+		if g.GetNode(resourcePath) != nil {
+			continue
+		}
+
 		// Check if changed file is the resource or inside a resource directory
-		if changedFile == resourcePath || strings.HasPrefix(changedFile, resourcePath+string(filepath.Separator)) {
+		if changedFile == resourcePath || dirMatches && isWithinDir(changedFile, resourcePath) {
 			return true
 		}
 	}
@@ -127,9 +324,50 @@ func (a *analyzer) fileReferencedByKustomization(changedFile string, kust discov
 	return false
 }
 
-// isKustomizationFile checks if a filename is a kustomization file
-func isKustomizationFile(name string) bool {
-	return name == "kustomization.yaml" ||
-		name == "kustomization.yml" ||
-		name == "Kustomization"
+// NearestKustomization walks up from the directory of path to the first directory in dirs
+func NearestKustomization(path string, dirs map[string]bool) (string, bool) {
+	if len(dirs) == 0 {
+		return "", false
+	}
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if dirs[dir] {
+			return dir, true
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return "", false
+		}
+	}
+}
+
+// absPath returns the cleaned absolute form of path, so the same directory always
+// maps to the same key regardless of how it was expressed
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		// Fall back to the cleaned relative path if abs fails
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// relPath returns path relative to the working directory when it lies below it
+func relPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil || !isWithinDir(path, wd) {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// isWithinDir checks if path is dir itself or lies below it, respecting path separator
+// boundaries so that "app" doesn't match "app-staging"
+func isWithinDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
@@ -0,0 +1,530 @@
+package analyzer
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/michielvha/kustomize-build-check/internal/discovery"
+	"github.com/michielvha/kustomize-build-check/internal/graph"
+)
+
+func TestFileReferencedBySiblingPrefix(t *testing.T) {
+	// "app" is a name prefix of "app-staging", only the latter references the changed file
+	kustomizations := []discovery.KustomizeFile{
+		{Dir: "/repo/app", Resources: []string{"deployment.yaml"}},
+		{Dir: "/repo/app-staging", Resources: []string{"deployment.yaml"}},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	affected := New().GetAffectedKustomizations([]string{"/repo/app-staging/deployment.yaml"}, g, kustomizations)
+
+	if len(affected) != 1 || affected[0] != "/repo/app-staging" {
+		t.Errorf("expected only /repo/app-staging to be affected, got %v", affected)
+	}
+}
+
+func TestIsWithinDir(t *testing.T) {
+	tests := []struct {
+		path string
+		dir  string
+		want bool
+	}{
+		{"/repo/app/deployment.yaml", "/repo/app", true},
+		{"/repo/app", "/repo/app", true},
+		{"/repo/app/nested/config.yaml", "/repo/app", true},
+		{"/repo/app-staging/deployment.yaml", "/repo/app", false},
+		{"/repo/other/deployment.yaml", "/repo/app", false},
+		{"/repo/..config/file.yaml", "/repo", true},
+	}
+
+	for _, tt := range tests {
+		if got := isWithinDir(tt.path, tt.dir); got != tt.want {
+			t.Errorf("isWithinDir(%q, %q) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestGeneratorFileReferenced(t *testing.T) {
+	kustomizations := []discovery.KustomizeFile{
+		{
+			Dir:        "/repo/overlays/dev",
+			Resources:  []string{"../../base"},
+			Generators: []string{"../../generators/secrets.yaml"},
+		},
+		{Dir: "/repo/overlays/prod", Resources: []string{"../../base"}},
+		{Dir: "/repo/base", Resources: []string{"deployment.yaml"}},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	affected := New().GetAffectedKustomizations([]string{"/repo/generators/secrets.yaml"}, g, kustomizations)
+
+	if len(affected) != 1 || affected[0] != "/repo/overlays/dev" {
+		t.Errorf("expected only /repo/overlays/dev to be affected, got %v", affected)
+	}
+}
+
+func TestSchemaFilesReferenced(t *testing.T) {
+	kustomizations := []discovery.KustomizeFile{
+		{
+			Dir:         "/repo/apps/rollouts",
+			Resources:   []string{"rollout.yaml"},
+			SchemaFiles: []string{"../../schemas/argo.json", "crds/rollout.yaml"},
+		},
+		{Dir: "/repo/apps/web", Resources: []string{"deployment.yaml"}},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	for _, changed := range []string{"/repo/schemas/argo.json", "/repo/apps/rollouts/crds/rollout.yaml"} {
+		affected := New().GetAffectedKustomizations([]string{changed}, g, kustomizations)
+		if len(affected) != 1 || affected[0] != "/repo/apps/rollouts" {
+			t.Errorf("expected a change to %s to only affect /repo/apps/rollouts, got %v", changed, affected)
+		}
+	}
+}
+
+func TestHelmValuesReferenced(t *testing.T) {
+	kustomizations := []discovery.KustomizeFile{
+		{
+			Dir:        "/repo/overlays/prod",
+			Resources:  []string{"../../base"},
+			HelmValues: []string{"values-prod.yaml", "https://example.com/values.yaml"},
+		},
+		{Dir: "/repo/overlays/dev", Resources: []string{"../../base"}},
+		{Dir: "/repo/base", Resources: []string{"deployment.yaml"}},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	affected := New().GetAffectedKustomizations([]string{"/repo/overlays/prod/values-prod.yaml"}, g, kustomizations)
+
+	if len(affected) != 1 || affected[0] != "/repo/overlays/prod" {
+		t.Errorf("expected only /repo/overlays/prod to be affected, got %v", affected)
+	}
+}
+
+func TestGlobResourcesReferenced(t *testing.T) {
+	tests := []struct {
+		name        string
+		resource    string
+		changedFile string
+		want        bool
+	}{
+		{"star matches new file", "configs/*.yaml", "/repo/app/configs/new.yaml", true},
+		{"star does not match nested file", "configs/*.yaml", "/repo/app/configs/nested/new.yaml", false},
+		{"star does not match other extension", "configs/*.yaml", "/repo/app/configs/new.json", false},
+		{"double star matches nested file", "configs/**/*.yaml", "/repo/app/configs/a/b/new.yaml", true},
+		{"double star matches direct file", "configs/**/*.yaml", "/repo/app/configs/new.yaml", true},
+		{"glob outside the directory", "../shared/*.yaml", "/repo/shared/cm.yaml", true},
+	}
+
+	a := &analyzer{}
+	g := graph.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kust := discovery.KustomizeFile{Dir: "/repo/app", Resources: []string{tt.resource}}
+			if got := a.fileReferencedByKustomization(tt.changedFile, kust, g, true); got != tt.want {
+				t.Errorf("fileReferencedByKustomization(%q) with %q = %v, want %v", tt.changedFile, tt.resource, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAffectedPathsDeduplicated(t *testing.T) {
+	root := t.TempDir()
+	t.Chdir(root)
+
+	kustomizations := []discovery.KustomizeFile{
+		{Dir: filepath.Join(root, "base"), Resources: []string{"deployment.yaml"}},
+		{Dir: filepath.Join(root, "overlays", "dev") + string(filepath.Separator), Resources: []string{"../../base"}},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	// The overlay is both directly changed and a dependent of the changed base
+	changedFiles := []string{
+		"base/deployment.yaml",
+		"./overlays/dev/kustomization.yaml",
+		"overlays//dev/kustomization.yaml",
+	}
+	affected := New().GetAffectedKustomizations(changedFiles, g, kustomizations)
+	sort.Strings(affected)
+
+	want := []string{filepath.Join(root, "base"), filepath.Join(root, "overlays", "dev")}
+	if !slices.Equal(affected, want) {
+		t.Errorf("expected %v, got %v", want, affected)
+	}
+}
+
+func TestAnalyzeReasons(t *testing.T) {
+	kustomizations := []discovery.KustomizeFile{
+		{Dir: "/repo/base", Resources: []string{"deployment.yaml"}},
+		{Dir: "/repo/overlays/prod", Resources: []string{"../../base", "ingress.yaml"}},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	changed := []string{"/repo/base/deployment.yaml", "/repo/overlays/prod/ingress.yaml"}
+	affected := New().Analyze(changed, g, kustomizations)
+
+	want := Affected{
+		"/repo/base": {{File: "/repo/base/deployment.yaml"}},
+		"/repo/overlays/prod": {
+			{File: "/repo/base/deployment.yaml", Base: "/repo/base"},
+			{File: "/repo/overlays/prod/ingress.yaml"},
+		},
+	}
+	if !reflect.DeepEqual(affected, want) {
+		t.Errorf("Analyze() = %v, want %v", affected, want)
+	}
+	if paths := affected.Paths(); !slices.Equal(paths, []string{"/repo/base", "/repo/overlays/prod"}) {
+		t.Errorf("Paths() = %v", paths)
+	}
+	if got := affected["/repo/overlays/prod"][0].String(); got != "/repo/base/deployment.yaml changed (via /repo/base)" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestChangedKustomizationNames(t *testing.T) {
+	kustomizations := []discovery.KustomizeFile{
+		{Path: "/repo/upper/kustomization.YAML", Dir: "/repo/upper"},
+		{Path: "/repo/custom/kustomization.gen.yaml", Dir: "/repo/custom"},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	// Changed files are recognized the same way discovery recognizes them
+	changed := []string{"/repo/upper/kustomization.YAML", "/repo/custom/kustomization.gen.yaml"}
+	affected := New(WithKustomizationNames([]string{"kustomization.gen.yaml"})).GetAffectedKustomizations(changed, g, kustomizations)
+	sort.Strings(affected)
+	if want := []string{"/repo/custom", "/repo/upper"}; !slices.Equal(affected, want) {
+		t.Errorf("expected %v, got %v", want, affected)
+	}
+}
+
+func TestTemplateSuffixes(t *testing.T) {
+	kustomizations := []discovery.KustomizeFile{
+		{Dir: "/repo/app", Resources: []string{"deployment.yaml"}},
+		{Dir: "/repo/other", Resources: []string{"service.yaml"}},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	changed := []string{"/repo/app/deployment.yaml.j2"}
+	if affected := New().GetAffectedKustomizations(changed, g, kustomizations); len(affected) != 0 {
+		t.Errorf("expected templates not to match without suffixes, got %v", affected)
+	}
+
+	for _, suffix := range []string{".j2", "j2"} {
+		affected := New(WithTemplateSuffixes([]string{".tmpl", suffix})).GetAffectedKustomizations(changed, g, kustomizations)
+		if len(affected) != 1 || affected[0] != "/repo/app" {
+			t.Errorf("expected the template to affect /repo/app with suffix %q, got %v", suffix, affected)
+		}
+	}
+}
+
+func TestAncestorMatch(t *testing.T) {
+	kustomizations := []discovery.KustomizeFile{
+		{Dir: "/repo/base", Resources: []string{"deployment.yaml"}},
+		{Dir: "/repo/overlays/dev", Resources: []string{"../../base"}},
+		{Dir: "/repo/overlays/prod", Resources: []string{"../../base", "ingress.yaml"}},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		changed  string
+		precise  []string
+		ancestor []string
+	}{
+		{
+			name:     "file read by an unparsed generator",
+			changed:  "/repo/overlays/dev/generated/config.env",
+			precise:  []string{},
+			ancestor: []string{"/repo/overlays/dev"},
+		},
+		{
+			name:     "referenced file is matched by both",
+			changed:  "/repo/overlays/prod/ingress.yaml",
+			precise:  []string{"/repo/overlays/prod"},
+			ancestor: []string{"/repo/overlays/prod"},
+		},
+		{
+			name:     "base file includes the dependents",
+			changed:  "/repo/base/patches/replicas.yaml",
+			precise:  []string{},
+			ancestor: []string{"/repo/base", "/repo/overlays/dev", "/repo/overlays/prod"},
+		},
+		{
+			name:     "file outside any kustomization",
+			changed:  "/repo/docs/README.md",
+			precise:  []string{},
+			ancestor: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			precise := New().GetAffectedKustomizations([]string{tt.changed}, g, kustomizations)
+			slices.Sort(precise)
+			if !slices.Equal(precise, tt.precise) {
+				t.Errorf("precise matching = %v, want %v", precise, tt.precise)
+			}
+
+			ancestor := New(WithAncestorMatch(true)).GetAffectedKustomizations([]string{tt.changed}, g, kustomizations)
+			slices.Sort(ancestor)
+			if !slices.Equal(ancestor, tt.ancestor) {
+				t.Errorf("ancestor matching = %v, want %v", ancestor, tt.ancestor)
+			}
+		})
+	}
+}
+
+func TestSkipDependents(t *testing.T) {
+	kustomizations := []discovery.KustomizeFile{
+		{Dir: "/repo/base", Resources: []string{"deployment.yaml"}},
+		{Dir: "/repo/overlays/dev", Resources: []string{"../../base"}},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	changed := []string{"/repo/base/deployment.yaml"}
+
+	affected := New().GetAffectedKustomizations(changed, g, kustomizations)
+	if len(affected) != 2 {
+		t.Errorf("expected the base and its overlay to be affected, got %v", affected)
+	}
+
+	affected = New(WithIncludeDependents(false)).GetAffectedKustomizations(changed, g, kustomizations)
+	if len(affected) != 1 || affected[0] != "/repo/base" {
+		t.Errorf("expected only /repo/base to be affected, got %v", affected)
+	}
+}
+
+func TestBuildBases(t *testing.T) {
+	kustomizations := []discovery.KustomizeFile{
+		{Dir: "/repo/base", Resources: []string{"deployment.yaml"}},
+		{Dir: "/repo/overlays/dev", Resources: []string{"../../base"}},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	changed := []string{"/repo/base/deployment.yaml"}
+
+	affected := New().GetAffectedKustomizations(changed, g, kustomizations)
+	if !slices.Contains(affected, "/repo/base") {
+		t.Errorf("expected the changed base to be built by default, got %v", affected)
+	}
+
+	affected = New(WithBuildBases(false)).GetAffectedKustomizations(changed, g, kustomizations)
+	if len(affected) != 1 || affected[0] != "/repo/overlays/dev" {
+		t.Errorf("expected only the overlay to be built, got %v", affected)
+	}
+
+	// Without its dependents nothing else would build the changed base
+	affected = New(WithBuildBases(false), WithIncludeDependents(false)).GetAffectedKustomizations(changed, g, kustomizations)
+	if len(affected) != 1 || affected[0] != "/repo/base" {
+		t.Errorf("expected the changed base to be built without dependents, got %v", affected)
+	}
+}
+
+func TestBuildBasesWithoutDependents(t *testing.T) {
+	// The overlays of this base live in another repository
+	kustomizations := []discovery.KustomizeFile{
+		{Dir: "/repo/base", Resources: []string{"deployment.yaml"}},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	for _, changed := range []string{"/repo/base/deployment.yaml", "/repo/base/kustomization.yaml"} {
+		affected := New(WithBuildBases(false)).GetAffectedKustomizations([]string{changed}, g, kustomizations)
+		if len(affected) != 1 || affected[0] != "/repo/base" {
+			t.Errorf("expected %s to affect /repo/base, got %v", changed, affected)
+		}
+	}
+}
+
+func TestNoFanout(t *testing.T) {
+	kustomizations := []discovery.KustomizeFile{
+		{Dir: "/repo/crds", Resources: []string{"bundle.yaml"}},
+		{Dir: "/repo/base", Resources: []string{"../crds", "deployment.yaml"}},
+		{Dir: "/repo/overlays/dev", Resources: []string{"../../base"}},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	g.SetNoFanout(MatchKustomizations(kustomizations, "/repo", []string{"crds"}))
+
+	// The no-fanout base is built as a leaf even when bases aren't built
+	affected := New(WithBuildBases(false)).GetAffectedKustomizations([]string{"/repo/crds/bundle.yaml"}, g, kustomizations)
+	if len(affected) != 1 || affected[0] != "/repo/crds" {
+		t.Errorf("expected only /repo/crds to be affected, got %v", affected)
+	}
+
+	// Other bases still fan out
+	affected = New().GetAffectedKustomizations([]string{"/repo/base/deployment.yaml"}, g, kustomizations)
+	if len(affected) != 2 {
+		t.Errorf("expected the base and its overlay to be affected, got %v", affected)
+	}
+}
+
+func TestApplyPathFilters(t *testing.T) {
+	kustomizations := []discovery.KustomizeFile{
+		{Dir: "/repo/apps/web"},
+		{Dir: "/repo/apps/experimental/beta"},
+		{Dir: "/repo/clusters/prod"},
+		{Dir: "/repo/clusters/staging"},
+	}
+	affected := []string{"/repo/apps/web", "/repo/apps/experimental/beta"}
+
+	paths, skipped := ApplyPathFilters(affected, kustomizations, "/repo",
+		[]string{"apps/experimental", "clusters/staging"},
+		[]string{"clusters/*"},
+	)
+
+	// Forced clusters are added, skip wins over force for clusters/staging
+	if want := []string{"/repo/apps/web", "/repo/clusters/prod"}; !slices.Equal(paths, want) {
+		t.Errorf("expected paths %v, got %v", want, paths)
+	}
+	if want := []string{"/repo/apps/experimental/beta", "/repo/clusters/staging"}; !slices.Equal(skipped, want) {
+		t.Errorf("expected skipped %v, got %v", want, skipped)
+	}
+
+	// Without lists the affected paths are returned unchanged
+	paths, skipped = ApplyPathFilters(affected, kustomizations, "/repo", nil, nil)
+	if !slices.Equal(paths, affected) || len(skipped) != 0 {
+		t.Errorf("expected affected paths unchanged, got %v and skipped %v", paths, skipped)
+	}
+}
+
+func TestFilterIgnoredFiles(t *testing.T) {
+	files := []string{
+		"/repo/app/README.md",
+		"/repo/app/docs/guide.MD",
+		"/repo/app/OWNERS",
+		"/repo/app/deployment.yaml",
+		"/repo/app/OWNERS.yaml",
+		"/repo/app/md",
+	}
+
+	kept, ignored := FilterIgnoredFiles(files, []string{"md"}, DefaultIgnoreFiles)
+	if want := []string{"/repo/app/deployment.yaml", "/repo/app/OWNERS.yaml", "/repo/app/md"}; !slices.Equal(kept, want) {
+		t.Errorf("kept = %v, want %v", kept, want)
+	}
+	if want := []string{"/repo/app/README.md", "/repo/app/docs/guide.MD", "/repo/app/OWNERS"}; !slices.Equal(ignored, want) {
+		t.Errorf("ignored = %v, want %v", ignored, want)
+	}
+
+	if kept, ignored := FilterIgnoredFiles(files, nil, nil); len(kept) != len(files) || len(ignored) != 0 {
+		t.Errorf("expected nothing to be ignored without patterns, got %v", ignored)
+	}
+}
+
+func TestIgnoredFiles(t *testing.T) {
+	kustomizations := []discovery.KustomizeFile{
+		{Dir: "/repo/app", Resources: []string{"manifests"}, GeneratorFiles: []string{"docs/README.md"}},
+		{Dir: "/repo/web", Resources: []string{"deployment.yaml"}, Patches: []string{"LICENSE"}},
+	}
+
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	a := New(WithIgnoredFiles(DefaultIgnoreExtensions, DefaultIgnoreFiles), WithAncestorMatch(true))
+	tests := []struct {
+		changed string
+		want    []string
+	}{
+		// Read by a configMapGenerator, or listed as a patch
+		{"/repo/app/docs/README.md", []string{"/repo/app"}},
+		{"/repo/web/LICENSE", []string{"/repo/web"}},
+		// Only inside a resource directory or below a kustomization
+		{"/repo/app/manifests/README.md", []string{}},
+		{"/repo/web/OWNERS", []string{}},
+		{"/repo/app/manifests/deployment.yaml", []string{"/repo/app"}},
+	}
+
+	for _, tt := range tests {
+		if got := a.GetAffectedKustomizations([]string{tt.changed}, g, kustomizations); !slices.Equal(got, tt.want) {
+			t.Errorf("a change to %s affected %v, want %v", tt.changed, got, tt.want)
+		}
+	}
+}
+
+func TestShardPaths(t *testing.T) {
+	var paths []string
+	for i := range 40 {
+		paths = append(paths, fmt.Sprintf("/repo/overlays/env-%d", i))
+	}
+
+	// The shards are disjoint, cover every path and don't depend on the input order
+	seen := make(map[string]int)
+	for index := 1; index <= 4; index++ {
+		shard := ShardPaths(paths, "/repo", index, 4)
+		reversed := append([]string{}, paths...)
+		slices.Reverse(reversed)
+		again := ShardPaths(reversed, "/repo", index, 4)
+		slices.Reverse(again)
+		if !slices.Equal(shard, again) {
+			t.Errorf("expected shard %d to be stable, got %v and %v", index, shard, again)
+		}
+		for _, path := range shard {
+			seen[path]++
+		}
+	}
+	for _, path := range paths {
+		if seen[path] != 1 {
+			t.Errorf("expected %s in exactly one shard, got %d", path, seen[path])
+		}
+	}
+
+	if got := ShardPaths(paths, "/repo", 1, 1); !slices.Equal(got, paths) {
+		t.Errorf("expected a single shard to hold all paths, got %v", got)
+	}
+}
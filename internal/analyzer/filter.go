@@ -0,0 +1,123 @@
+package analyzer
+
+import (
+	"hash/fnv"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/michielvha/kustomize-build-check/internal/discovery"
+	"github.com/michielvha/kustomize-build-check/internal/pathglob"
+)
+
+// DefaultIgnoreExtensions are the extensions of changed files, e.g. documentation, that only
+// affect the kustomizations naming them, not the ones whose directories they lie in
+var DefaultIgnoreExtensions = []string{".md"}
+
+// DefaultIgnoreFiles are the names of changed files, like ownership and license files next
+// to the manifests, that only affect the kustomizations naming them
+var DefaultIgnoreFiles = []string{"OWNERS", "OWNERS_ALIASES", "CODEOWNERS", "LICENSE"}
+
+// FilterIgnoredFiles drops the changed files with one of the extensions (the leading dot is
+// optional, compared case-insensitively) or base names. The dropped files are returned as
+// ignored.
+func FilterIgnoredFiles(files, extensions, names []string) (kept, ignored []string) {
+	for _, file := range files {
+		if isIgnoredFile(file, extensions, names) {
+			ignored = append(ignored, file)
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept, ignored
+}
+
+// isIgnoredFile checks if file has one of the extensions or base names, see FilterIgnoredFiles
+func isIgnoredFile(file string, extensions, names []string) bool {
+	base := filepath.Base(file)
+	if slices.Contains(names, base) {
+		return true
+	}
+	ext := filepath.Ext(base)
+	return ext != "" && slices.ContainsFunc(extensions, func(ignore string) bool {
+		return strings.EqualFold("."+strings.TrimPrefix(ignore, "."), ext)
+	})
+}
+
+// ApplyPathFilters adjusts the affected paths with the skip and force glob lists.
+// Force adds every discovered kustomization matching a pattern, skip then removes matches
+// from the result, so a path in both lists is skipped. Patterns match kustomization
+// directories relative to baseDir, or any of their parents. The returned skipped
+// paths were affected (or forced) but removed by skip.
+func ApplyPathFilters(
+	affected []string,
+	allKustomizations []discovery.KustomizeFile,
+	baseDir string,
+	skip, force []string,
+) (paths, skipped []string) {
+	paths = append([]string{}, affected...)
+
+	if len(force) > 0 {
+		for _, kust := range allKustomizations {
+			dir := absPath(kust.Dir)
+			if pathglob.MatchAnyTree(force, relativeTo(baseDir, dir)) && !slices.Contains(paths, dir) {
+				paths = append(paths, dir)
+			}
+		}
+	}
+
+	if len(skip) == 0 {
+		return paths, nil
+	}
+
+	kept := paths[:0]
+	for _, path := range paths {
+		if pathglob.MatchAnyTree(skip, relativeTo(baseDir, path)) {
+			skipped = append(skipped, path)
+			continue
+		}
+		kept = append(kept, path)
+	}
+
+	return kept, skipped
+}
+
+// MatchKustomizations returns the directories of the kustomizations matching one of the
+// glob patterns relative to baseDir, or lying below a matching directory
+func MatchKustomizations(allKustomizations []discovery.KustomizeFile, baseDir string, patterns []string) []string {
+	var matched []string
+	if len(patterns) == 0 {
+		return matched
+	}
+	for _, kust := range allKustomizations {
+		dir := absPath(kust.Dir)
+		if pathglob.MatchAnyTree(patterns, relativeTo(baseDir, dir)) {
+			matched = append(matched, dir)
+		}
+	}
+	return matched
+}
+
+// ShardPaths returns the paths falling into shard index (1-based) of total, partitioning by a
+// hash of each path relative to baseDir. The partition only depends on the path, so a re-run
+// of a shard builds the same paths and the shards together cover all paths exactly once.
+func ShardPaths(paths []string, baseDir string, index, total int) []string {
+	var shard []string
+	for _, path := range paths {
+		h := fnv.New32a()
+		h.Write([]byte(relativeTo(baseDir, path)))
+		if int(h.Sum32()%uint32(total)) == index-1 {
+			shard = append(shard, path)
+		}
+	}
+	return shard
+}
+
+// relativeTo returns path relative to baseDir as a slash-separated path for glob matching
+func relativeTo(baseDir, path string) string {
+	rel, err := filepath.Rel(absPath(baseDir), path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -2,10 +2,20 @@ package builder
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/michielvha/kustomize-build-check/internal/cache"
+	"github.com/michielvha/kustomize-build-check/internal/helm"
 )
 
 // BuildResult represents the result of a kustomize build
@@ -15,33 +25,375 @@ type BuildResult struct {
 	Output   string
 	Error    string
 	Duration time.Duration
+	TimedOut bool
+	Attempts int
+	Cached   bool
+
+	// Skipped is set for builds that didn't get to finish before the deadline of the context
+	// passed to BuildAll, or after another build failed with fail-fast. Only Path and
+	// FailFast are set then.
+	Skipped bool
+	// FailFast is set for builds skipped because another build failed with fail-fast
+	FailFast bool
+
+	// OutputTruncated is set when Output was cut off at the configured maximum size
+	OutputTruncated bool
+
+	// ErrorKind categorizes a failed build, it is empty for successful builds
+	ErrorKind ErrorKind
+
+	// Warnings are the warning lines kustomize printed on stderr of a successful build,
+	// e.g. deprecation notices
+	Warnings []string
+
+	// Stderr is everything kustomize printed on stderr, for failed builds it is also part
+	// of Error. It is empty for cached builds.
+	Stderr string
+
+	// Resource usage of the kustomize process, MaxRSS is in bytes and only captured on Linux
+	MaxRSS     int64
+	UserTime   time.Duration
+	SystemTime time.Duration
 }
 
 // Builder executes kustomize builds
 type Builder interface {
-	Build(path string, enableHelm bool) BuildResult
-	BuildAll(paths []string, enableHelm bool) []BuildResult
+	Build(ctx context.Context, path string, enableHelm bool) BuildResult
+	BuildAll(ctx context.Context, paths []string, enableHelm bool) []BuildResult
+	CheckBinary() error
+}
+
+// PluginHomeEnv is the environment variable pointing kustomize at its plugin directory
+const PluginHomeEnv = "KUSTOMIZE_PLUGIN_HOME"
+
+// errFailFast cancels the builds of BuildAll after the first failure with fail-fast
+var errFailFast = errors.New("another build failed with fail-fast")
+
+// ErrKustomizeNotFound is returned by CheckBinary when the kustomize executable can't be found
+var ErrKustomizeNotFound = errors.New("kustomize not found")
+
+// Progress receives build lifecycle events, e.g. to report progress during long runs.
+// Calls are serialized, started and finished count the builds that reached that state so far.
+type Progress interface {
+	Started(started, total int, path string)
+	Finished(finished, total int, result BuildResult)
 }
 
 type builder struct {
-	timeout time.Duration
+	binary      string
+	timeout     time.Duration
+	retries     int
+	backoff     time.Duration
+	cache       cache.Cache
+	concurrency int
+	progress    Progress
+	env         []string
+	helmCache   string
+	maxOutput   int
+	failOnWarn  bool
+	failFast    bool
+	deps        map[string][]string
+
+	alphaPlugins bool
+	enableExec   bool
+	pluginHome   string
+
+	// helmCommand is the --helm-command script restoring the shared helm cache, written once
+	helmCommandOnce sync.Once
+	helmCommand     string
+
+	// version is the output of kustomize version, read once for the cache key
+	versionOnce sync.Once
+	version     string
+}
+
+// waitDelay bounds how long a killed build may wait for its output to be closed
+const waitDelay = 5 * time.Second
+
+// Option configures a Builder
+type Option func(*builder)
+
+// WithBinary runs the kustomize executable at path, or looked up in PATH by name, instead of "kustomize"
+func WithBinary(path string) Option {
+	return func(b *builder) {
+		if path != "" {
+			b.binary = path
+		}
+	}
+}
+
+// WithTimeout kills builds running longer than d
+func WithTimeout(d time.Duration) Option {
+	return func(b *builder) {
+		b.timeout = d
+	}
+}
+
+// WithRetries retries builds failing with a transient error up to n times
+func WithRetries(n int) Option {
+	return func(b *builder) {
+		b.retries = n
+	}
+}
+
+// WithCache skips builds whose inputs match a previously cached successful build
+func WithCache(c cache.Cache) Option {
+	return func(b *builder) {
+		b.cache = c
+	}
+}
+
+// WithConcurrency runs up to n builds in parallel
+func WithConcurrency(n int) Option {
+	return func(b *builder) {
+		b.concurrency = n
+	}
+}
+
+// WithProgress reports build starts and completions to p
+func WithProgress(p Progress) Option {
+	return func(b *builder) {
+		b.progress = p
+	}
+}
+
+// WithEnv sets additional KEY=VALUE environment variables for kustomize on top of the
+// inherited environment. They may be secrets and are never logged.
+func WithEnv(env []string) Option {
+	return func(b *builder) {
+		b.env = env
+	}
+}
+
+// WithHelmCacheDir points helm at a shared HELM_CACHE_HOME, so a chart used by several
+// kustomizations is only downloaded once. Kustomize gives helm its own home for every build,
+// so helm is run through a --helm-command script in dir that restores it. It does not affect
+// build results or cache keys.
+func WithHelmCacheDir(dir string) Option {
+	return func(b *builder) {
+		b.helmCache = dir
+	}
+}
+
+// WithMaxOutputBytes caps the captured output of a build at n bytes, cutting it off with a
+// marker, so a runaway generator can't blow up reports and outputs. 0 means unlimited.
+func WithMaxOutputBytes(n int) Option {
+	return func(b *builder) {
+		b.maxOutput = n
+	}
+}
+
+// WithFailOnWarning fails successful builds that printed warnings, e.g. to enforce the
+// migration away from deprecated fields
+func WithFailOnWarning(fail bool) Option {
+	return func(b *builder) {
+		b.failOnWarn = fail
+	}
+}
+
+// WithAlphaPlugins builds with --enable-alpha-plugins, required for KRM function and
+// legacy exec plugins
+func WithAlphaPlugins(enable bool) Option {
+	return func(b *builder) {
+		b.alphaPlugins = enable
+	}
+}
+
+// WithExec builds with --enable-exec, allowing KRM functions to run as local executables
+func WithExec(enable bool) Option {
+	return func(b *builder) {
+		b.enableExec = enable
+	}
+}
+
+// WithPluginHome sets KUSTOMIZE_PLUGIN_HOME, the directory kustomize loads legacy plugins from.
+// Changes to the plugins themselves don't invalidate cached builds.
+func WithPluginHome(dir string) Option {
+	return func(b *builder) {
+		b.pluginHome = dir
+	}
+}
+
+// WithFailFast stops BuildAll at the first failed build, the builds in flight are killed
+// and they and the builds not started yet are returned as skipped
+func WithFailFast(failFast bool) Option {
+	return func(b *builder) {
+		b.failFast = failFast
+	}
+}
+
+// WithDependencies makes BuildAll start a build only after the builds of the paths it depends
+// on finished, so base errors surface before the overlays using them are built. deps maps
+// paths to the paths they depend on, dependencies that aren't built are ignored.
+func WithDependencies(deps map[string][]string) Option {
+	return func(b *builder) {
+		b.deps = deps
+	}
 }
 
 // New creates a new Builder with default 2-minute timeout
-func New() Builder {
-	return &builder{
-		timeout: 2 * time.Minute,
+func New(opts ...Option) Builder {
+	b := &builder{
+		binary:      "kustomize",
+		timeout:     2 * time.Minute,
+		backoff:     time.Second,
+		concurrency: 1,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// CheckBinary verifies the kustomize executable exists, so a missing install can be
+// reported once instead of failing every build with the same error
+func (b *builder) CheckBinary() error {
+	if _, err := exec.LookPath(b.binary); err != nil {
+		return fmt.Errorf("%w: %w", ErrKustomizeNotFound, err)
 	}
+	return nil
 }
 
-// Build executes a single kustomize build
-func (b *builder) Build(path string, enableHelm bool) BuildResult {
+// Build executes a single kustomize build, retrying transient failures with exponential backoff.
+// When a cache is configured, a cached successful build with identical inputs is reused.
+func (b *builder) Build(ctx context.Context, path string, enableHelm bool) BuildResult {
+	return b.checkWarnings(b.buildCached(ctx, path, enableHelm))
+}
+
+// buildCached executes a build unless the cache holds a successful one with identical inputs
+func (b *builder) buildCached(ctx context.Context, path string, enableHelm bool) BuildResult {
+	if b.cache == nil {
+		return b.buildWithRetries(ctx, path, enableHelm)
+	}
+
+	key, err := b.cache.Key(path, b.cacheExtra(ctx, enableHelm)...)
+	if err != nil {
+		slog.Debug("Failed to compute cache key, building without cache", "path", path, "error", err)
+		return b.buildWithRetries(ctx, path, enableHelm)
+	}
+
+	if entry, ok := b.cache.Get(key); ok {
+		slog.Debug("Using cached build result", "path", path, "key", key)
+		// The entry may come from a run without the current output limit
+		output := &limitedBuffer{limit: b.maxOutput}
+		output.Write([]byte(entry.Output))
+		return BuildResult{
+			Path:            path,
+			Success:         true,
+			Output:          output.String(),
+			OutputTruncated: output.truncated,
+			Warnings:        entry.Warnings,
+			Stderr:          entry.Stderr,
+			Cached:          true,
+		}
+	}
+
+	result := b.buildWithRetries(ctx, path, enableHelm)
+	// A truncated output would be wrong under a larger limit
+	if result.Success && !result.OutputTruncated {
+		entry := cache.Entry{Path: path, Output: result.Output, Warnings: result.Warnings, Stderr: result.Stderr, CreatedAt: time.Now()}
+		if err := b.cache.Put(key, entry); err != nil {
+			slog.Warn("Failed to store build result in cache", "path", path, "error", err)
+		}
+	}
+
+	return result
+}
+
+// cacheExtra returns the settings besides the input files that change the output of a build.
+// The build environment only ends up in the key as part of a hash.
+func (b *builder) cacheExtra(ctx context.Context, enableHelm bool) []string {
+	extra := []string{
+		fmt.Sprintf("enable-helm=%t", enableHelm),
+		"binary=" + b.binary,
+		"kustomize-version=" + b.kustomizeVersion(ctx),
+	}
+	extra = append(extra, b.pluginArgs()...)
+	return append(extra, b.env...)
+}
+
+// kustomizeVersion returns the output of kustomize version, so an upgrade invalidates the
+// cache. It is read once per builder, empty when it can't be determined.
+func (b *builder) kustomizeVersion(ctx context.Context) string {
+	b.versionOnce.Do(func() {
+		out, err := exec.CommandContext(ctx, b.binary, "version").Output()
+		if err != nil {
+			slog.Debug("Failed to determine the kustomize version", "binary", b.binary, "error", err)
+			return
+		}
+		b.version = strings.TrimSpace(string(out))
+	})
+	return b.version
+}
+
+// checkWarnings fails a successful build that printed warnings when warnings are failures.
+// It runs after the cache so a cached build fails the same way as a fresh one.
+func (b *builder) checkWarnings(result BuildResult) BuildResult {
+	if !b.failOnWarn || !result.Success || len(result.Warnings) == 0 {
+		return result
+	}
+	result.Success = false
+	result.ErrorKind = ErrorKindWarning
+	result.Error = "kustomize printed warnings:\n" + strings.Join(result.Warnings, "\n")
+	return result
+}
+
+// buildWithRetries executes a kustomize build, retrying transient failures with exponential backoff
+func (b *builder) buildWithRetries(ctx context.Context, path string, enableHelm bool) BuildResult {
+	var result BuildResult
+
+	for attempt := 1; ; attempt++ {
+		result = b.build(ctx, path, enableHelm)
+		result.Attempts = attempt
+
+		if result.Success || attempt > b.retries || !IsTransientError(result.Error) {
+			return result
+		}
+
+		delay := b.backoff << (attempt - 1)
+		slog.Warn("Kustomize build failed with a transient error, retrying",
+			"path", path,
+			"attempt", attempt,
+			"retry_in", delay)
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(delay):
+		}
+	}
+}
+
+// sharedHelmCommand returns the helm command kustomize should run so helm uses the shared
+// cache instead of the throw-away home kustomize sets up for every build. It is written once
+// per builder into the helm cache, empty without a helm cache or when it can't be written.
+func (b *builder) sharedHelmCommand() string {
+	if b.helmCache == "" || runtime.GOOS == "windows" {
+		return ""
+	}
+	b.helmCommandOnce.Do(func() {
+		env := append(os.Environ(), helm.CacheHomeEnv+"="+b.helmCache)
+		command, err := helm.WriteCommand(b.helmCache, append(env, b.env...))
+		if err != nil {
+			slog.Warn("Failed to write the helm command, charts are downloaded by every build", "error", err)
+			return
+		}
+		b.helmCommand = command
+	})
+	return b.helmCommand
+}
+
+// build executes a single kustomize build attempt, killing it once the timeout expires or ctx is done
+func (b *builder) build(ctx context.Context, path string, enableHelm bool) BuildResult {
 	start := time.Now()
 
 	args := []string{"build"}
 	if enableHelm {
 		args = append(args, "--enable-helm")
+		if command := b.sharedHelmCommand(); command != "" {
+			args = append(args, "--helm-command", command)
+		}
 	}
+	args = append(args, b.pluginArgs()...)
 	args = append(args, path)
 
 	slog.Debug("Starting kustomize build",
@@ -49,57 +401,294 @@ func (b *builder) Build(path string, enableHelm bool) BuildResult {
 		"enable_helm", enableHelm,
 		"args", args)
 
-	cmd := exec.Command("kustomize", args...)
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	cmd := exec.CommandContext(ctx, b.binary, args...)
+	killProcessGroup(cmd)
+	if len(b.env) > 0 || b.helmCache != "" || b.pluginHome != "" {
+		cmd.Env = os.Environ()
+		if b.helmCache != "" {
+			cmd.Env = append(cmd.Env, helm.CacheHomeEnv+"="+b.helmCache)
+		}
+		if b.pluginHome != "" {
+			cmd.Env = append(cmd.Env, PluginHomeEnv+"="+b.pluginHome)
+		}
+		// Added last so they win over the inherited environment, the helm cache and plugin home
+		cmd.Env = append(cmd.Env, b.env...)
+	}
+	// Don't hang on output pipes held open by orphaned subprocesses after a kill
+	cmd.WaitDelay = waitDelay
 
-	// Set timeout
-	timer := time.AfterFunc(b.timeout, func() {
-		slog.Warn("Kustomize build timeout, killing process", "path", path)
-		_ = cmd.Process.Kill() // Ignore error, process might have already exited
-	})
-	defer timer.Stop()
+	stdout := &limitedBuffer{limit: b.maxOutput}
+	var stderr bytes.Buffer
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
 
 	err := cmd.Run()
 	duration := time.Since(start)
+	maxRSS, userTime, systemTime := resourceUsage(cmd.ProcessState)
 
 	if err != nil {
 		slog.Debug("Kustomize build failed",
 			"path", path,
 			"duration", duration,
 			"error", err)
-		return BuildResult{
-			Path:     path,
-			Success:  false,
-			Output:   stdout.String(),
-			Error:    fmt.Sprintf("%v\n%s", err, stderr.String()),
-			Duration: duration,
+		result := BuildResult{
+			Path:            path,
+			Success:         false,
+			Output:          stdout.String(),
+			OutputTruncated: stdout.truncated,
+			Error:           fmt.Sprintf("%v\n%s", err, stderr.String()),
+			Stderr:          stderr.String(),
+			Duration:        duration,
+			TimedOut:        errors.Is(ctx.Err(), context.DeadlineExceeded),
+			MaxRSS:          maxRSS,
+			UserTime:        userTime,
+			SystemTime:      systemTime,
+			ErrorKind:       ErrorKindTimeout,
+		}
+		if result.TimedOut {
+			slog.Warn("Kustomize build timeout, process was killed", "path", path)
+		} else {
+			result.ErrorKind = ClassifyError(result.Error)
 		}
+		// Helm errors with helm enabled have another cause
+		if result.ErrorKind == ErrorKindHelmNotEnabled && enableHelm {
+			result.ErrorKind = ErrorKindUnknown
+		}
+		return result
 	}
 
 	slog.Debug("Kustomize build succeeded",
 		"path", path,
-		"duration", duration)
+		"duration", duration,
+		"max_rss", maxRSS)
 
 	return BuildResult{
-		Path:     path,
-		Success:  true,
-		Output:   stdout.String(),
-		Error:    "",
-		Duration: duration,
+		Path:            path,
+		Success:         true,
+		Output:          stdout.String(),
+		OutputTruncated: stdout.truncated,
+		Error:           "",
+		Warnings:        ParseWarnings(stderr.String()),
+		Stderr:          stderr.String(),
+		Duration:        duration,
+		MaxRSS:          maxRSS,
+		UserTime:        userTime,
+		SystemTime:      systemTime,
+	}
+}
+
+// pluginArgs returns the build flags enabling plugins
+func (b *builder) pluginArgs() []string {
+	var args []string
+	if b.alphaPlugins {
+		args = append(args, "--enable-alpha-plugins")
+	}
+	if b.enableExec {
+		args = append(args, "--enable-exec")
+	}
+	return args
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the rest, a limit of 0
+// keeps everything. Writes never fail so kustomize isn't killed by a broken pipe.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if l.limit <= 0 {
+		return l.buf.Write(p)
+	}
+	if room := l.limit - l.buf.Len(); len(p) > room {
+		l.buf.Write(p[:max(room, 0)])
+		l.truncated = true
+		return len(p), nil
+	}
+	return l.buf.Write(p)
+}
+
+// String returns the kept output, ending in a marker when it was truncated
+func (l *limitedBuffer) String() string {
+	if !l.truncated {
+		return l.buf.String()
 	}
+	return fmt.Sprintf("%s\n# ... output truncated at %d bytes\n", l.buf.String(), l.limit)
 }
 
-// BuildAll executes builds for all paths
-func (b *builder) BuildAll(paths []string, enableHelm bool) []BuildResult {
-	results := make([]BuildResult, 0, len(paths))
+// transientErrorPatterns are lowercase fragments of errors caused by flaky networking
+// rather than by the kustomization itself
+var transientErrorPatterns = []string{
+	"connection refused",
+	"connection reset",
+	"connection timed out",
+	"no such host",
+	"temporary failure in name resolution",
+	"i/o timeout",
+	"tls handshake timeout",
+	"context deadline exceeded",
+	"unexpected eof",
+	"network is unreachable",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+	"too many requests",
+}
 
-	for _, path := range paths {
-		result := b.Build(path, enableHelm)
-		results = append(results, result)
+// IsTransientError checks if a build error looks like a transient network failure worth retrying
+func IsTransientError(errText string) bool {
+	errText = strings.ToLower(errText)
+	for _, pattern := range transientErrorPatterns {
+		if strings.Contains(errText, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildAll executes builds for all paths, running up to the configured concurrency in parallel.
+// A build starts once the builds of its dependencies finished, ready builds start in the order
+// of paths. Results are returned in the order of paths. Once the deadline of ctx passed no more
+// builds are started, those and the builds it interrupted are returned as skipped. With
+// fail-fast the first failure does the same, the skipped results have FailFast set.
+func (b *builder) BuildAll(ctx context.Context, paths []string, enableHelm bool) []BuildResult {
+	results := make([]BuildResult, len(paths))
+
+	// Cancelling on the first failure stops dispatching and kills the builds in flight
+	buildCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	workers := min(max(b.concurrency, 1), len(paths))
+	jobs := make(chan int)
+	// Buffered so workers never wait on the dispatcher after it stopped
+	done := make(chan int, len(paths))
+
+	var (
+		mu       sync.Mutex
+		started  int
+		finished int
+		wg       sync.WaitGroup
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				mu.Lock()
+				started++
+				if b.progress != nil {
+					b.progress.Started(started, len(paths), paths[i])
+				}
+				mu.Unlock()
+
+				results[i] = b.Build(buildCtx, paths[i], enableHelm)
+
+				mu.Lock()
+				switch {
+				case results[i].Success:
+				case results[i].TimedOut && errors.Is(ctx.Err(), context.DeadlineExceeded):
+					// Killed by the overall deadline, a build that failed on its own keeps its failure
+					results[i] = BuildResult{Path: paths[i], Skipped: true}
+				case errors.Is(context.Cause(buildCtx), errFailFast):
+					// Killed because another build failed first
+					results[i] = BuildResult{Path: paths[i], Skipped: true, FailFast: true}
+				case b.failFast:
+					cancel(errFailFast)
+				}
+				finished++
+				if b.progress != nil {
+					b.progress.Finished(finished, len(paths), results[i])
+				}
+				mu.Unlock()
+				done <- i
+			}
+		}()
+	}
+
+	// Stop dispatching once the deadline of ctx passed or a build failed with fail-fast,
+	// after cancellation the remaining builds are still dispatched and fail immediately
+	waiting, dependents := b.dependencyIndex(paths)
+	var ready []int
+	for i := range paths {
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	dispatched := make([]bool, len(paths))
+	cancelled := buildCtx.Done()
+	for count, running := 0, 0; count < len(paths); {
+		if len(ready) == 0 && running == 0 {
+			// Only builds waiting on each other in a cycle are left, start them in order
+			for i := range paths {
+				if !dispatched[i] {
+					ready = append(ready, i)
+				}
+			}
+		}
+		// A nil channel disables the send while no build is ready
+		var next chan int
+		nextJob := -1
+		if len(ready) > 0 {
+			next, nextJob = jobs, ready[0]
+		}
+		select {
+		case next <- nextJob:
+			dispatched[nextJob] = true
+			ready = ready[1:]
+			count++
+			running++
+			continue
+		case i := <-done:
+			running--
+			for _, dependent := range dependents[i] {
+				if waiting[dependent]--; waiting[dependent] == 0 && !dispatched[dependent] {
+					ready = append(ready, dependent)
+				}
+			}
+			continue
+		case <-cancelled:
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(context.Cause(buildCtx), errFailFast) {
+			break
+		}
+		cancelled = nil
+	}
+	close(jobs)
+	wg.Wait()
+
+	failFast := errors.Is(context.Cause(buildCtx), errFailFast)
+	for i := range paths {
+		if !dispatched[i] {
+			results[i] = BuildResult{Path: paths[i], Skipped: true, FailFast: failFast}
+		}
 	}
 
 	return results
 }
+
+// dependencyIndex returns for each path the number of its dependencies within paths, and the
+// paths depending on each path
+func (b *builder) dependencyIndex(paths []string) ([]int, [][]int) {
+	index := make(map[string]int, len(paths))
+	for i, path := range paths {
+		index[filepath.Clean(path)] = i
+	}
+
+	waiting := make([]int, len(paths))
+	dependents := make([][]int, len(paths))
+	for i, path := range paths {
+		for _, dep := range b.deps[filepath.Clean(path)] {
+			j, ok := index[filepath.Clean(dep)]
+			if !ok || j == i {
+				continue
+			}
+			waiting[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+	return waiting, dependents
+}
@@ -0,0 +1,639 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michielvha/kustomize-build-check/internal/cache"
+)
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name   string
+		errMsg string
+		want   bool
+	}{
+		{"dns failure", "exit status 1\nError: Get \"https://charts.example.com/index.yaml\": dial tcp: lookup charts.example.com: no such host", true},
+		{"connection reset", "exit status 1\nError: read tcp 10.0.0.1:443: read: connection reset by peer", true},
+		{"gateway timeout", "exit status 1\nError: failed to fetch chart: 504 Gateway Timeout", true},
+		{"missing resource", "exit status 1\nError: accumulating resources: accumulation err='accumulating resources from 'missing.yaml': open missing.yaml: no such file or directory'", false},
+		{"yaml syntax", "exit status 1\nError: map[string]interface {}(nil): yaml: line 3: mapping values are not allowed in this context", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransientError(tt.errMsg); got != tt.want {
+				t.Errorf("IsTransientError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildUsesCache(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources: []\n"), 0o644); err != nil {
+		t.Fatalf("failed to write kustomization: %v", err)
+	}
+
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	b := New(WithCache(c)).(*builder)
+	key, err := c.Key(dir, b.cacheExtra(t.Context(), false)...)
+	if err != nil {
+		t.Fatalf("failed to compute key: %v", err)
+	}
+	if err := c.Put(key, cache.Entry{Path: dir, Output: "cached output"}); err != nil {
+		t.Fatalf("failed to seed cache: %v", err)
+	}
+
+	result := b.Build(t.Context(), dir, false)
+	if !result.Success || !result.Cached || result.Output != "cached output" {
+		t.Errorf("expected cached successful result, got %+v", result)
+	}
+}
+
+func TestBuildCachedOutputIsLimited(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources: []\n"), 0o644); err != nil {
+		t.Fatalf("failed to write kustomization: %v", err)
+	}
+
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	// Stored by a run without a limit
+	b := New(WithCache(c), WithMaxOutputBytes(6)).(*builder)
+	key, err := c.Key(dir, b.cacheExtra(t.Context(), false)...)
+	if err != nil {
+		t.Fatalf("failed to compute key: %v", err)
+	}
+	if err := c.Put(key, cache.Entry{Path: dir, Output: "cached output"}); err != nil {
+		t.Fatalf("failed to seed cache: %v", err)
+	}
+
+	result := b.Build(t.Context(), dir, false)
+	if !result.Cached || !result.OutputTruncated || !strings.HasPrefix(result.Output, "cached\n# ... output truncated") {
+		t.Errorf("expected the cached output to be truncated to the limit, got %+v", result)
+	}
+}
+
+func TestBuildCacheKeyedByKustomizeVersion(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kustomize is a shell script")
+	}
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = version ]; then echo \"$FAKE_VERSION\"; exit 0; fi\necho \"kind: ConfigMap\"\necho \"# generated\" >&2\n"
+	if err := os.WriteFile(filepath.Join(binDir, "kustomize"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake kustomize: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources: []\n"), 0o644); err != nil {
+		t.Fatalf("failed to write kustomization: %v", err)
+	}
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	// Each builder reads the version once, like a later run after an upgrade
+	for _, step := range []struct {
+		version string
+		cached  bool
+	}{
+		{version: "v5.4.0", cached: false},
+		{version: "v5.4.0", cached: true},
+		{version: "v5.5.0", cached: false},
+	} {
+		t.Setenv("FAKE_VERSION", step.version)
+		result := New(WithCache(c)).Build(t.Context(), dir, false)
+		if !result.Success || result.Cached != step.cached {
+			t.Errorf("expected cached=%t with kustomize %s, got %+v", step.cached, step.version, result)
+		}
+		// A cached build reports the same stderr as a fresh one
+		if result.Stderr != "# generated\n" {
+			t.Errorf("expected the stderr of the build, got %q", result.Stderr)
+		}
+	}
+}
+
+func TestResourceUsage(t *testing.T) {
+	if maxRSS, userTime, systemTime := resourceUsage(nil); maxRSS != 0 || userTime != 0 || systemTime != 0 {
+		t.Errorf("expected zero usage for a process that never started, got %d %v %v", maxRSS, userTime, systemTime)
+	}
+
+	cmd := exec.Command("go", "version")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("go binary not available: %v", err)
+	}
+
+	maxRSS, _, _ := resourceUsage(cmd.ProcessState)
+	if runtime.GOOS == "linux" && maxRSS <= 0 {
+		t.Errorf("expected peak RSS to be captured on linux, got %d", maxRSS)
+	}
+}
+
+// recordingProgress records progress events for assertions
+type recordingProgress struct {
+	started  []string
+	finished []string
+	counts   []int
+}
+
+func (p *recordingProgress) Started(started, total int, path string) {
+	p.started = append(p.started, path)
+	p.counts = append(p.counts, started)
+}
+
+func (p *recordingProgress) Finished(finished, total int, result BuildResult) {
+	p.finished = append(p.finished, result.Path)
+}
+
+func TestBuildAllReportsProgress(t *testing.T) {
+	// Point PATH at an empty directory so builds fail fast without running kustomize
+	t.Setenv("PATH", t.TempDir())
+
+	paths := []string{"overlays/dev", "overlays/staging", "overlays/prod"}
+
+	for _, concurrency := range []int{1, 3} {
+		progress := &recordingProgress{}
+		results := New(WithConcurrency(concurrency), WithProgress(progress)).BuildAll(t.Context(), paths, false)
+
+		for i, result := range results {
+			if result.Path != paths[i] || result.Success {
+				t.Errorf("concurrency %d: result %d = %+v, want failed build of %s", concurrency, i, result, paths[i])
+			}
+			if result.ErrorKind != ErrorKindExecNotFound {
+				t.Errorf("concurrency %d: expected exec-not-found error kind, got %q", concurrency, result.ErrorKind)
+			}
+		}
+		if len(progress.started) != len(paths) || len(progress.finished) != len(paths) {
+			t.Errorf("concurrency %d: expected %d start and finish events, got %d and %d",
+				concurrency, len(paths), len(progress.started), len(progress.finished))
+		}
+		if !slices.Equal(progress.counts, []int{1, 2, 3}) {
+			t.Errorf("concurrency %d: expected started counts 1..3, got %v", concurrency, progress.counts)
+		}
+		if concurrency == 1 && !slices.Equal(progress.started, paths) {
+			t.Errorf("sequential builds should start in order, got %v", progress.started)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name   string
+		errMsg string
+		want   ErrorKind
+	}{
+		{"missing resource", "exit status 1\nError: accumulating resources: accumulation err='accumulating resources from 'missing.yaml': evalsymlink failure on '/repo/app/missing.yaml' : lstat /repo/app/missing.yaml: no such file or directory'", ErrorKindMissingResource},
+		{"missing kustomization", "exit status 1\nError: unable to find one of 'kustomization.yaml', 'kustomization.yml' or 'Kustomization' in directory '/repo/app'", ErrorKindMissingResource},
+		{"yaml syntax", "exit status 1\nError: map[string]interface {}(nil): yaml: line 3: mapping values are not allowed in this context", ErrorKindYAMLSyntax},
+		{"yaml to json", "exit status 1\nError: error converting YAML to JSON: yaml: line 7: did not find expected key", ErrorKindYAMLSyntax},
+		{"helm not enabled", "exit status 1\nError: trouble configuring builtin HelmChartInflationGenerator with config: `\nname: nginx\n`: must specify --enable-helm", ErrorKindHelmNotEnabled},
+		{"kustomize missing", `exec: "kustomize": executable file not found in $PATH`, ErrorKindExecNotFound},
+		{"unrecognized", "exit status 1\nError: something unexpected happened", ErrorKindUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.errMsg); got != tt.want {
+				t.Errorf("ClassifyError() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	stderr := "# Warning: 'bases' is deprecated. Please use 'resources' instead. Run 'kustomize edit fix' to update your Kustomization automatically.\n" +
+		"# Warning: 'patchesStrategicMerge' is deprecated. Please use 'patches' instead. Run 'kustomize edit fix' to update your Kustomization automatically.\n" +
+		"\n" +
+		"walking plugin directory /home/runner/.config/kustomize/plugin\n"
+
+	got := ParseWarnings(stderr)
+	want := []string{
+		"# Warning: 'bases' is deprecated. Please use 'resources' instead. Run 'kustomize edit fix' to update your Kustomization automatically.",
+		"# Warning: 'patchesStrategicMerge' is deprecated. Please use 'patches' instead. Run 'kustomize edit fix' to update your Kustomization automatically.",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseWarnings() = %q, want %q", got, want)
+	}
+
+	if got := ParseWarnings(""); got != nil {
+		t.Errorf("expected no warnings for empty stderr, got %q", got)
+	}
+}
+
+func TestBuildFailOnWarning(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kustomize is a shell script")
+	}
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\necho \"# Warning: 'bases' is deprecated. Please use 'resources' instead.\" >&2\necho 'kind: ConfigMap'\n"
+	if err := os.WriteFile(filepath.Join(binDir, "kustomize"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake kustomize: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	result := New().Build(t.Context(), "overlays/dev", false)
+	if !result.Success || len(result.Warnings) != 1 {
+		t.Fatalf("expected a successful build with one warning, got %+v", result)
+	}
+
+	result = New(WithFailOnWarning(true)).Build(t.Context(), "overlays/dev", false)
+	if result.Success || result.ErrorKind != ErrorKindWarning || !strings.Contains(result.Error, "'bases' is deprecated") {
+		t.Errorf("expected the warning to fail the build, got %+v", result)
+	}
+
+	// Cached builds keep their warnings and fail the same way
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("bases: []\n"), 0o644); err != nil {
+		t.Fatalf("failed to write kustomization: %v", err)
+	}
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	New(WithCache(c)).Build(t.Context(), dir, false)
+	result = New(WithCache(c), WithFailOnWarning(true)).Build(t.Context(), dir, false)
+	if !result.Cached || result.Success || result.ErrorKind != ErrorKindWarning {
+		t.Errorf("expected the cached warning to fail the build, got %+v", result)
+	}
+}
+
+func TestBuildCapturesStderrOnSuccess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kustomize is a shell script")
+	}
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\necho 'walking plugin directory' >&2\necho 'kind: ConfigMap'\n"
+	if err := os.WriteFile(filepath.Join(binDir, "kustomize"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake kustomize: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	result := New().Build(t.Context(), "overlays/dev", false)
+	if !result.Success {
+		t.Fatalf("build failed: %s", result.Error)
+	}
+	if result.Stderr != "walking plugin directory\n" || result.Output != "kind: ConfigMap\n" {
+		t.Errorf("expected stderr to be captured apart from the output, got stderr %q and output %q", result.Stderr, result.Output)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("expected no warnings, got %q", result.Warnings)
+	}
+}
+
+func TestBuildAllCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	results := New().BuildAll(ctx, []string{"overlays/dev", "overlays/prod"}, false)
+	for _, result := range results {
+		if result.Success || result.TimedOut {
+			t.Errorf("expected %s to fail without timing out after cancellation, got %+v", result.Path, result)
+		}
+	}
+}
+
+func TestBuildEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kustomize is a shell script")
+	}
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\necho \"token=$API_TOKEN home=${HOME:+set}\"\n"
+	if err := os.WriteFile(filepath.Join(binDir, "kustomize"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake kustomize: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("HOME", t.TempDir())
+
+	result := New(WithEnv([]string{"API_TOKEN=s3cr3t"})).Build(t.Context(), "overlays/dev", false)
+	if !result.Success {
+		t.Fatalf("build failed: %s", result.Error)
+	}
+	if result.Output != "token=s3cr3t home=set\n" {
+		t.Errorf("expected the build env on top of the inherited environment, got %q", result.Output)
+	}
+}
+
+func TestBuildPluginFlags(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kustomize is a shell script")
+	}
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\necho \"$* home=$KUSTOMIZE_PLUGIN_HOME\"\n"
+	if err := os.WriteFile(filepath.Join(binDir, "kustomize"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake kustomize: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv(PluginHomeEnv, "")
+
+	result := New().Build(t.Context(), "overlays/dev", false)
+	if result.Output != "build overlays/dev home=\n" {
+		t.Errorf("expected no plugin flags by default, got %q", result.Output)
+	}
+
+	result = New(WithAlphaPlugins(true), WithExec(true), WithPluginHome("/plugins")).Build(t.Context(), "overlays/dev", true)
+	if result.Output != "build --enable-helm --enable-alpha-plugins --enable-exec overlays/dev home=/plugins\n" {
+		t.Errorf("expected the plugin flags and home, got %q", result.Output)
+	}
+}
+
+func TestCheckBinary(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	err := New().CheckBinary()
+	if !errors.Is(err, ErrKustomizeNotFound) {
+		t.Errorf("expected ErrKustomizeNotFound with kustomize missing from PATH, got %v", err)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	binary := filepath.Join(t.TempDir(), "kustomize-v5")
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("failed to write fake kustomize: %v", err)
+	}
+	if err := New(WithBinary(binary)).CheckBinary(); err != nil {
+		t.Errorf("expected the configured binary to be found, got %v", err)
+	}
+}
+
+func TestBuildHelmCacheDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kustomize is a shell script")
+	}
+
+	// The fake kustomize runs its --helm-command with a throw-away home like kustomize does,
+	// the fake helm prints the cache it sees
+	binDir := t.TempDir()
+	kustomize := "#!/bin/sh\nwhile [ $# -gt 0 ] && [ \"$1\" != --helm-command ]; do shift; done\nHELM_CACHE_HOME=/tmp/throw-away exec \"$2\"\n"
+	if err := os.WriteFile(filepath.Join(binDir, "kustomize"), []byte(kustomize), 0o755); err != nil {
+		t.Fatalf("failed to write fake kustomize: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(binDir, "helm"), []byte("#!/bin/sh\necho \"$HELM_CACHE_HOME\"\n"), 0o755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cacheDir := t.TempDir()
+	result := New(WithHelmCacheDir(cacheDir)).Build(t.Context(), "overlays/dev", true)
+	if result.Output != cacheDir+"\n" {
+		t.Errorf("expected the shared helm cache, got %q (%s)", result.Output, result.Error)
+	}
+
+	result = New(WithHelmCacheDir(t.TempDir()), WithEnv([]string{"HELM_CACHE_HOME=/custom"})).Build(t.Context(), "overlays/dev", true)
+	if result.Output != "/custom\n" {
+		t.Errorf("expected build-env to override the helm cache, got %q (%s)", result.Output, result.Error)
+	}
+}
+
+func TestBuildHelmCacheDirWithKustomize(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm is a shell script")
+	}
+	if _, err := exec.LookPath("kustomize"); err != nil {
+		t.Skip("kustomize not installed")
+	}
+
+	// A fake helm records the cache it is run with by the real kustomize
+	binDir := t.TempDir()
+	logFile := filepath.Join(t.TempDir(), "helm.log")
+	script := "#!/bin/sh\necho \"$HELM_CACHE_HOME\" >> " + logFile + "\n" +
+		"case \"$1\" in version) echo v3.16.2;; template) printf 'apiVersion: v1\\nkind: ConfigMap\\nmetadata:\\n  name: demo\\n';; esac\n"
+	if err := os.WriteFile(filepath.Join(binDir, "helm"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// The chart is in the chart home already, so kustomize only templates it
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"kustomization.yaml":     "helmCharts:\n  - name: demo\n    releaseName: demo\n",
+		"charts/demo/Chart.yaml": "apiVersion: v2\nname: demo\nversion: 0.1.0\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	cacheDir := t.TempDir()
+	result := New(WithHelmCacheDir(cacheDir)).Build(t.Context(), dir, true)
+	if !result.Success {
+		t.Fatalf("expected the build to succeed: %s", result.Error)
+	}
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("expected kustomize to run helm: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line != cacheDir {
+			t.Errorf("expected kustomize to run helm with the shared cache %s, got %s", cacheDir, line)
+		}
+	}
+}
+
+func TestBuildMaxOutputBytes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kustomize is a shell script")
+	}
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\nhead -c 100000 /dev/zero | tr '\\0' 'a'\n"
+	if err := os.WriteFile(filepath.Join(binDir, "kustomize"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake kustomize: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	result := New(WithMaxOutputBytes(1000)).Build(t.Context(), "overlays/dev", false)
+	if !result.Success {
+		t.Fatalf("expected an oversized output not to fail the build: %s", result.Error)
+	}
+	if !result.OutputTruncated || !strings.HasPrefix(result.Output, strings.Repeat("a", 1000)+"\n# ... output truncated") {
+		t.Errorf("expected the output to be truncated at 1000 bytes, got %d bytes", len(result.Output))
+	}
+
+	result = New().Build(t.Context(), "overlays/dev", false)
+	if result.OutputTruncated || len(result.Output) != 100000 {
+		t.Errorf("expected the full output without a limit, got %d bytes", len(result.Output))
+	}
+}
+
+func TestBuildAllDeadline(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kustomize is a shell script")
+	}
+
+	// flaky fails with a transient error and then waits out the retry backoff,
+	// block runs until it is killed
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$2\" in *flaky*) echo connection refused >&2; exit 1;; *block*) exec tail -f /dev/null;; esac\n"
+	if err := os.WriteFile(filepath.Join(binDir, "kustomize"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake kustomize: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+
+	b := New(WithConcurrency(2), WithRetries(1)).(*builder)
+	b.backoff = time.Hour
+	paths := []string{"overlays/a", "overlays/flaky", "overlays/block", "overlays/d"}
+	results := b.BuildAll(ctx, paths, false)
+
+	if !results[0].Success {
+		t.Errorf("expected the first build to finish within the deadline, got %+v", results[0])
+	}
+	// The failure returned after the deadline passed is still a failure
+	if results[1].Skipped || results[1].TimedOut || !strings.Contains(results[1].Error, "connection refused") {
+		t.Errorf("expected the flaky build to keep its failure, got %+v", results[1])
+	}
+	// block is interrupted and d never starts
+	for _, result := range results[2:] {
+		if !result.Skipped || result.Success || result.Error != "" {
+			t.Errorf("expected %s to be skipped, got %+v", result.Path, result)
+		}
+	}
+	for i, result := range results {
+		if result.Path != paths[i] {
+			t.Errorf("expected result %d for %s, got %s", i, paths[i], result.Path)
+		}
+	}
+}
+
+func TestBuildAllFailFast(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kustomize is a shell script")
+	}
+
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$2\" in *bad*) echo broken >&2; exit 1;; *slow*) sleep 5;; esac\n"
+	if err := os.WriteFile(filepath.Join(binDir, "kustomize"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake kustomize: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// Without fail-fast everything is built
+	results := New().BuildAll(t.Context(), []string{"overlays/bad", "overlays/a"}, false)
+	if results[0].Success || !results[1].Success {
+		t.Errorf("expected only the bad build to fail, got %+v", results)
+	}
+
+	// The build in flight is killed and the one not started yet is skipped
+	start := time.Now()
+	paths := []string{"overlays/slow", "overlays/bad", "overlays/b"}
+	results = New(WithFailFast(true), WithConcurrency(2)).BuildAll(t.Context(), paths, false)
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("expected the slow build to be killed, took %s", elapsed)
+	}
+	if results[1].Success || results[1].Skipped || !strings.Contains(results[1].Error, "broken") {
+		t.Errorf("expected the first failure to be reported, got %+v", results[1])
+	}
+	for _, i := range []int{0, 2} {
+		if !results[i].Skipped || !results[i].FailFast || results[i].Path != paths[i] {
+			t.Errorf("expected %s to be skipped by fail-fast, got %+v", paths[i], results[i])
+		}
+	}
+}
+
+func TestBuildAllDependencies(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kustomize is a shell script")
+	}
+
+	binDir := t.TempDir()
+	logFile := filepath.Join(t.TempDir(), "builds.log")
+	script := "#!/bin/sh\necho \"start $2\" >> " + logFile + "\ncase \"$2\" in *bad*) exit 1;; esac\nsleep 0.2\necho \"end $2\" >> " + logFile + "\n"
+	if err := os.WriteFile(filepath.Join(binDir, "kustomize"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake kustomize: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	readLog := func() []string {
+		t.Helper()
+		data, err := os.ReadFile(logFile)
+		if err != nil {
+			t.Fatalf("failed to read build log: %v", err)
+		}
+		os.Remove(logFile)
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	// overlays/dev -> mid -> base, app has no dependencies
+	paths := []string{"overlays/dev", "mid", "base", "app"}
+	deps := map[string][]string{
+		"overlays/dev": {"mid", "base"},
+		"mid":          {"base"},
+	}
+
+	// Sequential builds run in dependency order, ready builds in the order of paths
+	results := New(WithDependencies(deps)).BuildAll(t.Context(), paths, false)
+	for i, result := range results {
+		if !result.Success || result.Path != paths[i] {
+			t.Errorf("expected results in the order of paths, got %+v", results)
+		}
+	}
+	var starts []string
+	for _, line := range readLog() {
+		if path, ok := strings.CutPrefix(line, "start "); ok {
+			starts = append(starts, path)
+		}
+	}
+	if want := []string{"base", "app", "mid", "overlays/dev"}; !slices.Equal(starts, want) {
+		t.Errorf("build order = %v, want %v", starts, want)
+	}
+
+	// Concurrent builds only start after their dependencies finished
+	New(WithDependencies(deps), WithConcurrency(4)).BuildAll(t.Context(), paths, false)
+	log := readLog()
+	for path, pathDeps := range deps {
+		for _, dep := range pathDeps {
+			if slices.Index(log, "end "+dep) > slices.Index(log, "start "+path) {
+				t.Errorf("expected %s to start after %s finished, got %v", path, dep, log)
+			}
+		}
+	}
+	if slices.Index(log, "start app") > slices.Index(log, "end base") {
+		t.Errorf("expected app to build alongside base, got %v", log)
+	}
+
+	// A broken base fails fast before the overlays using it are started
+	paths = []string{"overlays/dev", "mid", "bad"}
+	deps = map[string][]string{"overlays/dev": {"mid"}, "mid": {"bad"}}
+	results = New(WithDependencies(deps), WithConcurrency(4), WithFailFast(true)).BuildAll(t.Context(), paths, false)
+	if results[2].Success || results[2].Skipped {
+		t.Errorf("expected the base to fail, got %+v", results[2])
+	}
+	for _, result := range results[:2] {
+		if !result.Skipped || !result.FailFast {
+			t.Errorf("expected %s to be skipped by fail-fast, got %+v", result.Path, result)
+		}
+	}
+	if log := readLog(); !slices.Equal(log, []string{"start bad"}) {
+		t.Errorf("expected only the base to be built, got %v", log)
+	}
+}
@@ -0,0 +1,37 @@
+package builder
+
+import "regexp"
+
+// ErrorKind is the category of a failed build, derived from the kustomize error output
+type ErrorKind string
+
+const (
+	ErrorKindMissingResource ErrorKind = "missing-resource"
+	ErrorKindYAMLSyntax      ErrorKind = "yaml-syntax"
+	ErrorKindHelmNotEnabled  ErrorKind = "helm-not-enabled"
+	ErrorKindTimeout         ErrorKind = "timeout"
+	ErrorKindExecNotFound    ErrorKind = "exec-not-found"
+	ErrorKindWarning         ErrorKind = "warning"
+	ErrorKindUnknown         ErrorKind = "unknown"
+)
+
+// errorKindPatterns map kustomize error messages to their kind, the first match wins
+var errorKindPatterns = []struct {
+	kind    ErrorKind
+	pattern *regexp.Regexp
+}{
+	{ErrorKindExecNotFound, regexp.MustCompile(`executable file not found|exec: "kustomize": `)},
+	{ErrorKindHelmNotEnabled, regexp.MustCompile(`(?i)--enable-helm|helmCharts.*not allowed`)},
+	{ErrorKindYAMLSyntax, regexp.MustCompile(`(?i)yaml: (line \d+|unmarshal errors|mapping values|did not find expected|found character)|error converting YAML to JSON|MalformedYAMLError`)},
+	{ErrorKindMissingResource, regexp.MustCompile(`(?i)no such file or directory|evalsymlink failure|must resolve to a file|unable to find one of|must build at directory|not a valid directory`)},
+}
+
+// ClassifyError derives the ErrorKind of a failed build from its error output
+func ClassifyError(errText string) ErrorKind {
+	for _, p := range errorKindPatterns {
+		if p.pattern.MatchString(errText) {
+			return p.kind
+		}
+	}
+	return ErrorKindUnknown
+}
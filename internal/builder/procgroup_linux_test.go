@@ -0,0 +1,63 @@
+//go:build linux
+
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// processAlive checks if pid is running, treating zombies awaiting a reaper as dead
+func processAlive(pid int) bool {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesized command name
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestBuildTimeoutKillsProcessGroup(t *testing.T) {
+	binDir := t.TempDir()
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+
+	// A fake kustomize that spawns a long-running subprocess, like helm
+	script := "#!/bin/sh\nsleep 30 &\necho $! > " + pidFile + "\nwait\n"
+	if err := os.WriteFile(filepath.Join(binDir, "kustomize"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake kustomize: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	start := time.Now()
+	result := New(WithTimeout(500*time.Millisecond)).Build(t.Context(), "overlays/dev", false)
+
+	if !result.TimedOut || result.ErrorKind != ErrorKindTimeout {
+		t.Errorf("expected the build to time out, got %+v", result)
+	}
+	if elapsed := time.Since(start); elapsed > waitDelay {
+		t.Errorf("build took %v, expected it to be killed shortly after the timeout", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("fake kustomize did not record its subprocess: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("invalid pid %q: %v", data, err)
+	}
+
+	// Give the kernel a moment to deliver the signal
+	deadline := time.Now().Add(2 * time.Second)
+	for processAlive(pid) && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if processAlive(pid) {
+		t.Errorf("subprocess %d outlived the timed out build", pid)
+	}
+}
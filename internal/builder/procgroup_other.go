@@ -0,0 +1,8 @@
+//go:build !unix
+
+package builder
+
+import "os/exec"
+
+// killProcessGroup is a no-op without process groups, cancellation only kills kustomize itself
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package builder
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup runs cmd in its own process group and kills the whole group on cancellation,
+// so helm subprocesses spawned by kustomize don't outlive a timed out build
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		// A negative pid signals every process in the group
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build linux
+
+package builder
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// resourceUsage returns the peak RSS in bytes and the CPU time of an exited process
+func resourceUsage(state *os.ProcessState) (maxRSS int64, userTime, systemTime time.Duration) {
+	if state == nil {
+		return 0, 0, 0
+	}
+
+	// Linux reports ru_maxrss in kilobytes
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		maxRSS = rusage.Maxrss * 1024
+	}
+
+	return maxRSS, state.UserTime(), state.SystemTime()
+}
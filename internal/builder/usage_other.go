@@ -0,0 +1,17 @@
+//go:build !linux
+
+package builder
+
+import (
+	"os"
+	"time"
+)
+
+// resourceUsage returns the CPU time of an exited process, peak RSS is only captured on Linux
+func resourceUsage(state *os.ProcessState) (maxRSS int64, userTime, systemTime time.Duration) {
+	if state == nil {
+		return 0, 0, 0
+	}
+
+	return 0, state.UserTime(), state.SystemTime()
+}
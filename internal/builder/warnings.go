@@ -0,0 +1,22 @@
+package builder
+
+import (
+	"regexp"
+	"strings"
+)
+
+// warningPattern matches the warnings kustomize prints on stderr, e.g. the
+// "# Warning: 'bases' is deprecated" notices for fields that `kustomize edit fix` migrates
+var warningPattern = regexp.MustCompile(`(?i)\bwarn(ing)?\b|\bdeprecat(ed|ion)\b`)
+
+// ParseWarnings returns the lines of the stderr of a build that are warnings, trimmed
+func ParseWarnings(stderr string) []string {
+	var warnings []string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && warningPattern.MatchString(line) {
+			warnings = append(warnings, line)
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/michielvha/kustomize-build-check/internal/discovery"
+)
+
+// Entry is a cached successful build
+type Entry struct {
+	Path      string    `json:"path"`
+	Output    string    `json:"output"`
+	Warnings  []string  `json:"warnings,omitempty"`
+	Stderr    string    `json:"stderr,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Cache stores successful build results keyed by a hash of their inputs
+type Cache interface {
+	Key(path string, extra ...string) (string, error)
+	Get(key string) (*Entry, bool)
+	Put(key string, entry Entry) error
+}
+
+type fileCache struct {
+	dir string
+}
+
+// New creates a filesystem-backed Cache storing entries in dir
+func New(dir string) (Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &fileCache{dir: dir}, nil
+}
+
+// Key computes a content hash over all inputs of the kustomization in path,
+// following local resources, bases and components transitively.
+// Extra values (e.g. build flags) are mixed into the key.
+func (c *fileCache) Key(path string, extra ...string) (string, error) {
+	return HashInputs(path, extra...)
+}
+
+// Get returns the cached entry for key, if any
+func (c *fileCache) Get(key string) (*Entry, bool) {
+	data, err := os.ReadFile(c.entryPath(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		slog.Debug("Ignoring corrupt cache entry", "key", key, "error", err)
+		return nil, false
+	}
+
+	return &entry, true
+}
+
+// Put stores an entry under key
+func (c *fileCache) Put(key string, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	// Write to a temporary file first so concurrent readers never see a partial entry
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), c.entryPath(key)); err != nil {
+		return fmt.Errorf("failed to store cache entry: %w", err)
+	}
+
+	return nil
+}
+
+func (c *fileCache) entryPath(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// HashInputs computes a content hash over every file the kustomization in dir can read:
+// all files below the kustomization directory plus, transitively, every local resource,
+// base, component, patch, generator and transformer it references. Remote references are hashed by their (pinned) URL.
+func HashInputs(dir string, extra ...string) (string, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	h := &inputHasher{
+		root:    root,
+		visited: make(map[string]bool),
+		files:   make(map[string]string),
+	}
+	if err := h.addKustomization(root); err != nil {
+		return "", err
+	}
+
+	// Hash in a stable order, using paths relative to the root so the key
+	// doesn't depend on where the repository is checked out
+	names := make([]string, 0, len(h.files))
+	for name := range h.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sum := sha256.New()
+	for _, value := range extra {
+		fmt.Fprintf(sum, "extra\x00%s\x00", value)
+	}
+	sort.Strings(h.remotes)
+	for _, remote := range h.remotes {
+		fmt.Fprintf(sum, "remote\x00%s\x00", remote)
+	}
+	for _, name := range names {
+		fmt.Fprintf(sum, "file\x00%s\x00%s\x00", name, h.files[name])
+	}
+
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+type inputHasher struct {
+	root    string
+	visited map[string]bool
+	files   map[string]string // relative path -> content hash
+	remotes []string
+}
+
+// addKustomization hashes a kustomization directory and follows its references
+func (h *inputHasher) addKustomization(dir string) error {
+	if h.visited[dir] {
+		return nil
+	}
+	h.visited[dir] = true
+
+	if err := h.addTree(dir); err != nil {
+		return err
+	}
+
+	kustomizationPath, err := discovery.FindKustomizationFile(dir)
+	if err != nil {
+		// Plain directory of manifests, already hashed above
+		return nil
+	}
+
+	kf, err := discovery.New().ParseKustomization(kustomizationPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", kustomizationPath, err)
+	}
+
+	refs := append(append(append([]string{}, kf.Resources...), kf.Bases...), kf.Components...)
+	refs = append(append(refs, kf.Patches...), kf.GeneratorFiles...)
+	refs = append(append(refs, kf.Transformers...), kf.Generators...)
+	refs = append(append(refs, kf.SchemaFiles...), kf.HelmValues...)
+	for _, ref := range refs {
+		if discovery.IsRemoteRef(ref) {
+			h.remotes = append(h.remotes, ref)
+			continue
+		}
+
+		refPath := filepath.Clean(filepath.Join(dir, ref))
+		info, err := os.Stat(refPath)
+		if err != nil {
+			// Dangling reference, kustomize build will report it
+			h.files[h.rel(refPath)] = "missing"
+			continue
+		}
+
+		if info.IsDir() {
+			if err := h.addKustomization(refPath); err != nil {
+				return err
+			}
+		} else if err := h.addFile(refPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addTree hashes all regular files below dir
+func (h *inputHasher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		return h.addFile(path)
+	})
+}
+
+// addFile hashes the content of a single file
+func (h *inputHasher) addFile(path string) error {
+	name := h.rel(path)
+	if _, done := h.files[name]; done {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	h.files[name] = hex.EncodeToString(sum.Sum(nil))
+	return nil
+}
+
+// rel returns path relative to the hashed kustomization, falling back to the absolute path
+func (h *inputHasher) rel(path string) string {
+	if rel, err := filepath.Rel(h.root, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
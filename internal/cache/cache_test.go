@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestHashInputsTransitive(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "base", "kustomization.yaml"), "resources:\n  - deployment.yaml\n")
+	writeFile(t, filepath.Join(root, "base", "deployment.yaml"), "kind: Deployment\n")
+	writeFile(t, filepath.Join(root, "shared", "configmap.yaml"), "kind: ConfigMap\n")
+	writeFile(t, filepath.Join(root, "unrelated", "service.yaml"), "kind: Service\n")
+	writeFile(t, filepath.Join(root, "overlay", "kustomization.yaml"), "resources:\n  - ../base\n  - ../shared/configmap.yaml\n")
+
+	overlay := filepath.Join(root, "overlay")
+	key1, err := HashInputs(overlay)
+	if err != nil {
+		t.Fatalf("HashInputs failed: %v", err)
+	}
+
+	// Unrelated changes keep the key
+	writeFile(t, filepath.Join(root, "unrelated", "service.yaml"), "kind: Service\nmetadata: {}\n")
+	if key2, _ := HashInputs(overlay); key2 != key1 {
+		t.Error("expected key to be unchanged by unrelated files")
+	}
+
+	// A change in the base invalidates the overlay
+	writeFile(t, filepath.Join(root, "base", "deployment.yaml"), "kind: Deployment\nmetadata: {}\n")
+	key3, _ := HashInputs(overlay)
+	if key3 == key1 {
+		t.Error("expected key to change when a transitive base file changes")
+	}
+
+	// A change in a referenced file outside the overlay invalidates it
+	writeFile(t, filepath.Join(root, "shared", "configmap.yaml"), "kind: ConfigMap\ndata: {}\n")
+	if key4, _ := HashInputs(overlay); key4 == key3 {
+		t.Error("expected key to change when a referenced file changes")
+	}
+
+	// Build flags are part of the key
+	if key5, _ := HashInputs(overlay, "--enable-helm"); key5 == key1 {
+		t.Error("expected extra values to change the key")
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	c, err := New(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if _, ok := c.Get("missing"); ok {
+		t.Error("expected cache miss")
+	}
+
+	if err := c.Put("abc", Entry{Path: "/repo/overlay", Output: "kind: Deployment\n"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	entry, ok := c.Get("abc")
+	if !ok || entry.Path != "/repo/overlay" || entry.Output != "kind: Deployment\n" {
+		t.Errorf("unexpected cache entry: %+v", entry)
+	}
+}
@@ -0,0 +1,139 @@
+package differ
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/michielvha/kustomize-build-check/internal/builder"
+	"github.com/michielvha/kustomize-build-check/internal/git"
+)
+
+// Result is the diff of a kustomization's rendered output between the base revision and HEAD
+type Result struct {
+	Path string
+	// Diff is a unified diff of the rendered YAML, empty when the output is unchanged
+	Diff string
+	// Error is set when the diff could not be produced
+	Error string
+	// New is set when the kustomization does not exist or build at the base revision
+	New bool
+}
+
+// Differ renders kustomizations at a base revision and diffs them against the current output
+type Differ interface {
+	Diff(ctx context.Context, baseRef string, results []builder.BuildResult, enableHelm bool) ([]Result, error)
+}
+
+// errTruncated is reported instead of a diff of output cut off at max-output-bytes
+const errTruncated = "output truncated, diff unavailable"
+
+type differ struct {
+	builder builder.Builder
+}
+
+// New creates a Differ that renders the base revision with b
+func New(b builder.Builder) Differ {
+	return &differ{builder: b}
+}
+
+// Diff builds each successfully built kustomization at baseRef in a temporary worktree
+// and diffs its rendered output against the current output. Failed builds are left out.
+func (d *differ) Diff(ctx context.Context, baseRef string, results []builder.BuildResult, enableHelm bool) ([]Result, error) {
+	topLevel, err := git.TopLevel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	worktree, cleanup, err := git.Worktree(ctx, baseRef)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var diffs []Result
+	for _, result := range results {
+		if !result.Success {
+			continue
+		}
+		diffs = append(diffs, d.diffOne(ctx, topLevel, worktree, result, enableHelm))
+	}
+
+	return diffs, nil
+}
+
+// diffOne renders a single kustomization in the worktree and diffs it against result
+func (d *differ) diffOne(ctx context.Context, topLevel, worktree string, result builder.BuildResult, enableHelm bool) Result {
+	diff := Result{Path: result.Path}
+	// The cut-off tail would show up as removed or added
+	if result.OutputTruncated {
+		diff.Error = errTruncated
+		return diff
+	}
+
+	rel, err := git.RepoRelative(topLevel, result.Path)
+	if err != nil {
+		diff.Error = err.Error()
+		return diff
+	}
+
+	// A kustomization that doesn't exist or build at the base is diffed against empty output
+	var baseOutput string
+	baseDir := filepath.Join(worktree, rel)
+	if _, err := os.Stat(baseDir); err != nil {
+		diff.New = true
+	} else if base := d.builder.Build(ctx, baseDir, enableHelm); base.Success {
+		if base.OutputTruncated {
+			diff.Error = errTruncated
+			return diff
+		}
+		baseOutput = base.Output
+	} else {
+		slog.Debug("Kustomization does not build at the base revision", "path", result.Path, "error", base.Error)
+		diff.New = true
+	}
+
+	text, err := unifiedDiff(ctx, filepath.ToSlash(rel), baseOutput, result.Output)
+	if err != nil {
+		diff.Error = err.Error()
+		return diff
+	}
+	diff.Diff = text
+
+	return diff
+}
+
+// unifiedDiff returns a unified diff between the rendered old and new output of name
+func unifiedDiff(ctx context.Context, name, oldOutput, newOutput string) (string, error) {
+	if oldOutput == newOutput {
+		return "", nil
+	}
+
+	dir, err := os.MkdirTemp("", "kustomize-build-check-diff-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create diff directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "old"), []byte(oldOutput), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write base output: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new"), []byte(newOutput), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write current output: %w", err)
+	}
+
+	out, err := git.DiffFiles(ctx, filepath.Join(dir, "old"), filepath.Join(dir, "new"))
+	if err != nil {
+		return "", fmt.Errorf("failed to diff rendered output: %w", err)
+	}
+
+	// Replace git's header with one naming the kustomization
+	hunks := out
+	if i := strings.Index(out, "\n@@"); i >= 0 {
+		hunks = out[i+1:]
+	}
+	return fmt.Sprintf("--- a/%s\n+++ b/%s\n%s", name, name, hunks), nil
+}
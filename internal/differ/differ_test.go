@@ -0,0 +1,87 @@
+package differ
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/michielvha/kustomize-build-check/internal/testutil"
+)
+
+func TestDiff(t *testing.T) {
+	repo := testutil.InitRepo(t)
+	testutil.CommitFile(t, repo, "app/output.yaml", "---\nreplicas: 1\n")
+	testutil.CommitFile(t, repo, "same/output.yaml", "kind: ConfigMap\n")
+	testutil.CommitFile(t, repo, "app/output.yaml", "replicas: 2\n")
+	testutil.CommitFile(t, repo, "new/output.yaml", "kind: Service\n")
+	t.Chdir(repo)
+
+	b := testutil.Builder{OutputFile: "output.yaml"}
+	results := b.BuildAll(t.Context(), []string{
+		filepath.Join(repo, "app"),
+		filepath.Join(repo, "same"),
+		filepath.Join(repo, "new"),
+		filepath.Join(repo, "missing"),
+	}, false)
+
+	diffs, err := New(b).Diff(t.Context(), "HEAD~2", results, false)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	if len(diffs) != 3 {
+		t.Fatalf("expected 3 diffs for the successful builds, got %+v", diffs)
+	}
+
+	app := diffs[0]
+	if app.New || !strings.HasPrefix(app.Diff, "--- a/app\n+++ b/app\n@@") {
+		t.Errorf("expected a diff of app with its own header, got %+v", app)
+	}
+	for _, line := range []string{"\n----\n", "\n-replicas: 1\n", "\n+replicas: 2\n"} {
+		if !strings.Contains(app.Diff, line) {
+			t.Errorf("expected app diff to contain %q, got:\n%s", line, app.Diff)
+		}
+	}
+
+	if diffs[1].Diff != "" || diffs[1].Error != "" {
+		t.Errorf("expected no diff for unchanged output, got %+v", diffs[1])
+	}
+
+	if !diffs[2].New || !strings.Contains(diffs[2].Diff, "+kind: Service") {
+		t.Errorf("expected new kustomization to be diffed against empty output, got %+v", diffs[2])
+	}
+
+	if worktrees := testutil.GitCmd(t, repo, "worktree", "list"); strings.Count(worktrees, "\n") != 1 {
+		t.Errorf("expected the base worktree to be removed, got:\n%s", worktrees)
+	}
+}
+
+func TestDiffTruncatedOutput(t *testing.T) {
+	repo := testutil.InitRepo(t)
+	testutil.CommitFile(t, repo, "base/output.yaml", "replicas: 1\n")
+	testutil.CommitFile(t, repo, "base/TRUNCATED", "")
+	testutil.CommitFile(t, repo, "head/output.yaml", "replicas: 1\n")
+	testutil.GitCmd(t, repo, "tag", "base")
+	testutil.GitCmd(t, repo, "rm", "-q", "base/TRUNCATED")
+	testutil.CommitFile(t, repo, "base/output.yaml", "replicas: 2\n")
+	testutil.CommitFile(t, repo, "head/output.yaml", "replicas: 2\n")
+	testutil.CommitFile(t, repo, "head/TRUNCATED", "")
+	t.Chdir(repo)
+
+	// Only the output of base at the base revision and the current output of head are cut off
+	b := testutil.Builder{OutputFile: "output.yaml", TruncateMarker: "TRUNCATED"}
+	results := b.BuildAll(t.Context(), []string{filepath.Join(repo, "base"), filepath.Join(repo, "head")}, false)
+
+	diffs, err := New(b).Diff(t.Context(), "base", results, false)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 diffs, got %+v", diffs)
+	}
+	for _, diff := range diffs {
+		if diff.Diff != "" || diff.Error != errTruncated {
+			t.Errorf("expected no diff of truncated output for %s, got %+v", diff.Path, diff)
+		}
+	}
+}
@@ -3,67 +3,462 @@ package discovery
 import (
 	"fmt"
 	"io/fs"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 
+	"github.com/michielvha/kustomize-build-check/internal/kustfile"
+	"github.com/michielvha/kustomize-build-check/internal/pathglob"
 	"gopkg.in/yaml.v3"
 )
 
 // KustomizeFile represents a parsed kustomization file
 type KustomizeFile struct {
-	Path       string   // Absolute path to kustomization.yaml
-	Dir        string   // Directory containing the file
-	Resources  []string // Relative paths referenced
-	Bases      []string // Deprecated bases field
-	Components []string // Component paths
+	Path           string   // Absolute path to kustomization.yaml
+	Dir            string   // Directory containing the file
+	Resources      []string // Relative paths referenced
+	Bases          []string // Deprecated bases field
+	Components     []string // Component paths
+	Patches        []string // Patch file paths (patches, patchesStrategicMerge, patchesJson6902)
+	GeneratorFiles []string // Files read by configMapGenerator and secretGenerator
+	Transformers   []string // Transformer config files or directories
+	Generators     []string // Generator config files or directories
+	SchemaFiles    []string // OpenAPI schema (openapi.path) and CRD files (crds) affecting validation and merges
+	HelmValues     []string // Values files of helmCharts (valuesFile and additionalValuesFiles)
 }
 
 // Discoverer finds and parses kustomization files
 type Discoverer interface {
-	FindAll(rootDir string) ([]KustomizeFile, error)
+	FindAll(rootDir string) ([]KustomizeFile, []ParseError, error)
+	FindAllRoots(rootDirs []string) ([]KustomizeFile, []ParseError, error)
+	FindInDirs(dirs []string) ([]KustomizeFile, []ParseError, error)
+	FindExternal(files []KustomizeFile, rootDirs []string, boundary string) ([]KustomizeFile, []ParseError)
 	ParseKustomization(path string) (*KustomizeFile, error)
 }
 
-type discoverer struct{}
+// DefaultSkipDirs are directory names pruned from the walk at any level,
+// since they never contain kustomizations worth checking
+var DefaultSkipDirs = []string{"node_modules", "vendor"}
+
+type discoverer struct {
+	include        []string
+	exclude        []string
+	skipDirs       []string
+	followSymlinks bool
+	maxDepth       int
+	parsed         func(path string) (KustomizeFile, bool)
+	names          []string
+}
+
+// Option configures a Discoverer
+type Option func(*discoverer)
+
+// WithInclude only parses kustomizations whose directory (relative to rootDir)
+// matches one of the glob patterns or lies below a matching directory.
+// Hidden directories are only walked when a pattern names them, e.g. ".deploy/**".
+func WithInclude(patterns []string) Option {
+	return func(d *discoverer) {
+		d.include = patterns
+	}
+}
+
+// WithExclude prunes directories (relative to rootDir) matching one of the glob patterns
+func WithExclude(patterns []string) Option {
+	return func(d *discoverer) {
+		d.exclude = patterns
+	}
+}
+
+// WithFollowSymlinks descends into symlinked directories, guarding against symlink cycles.
+// Discovered kustomizations are reported at their real location.
+func WithFollowSymlinks(follow bool) Option {
+	return func(d *discoverer) {
+		d.followSymlinks = follow
+	}
+}
+
+// WithMaxDepth stops descending more than n directory levels below rootDir.
+// Depth 0 only scans rootDir itself, a negative depth means unlimited.
+// Hidden directories are skipped regardless of the depth limit.
+func WithMaxDepth(n int) Option {
+	return func(d *discoverer) {
+		d.maxDepth = n
+	}
+}
+
+// WithSkipDirs replaces DefaultSkipDirs with the given directory names
+func WithSkipDirs(names []string) Option {
+	return func(d *discoverer) {
+		d.skipDirs = names
+	}
+}
+
+// WithKustomizationNames accepts additional kustomization file names, e.g. ones
+// produced by tooling, on top of the names kustomize itself looks for
+func WithKustomizationNames(names []string) Option {
+	return func(d *discoverer) {
+		d.names = names
+	}
+}
+
+// WithParsed reuses the kustomization lookup returns for a kustomization file path instead
+// of parsing the file, e.g. one cached by a previous run. lookup is called concurrently.
+func WithParsed(lookup func(path string) (KustomizeFile, bool)) Option {
+	return func(d *discoverer) {
+		d.parsed = lookup
+	}
+}
 
 // New creates a new Discoverer
-func New() Discoverer {
-	return &discoverer{}
+func New(opts ...Option) Discoverer {
+	d := &discoverer{
+		skipDirs: DefaultSkipDirs,
+		maxDepth: -1,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
 }
 
-// FindAll recursively finds all kustomization files in rootDir
-func (d *discoverer) FindAll(rootDir string) ([]KustomizeFile, error) {
-	var files []KustomizeFile
+// IgnoreFileName is the name of the file in rootDir listing glob patterns of directories to skip
+const IgnoreFileName = ".kustomizeignore"
 
-	err := filepath.WalkDir(rootDir, func(path string, entry fs.DirEntry, err error) error {
+// ParseError is a kustomization file that was found but could not be parsed
+type ParseError struct {
+	Path string
+	Err  error
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("failed to parse %s: %v", e.Path, e.Err)
+}
+
+// FindAll recursively finds all kustomization files in rootDir.
+// Files that fail to parse are left out and returned as parse errors for the caller to report.
+func (d *discoverer) FindAll(rootDir string) ([]KustomizeFile, []ParseError, error) {
+	// Walk the tree to collect candidate files, parsing happens concurrently afterwards
+	var candidates []string
+
+	ignorePatterns, err := readIgnoreFile(filepath.Join(rootDir, IgnoreFileName))
+	if err != nil {
+		return nil, nil, err
+	}
+	exclude := append(append([]string{}, d.exclude...), ignorePatterns...)
+
+	// Real paths of walked directories, used to avoid symlink cycles
+	visitedDirs := make(map[string]bool)
+
+	var visit fs.WalkDirFunc
+	visit = func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Skip hidden directories
-		if entry.IsDir() && strings.HasPrefix(entry.Name(), ".") && path != rootDir {
+		rel, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return err
+		}
+
+		// Skip hidden directories, unless rootDir itself or explicitly included
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), ".") && path != rootDir && !d.includesHidden(rel, entry.Name()) {
 			return fs.SkipDir
 		}
 
+		// Descend into symlinked directories when requested
+		if d.followSymlinks && entry.Type()&fs.ModeSymlink != 0 {
+			return d.walkSymlink(path, rel, exclude, visit)
+		}
+
+		// Prune excluded directories so their subtree is never walked
+		if entry.IsDir() {
+			if path != rootDir && pathglob.MatchAny(exclude, rel) {
+				return fs.SkipDir
+			}
+			if d.maxDepth >= 0 && depth(rel) > d.maxDepth {
+				return fs.SkipDir
+			}
+			if path != rootDir && slices.Contains(d.skipDirs, entry.Name()) {
+				return fs.SkipDir
+			}
+			if d.followSymlinks {
+				realPath, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					return err
+				}
+				if visitedDirs[realPath] {
+					return fs.SkipDir
+				}
+				visitedDirs[realPath] = true
+			}
+			return nil
+		}
+
 		// Check if this is a kustomization file
-		if !entry.IsDir() && isKustomizationFile(entry.Name()) {
-			kf, err := d.ParseKustomization(path)
-			if err != nil {
-				// Log warning but continue
-				fmt.Fprintf(os.Stderr, "Warning: failed to parse %s: %v\n", path, err)
+		if kustfile.Match(entry.Name(), d.names...) {
+			if pathglob.MatchAny(exclude, rel) || !d.included(filepath.Dir(rel)) {
 				return nil
 			}
-			files = append(files, *kf)
+
+			if d.followSymlinks {
+				// Report the real location so the graph dedupes symlinked kustomizations
+				if path, err = filepath.EvalSymlinks(path); err != nil {
+					return err
+				}
+			}
+
+			candidates = append(candidates, path)
+		}
+
+		return nil
+	}
+
+	err = filepath.WalkDir(rootDir, visit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to walk directory: %w", err)
+	}
+
+	files, parseErrors := d.parseAll(candidates)
+	return files, parseErrors, nil
+}
+
+// FindAllRoots discovers kustomizations below each of rootDirs and merges the results.
+// Kustomizations found through overlapping roots are only returned once.
+func (d *discoverer) FindAllRoots(rootDirs []string) ([]KustomizeFile, []ParseError, error) {
+	var files []KustomizeFile
+	var parseErrors []ParseError
+	seen := make(map[string]bool)
+
+	for _, rootDir := range rootDirs {
+		found, failed, err := d.FindAll(rootDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to discover kustomizations in %s: %w", rootDir, err)
+		}
+		for _, kf := range found {
+			if seen[kf.Path] {
+				continue
+			}
+			seen[kf.Path] = true
+			files = append(files, kf)
+		}
+		for _, pe := range failed {
+			if seen[pe.Path] {
+				continue
+			}
+			seen[pe.Path] = true
+			parseErrors = append(parseErrors, pe)
+		}
+	}
+
+	return files, parseErrors, nil
+}
+
+// FindInDirs parses the kustomization file of each of the given directories instead of walking
+// a tree, e.g. when a prior step already computed the set to check. It fails if any directory
+// has no kustomization file. Include, exclude and skip rules don't apply.
+func (d *discoverer) FindInDirs(dirs []string) ([]KustomizeFile, []ParseError, error) {
+	var paths, missing []string
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		path, err := FindKustomizationFile(dir, d.names...)
+		if err != nil {
+			missing = append(missing, dir)
+			continue
+		}
+		if abs, err := filepath.Abs(path); err == nil && !seen[abs] {
+			seen[abs] = true
+			paths = append(paths, path)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("no kustomization file found in %s", strings.Join(missing, ", "))
+	}
+
+	files, parseErrors := d.parseAll(paths)
+	return files, parseErrors, nil
+}
+
+// FindExternal parses the kustomizations that files reference outside all rootDirs, e.g. a
+// shared base above the root-dir of an overlay, and in turn the ones those reference.
+// References leaving boundary, typically the repository root, aren't followed.
+func (d *discoverer) FindExternal(files []KustomizeFile, rootDirs []string, boundary string) ([]KustomizeFile, []ParseError) {
+	var external []KustomizeFile
+	var parseErrors []ParseError
+
+	seen := make(map[string]bool)
+	for _, file := range files {
+		seen[file.Dir] = true
+	}
+	pending := files
+	for len(pending) > 0 {
+		var paths []string
+		for _, ref := range FindExternalReferences(pending, rootDirs) {
+			if seen[ref.Dir] || !withinDir(ref.Dir, boundary) {
+				continue
+			}
+			seen[ref.Dir] = true
+			if path, err := FindKustomizationFile(ref.Dir, d.names...); err == nil {
+				paths = append(paths, path)
+			}
 		}
 
+		found, failed := d.parseAll(paths)
+		external = append(external, found...)
+		parseErrors = append(parseErrors, failed...)
+		pending = found
+	}
+
+	return external, parseErrors
+}
+
+// parseAll parses the kustomization files concurrently with a bounded worker pool.
+// Files that fail to parse are left out and returned as parse errors.
+// The order of the returned files is unspecified.
+func (d *discoverer) parseAll(paths []string) ([]KustomizeFile, []ParseError) {
+	workers := min(runtime.NumCPU(), len(paths))
+
+	jobs := make(chan string)
+	parsed := make(chan *KustomizeFile)
+
+	var (
+		mu          sync.Mutex
+		parseErrors []ParseError
+		wg          sync.WaitGroup
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				if d.parsed != nil {
+					if kf, ok := d.parsed(path); ok {
+						parsed <- &kf
+						continue
+					}
+				}
+				kf, err := d.ParseKustomization(path)
+				if err != nil {
+					mu.Lock()
+					parseErrors = append(parseErrors, ParseError{Path: path, Err: err})
+					mu.Unlock()
+					continue
+				}
+				parsed <- kf
+			}
+		}()
+	}
+
+	go func() {
+		for _, path := range paths {
+			jobs <- path
+		}
+		close(jobs)
+		wg.Wait()
+		close(parsed)
+	}()
+
+	files := make([]KustomizeFile, 0, len(paths))
+	for kf := range parsed {
+		files = append(files, *kf)
+	}
+
+	// Report parse errors in a stable order
+	sort.Slice(parseErrors, func(i, j int) bool { return parseErrors[i].Path < parseErrors[j].Path })
+
+	return files, parseErrors
+}
+
+// walkSymlink walks the directory a symlink points to, reporting paths below the symlink
+// so include/exclude patterns keep matching against the logical path
+func (d *discoverer) walkSymlink(path, rel string, exclude []string, visit fs.WalkDirFunc) error {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		// Dangling symlink
+		fmt.Fprintf(os.Stderr, "Warning: failed to resolve symlink %s: %v\n", path, err)
 		return nil
+	}
+
+	info, err := os.Stat(realPath)
+	if err != nil || !info.IsDir() {
+		// Symlinked files are handled by the regular walk
+		if err == nil && kustfile.Match(filepath.Base(path), d.names...) {
+			return visit(path, fs.FileInfoToDirEntry(info), nil)
+		}
+		return nil
+	}
+
+	if pathglob.MatchAny(exclude, rel) {
+		return nil
+	}
+
+	return filepath.WalkDir(realPath, func(p string, entry fs.DirEntry, err error) error {
+		relToReal, relErr := filepath.Rel(realPath, p)
+		if relErr != nil {
+			return relErr
+		}
+		return visit(filepath.Join(path, relToReal), entry, err)
 	})
+}
+
+// depth returns the number of directory levels of a path relative to rootDir
+func depth(rel string) int {
+	if rel == "." {
+		return 0
+	}
+	return strings.Count(filepath.ToSlash(rel), "/") + 1
+}
+
+// readIgnoreFile reads the glob patterns from an ignore file, skipping blank lines and # comments.
+// A missing file is not an error.
+func readIgnoreFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to walk directory: %w", err)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
 	}
 
-	return files, nil
+	return patterns, nil
+}
+
+// included checks if a directory relative to rootDir passes the include patterns
+func (d *discoverer) included(relDir string) bool {
+	if len(d.include) == 0 {
+		return true
+	}
+	return pathglob.MatchAnyTree(d.include, relDir)
+}
+
+// includesHidden checks if an include pattern explicitly names the hidden directory name,
+// e.g. ".deploy/**", and leads to or below relDir (relative to rootDir). Wildcards alone
+// never match hidden directories, so "**" doesn't pull in .git.
+func (d *discoverer) includesHidden(relDir, name string) bool {
+	for _, pattern := range d.include {
+		explicit := slices.ContainsFunc(strings.Split(filepath.ToSlash(pattern), "/"), func(segment string) bool {
+			ok, err := path.Match(segment, name)
+			return strings.HasPrefix(segment, ".") && err == nil && ok
+		})
+		if explicit && (pathglob.MatchPrefix(pattern, relDir) || pathglob.MatchTree(pattern, relDir)) {
+			return true
+		}
+	}
+	return false
 }
 
 // ParseKustomization parses a kustomization file
@@ -77,6 +472,25 @@ func (d *discoverer) ParseKustomization(path string) (*KustomizeFile, error) {
 		Resources  []string `yaml:"resources"`
 		Bases      []string `yaml:"bases"`
 		Components []string `yaml:"components"`
+		Patches    []struct {
+			Path string `yaml:"path"`
+		} `yaml:"patches"`
+		PatchesStrategicMerge []string `yaml:"patchesStrategicMerge"`
+		PatchesJSON6902       []struct {
+			Path string `yaml:"path"`
+		} `yaml:"patchesJson6902"`
+		ConfigMapGenerator []generatorArgs `yaml:"configMapGenerator"`
+		SecretGenerator    []generatorArgs `yaml:"secretGenerator"`
+		Transformers       []string        `yaml:"transformers"`
+		Generators         []string        `yaml:"generators"`
+		OpenAPI            struct {
+			Path string `yaml:"path"`
+		} `yaml:"openapi"`
+		CRDs       []string `yaml:"crds"`
+		HelmCharts []struct {
+			ValuesFile            string   `yaml:"valuesFile"`
+			AdditionalValuesFiles []string `yaml:"additionalValuesFiles"`
+		} `yaml:"helmCharts"`
 	}
 
 	if err := yaml.Unmarshal(data, &content); err != nil {
@@ -88,18 +502,279 @@ func (d *discoverer) ParseKustomization(path string) (*KustomizeFile, error) {
 		return nil, fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
+	var patches []string
+	for _, patch := range content.Patches {
+		if patch.Path != "" {
+			patches = append(patches, patch.Path)
+		}
+	}
+	for _, patch := range content.PatchesStrategicMerge {
+		// Entries can also be inline patches
+		if !strings.Contains(patch, "\n") {
+			patches = append(patches, patch)
+		}
+	}
+	for _, patch := range content.PatchesJSON6902 {
+		if patch.Path != "" {
+			patches = append(patches, patch.Path)
+		}
+	}
+
+	var generatorFiles []string
+	for _, gen := range append(content.ConfigMapGenerator, content.SecretGenerator...) {
+		generatorFiles = append(generatorFiles, gen.paths()...)
+	}
+
+	var schemaFiles []string
+	if content.OpenAPI.Path != "" {
+		schemaFiles = append(schemaFiles, content.OpenAPI.Path)
+	}
+	schemaFiles = append(schemaFiles, content.CRDs...)
+
+	var helmValues []string
+	for _, chart := range content.HelmCharts {
+		if chart.ValuesFile != "" {
+			helmValues = append(helmValues, chart.ValuesFile)
+		}
+		helmValues = append(helmValues, chart.AdditionalValuesFiles...)
+	}
+
 	return &KustomizeFile{
-		Path:       absPath,
-		Dir:        filepath.Dir(absPath),
-		Resources:  content.Resources,
-		Bases:      content.Bases,
-		Components: content.Components,
+		Path:           absPath,
+		Dir:            filepath.Dir(absPath),
+		Resources:      content.Resources,
+		Bases:          content.Bases,
+		Components:     content.Components,
+		Patches:        patches,
+		GeneratorFiles: generatorFiles,
+		Transformers:   pathEntries(content.Transformers),
+		Generators:     pathEntries(content.Generators),
+		SchemaFiles:    schemaFiles,
+		HelmValues:     helmValues,
 	}, nil
 }
 
-// isKustomizationFile checks if the filename is a kustomization file
-func isKustomizationFile(name string) bool {
-	return name == "kustomization.yaml" ||
-		name == "kustomization.yml" ||
-		name == "Kustomization"
+// pathEntries filters out inline YAML configs from a list of paths
+func pathEntries(entries []string) []string {
+	var paths []string
+	for _, entry := range entries {
+		if !strings.Contains(entry, "\n") {
+			paths = append(paths, entry)
+		}
+	}
+	return paths
+}
+
+// generatorArgs is the subset of configMapGenerator/secretGenerator entries that reference files
+type generatorArgs struct {
+	Files []string `yaml:"files"`
+	Envs  []string `yaml:"envs"`
+	Env   string   `yaml:"env"`
+}
+
+// paths returns the files read by the generator
+func (g generatorArgs) paths() []string {
+	var paths []string
+	for _, file := range g.Files {
+		// Entries can be "key=path"
+		if idx := strings.Index(file, "="); idx >= 0 {
+			file = file[idx+1:]
+		}
+		paths = append(paths, file)
+	}
+	paths = append(paths, g.Envs...)
+	if g.Env != "" {
+		paths = append(paths, g.Env)
+	}
+	return paths
+}
+
+// remoteRefPrefixes are prefixes that identify a remote kustomization reference
+var remoteRefPrefixes = []string{
+	"git::",
+	"git@",
+	"github.com/",
+	"gitlab.com/",
+	"bitbucket.org/",
+}
+
+// IsRemoteRef checks if a reference points to a remote location instead of a local path
+func IsRemoteRef(ref string) bool {
+	if strings.Contains(ref, "://") || strings.Contains(ref, "?ref=") {
+		return true
+	}
+
+	for _, prefix := range remoteRefPrefixes {
+		if strings.HasPrefix(ref, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// gitHosts serve repositories at their HTTPS URLs, kustomize clones those instead of
+// downloading them
+var gitHosts = []string{"github.com", "gitlab.com", "bitbucket.org"}
+
+// IsRemoteResource checks if a resources entry is an HTTP(S) URL of a manifest that kustomize
+// downloads as a file, rather than a remote kustomization it clones
+func IsRemoteResource(ref string) bool {
+	lower := strings.ToLower(ref)
+	if !strings.HasPrefix(lower, "https://") && !strings.HasPrefix(lower, "http://") {
+		return false
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return false
+	}
+
+	// Pinned refs, "//" subdirectories and .git paths are repositories
+	query := u.Query()
+	if query.Has("ref") || query.Has("version") || strings.Contains(u.Path, "//") ||
+		strings.Contains(u.Path, ".git") || strings.Contains(u.Path, "/_git/") {
+		return false
+	}
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".yaml", ".yml", ".json":
+		// e.g. release assets on github.com
+		return true
+	}
+	return !slices.Contains(gitHosts, strings.ToLower(u.Hostname()))
+}
+
+// DanglingReference is a local path referenced by a kustomization that doesn't exist on disk
+type DanglingReference struct {
+	Kustomization string // Absolute path to the kustomization file
+	Field         string // Field the reference was found in
+	Reference     string // The reference as written in the kustomization
+}
+
+// FindDanglingReferences checks that every local resources, bases, components
+// and patches entry of the kustomizations exists on disk
+func FindDanglingReferences(files []KustomizeFile) []DanglingReference {
+	var dangling []DanglingReference
+
+	for _, file := range files {
+		fields := []struct {
+			name string
+			refs []string
+		}{
+			{"resources", file.Resources},
+			{"bases", file.Bases},
+			{"components", file.Components},
+			{"patches", file.Patches},
+		}
+
+		for _, field := range fields {
+			for _, ref := range field.refs {
+				// Glob patterns may legitimately match nothing yet
+				if IsRemoteRef(ref) || pathglob.HasMeta(ref) {
+					continue
+				}
+				if _, err := os.Stat(filepath.Join(file.Dir, ref)); err != nil {
+					dangling = append(dangling, DanglingReference{
+						Kustomization: file.Path,
+						Field:         field.name,
+						Reference:     ref,
+					})
+				}
+			}
+		}
+	}
+
+	return dangling
+}
+
+// ExternalReference is a local directory reference of a kustomization that resolves
+// outside all root directories, so discovery doesn't find what it points to
+type ExternalReference struct {
+	Kustomization string // Path of the kustomization file containing the reference
+	Dir           string // Absolute path of the referenced directory
+}
+
+// FindExternalReferences returns the existing directories that resources, bases and
+// components entries of files reference outside all rootDirs, sorted
+func FindExternalReferences(files []KustomizeFile, rootDirs []string) []ExternalReference {
+	var roots []string
+	for _, rootDir := range rootDirs {
+		if abs, err := filepath.Abs(rootDir); err == nil {
+			roots = append(roots, abs)
+		}
+	}
+
+	var refs []ExternalReference
+	for _, file := range files {
+		for _, ref := range slices.Concat(file.Resources, file.Bases, file.Components) {
+			if IsRemoteRef(ref) || pathglob.HasMeta(ref) {
+				continue
+			}
+			dir := filepath.Clean(filepath.Join(file.Dir, ref))
+			if slices.ContainsFunc(roots, func(root string) bool { return withinDir(dir, root) }) {
+				continue
+			}
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				continue
+			}
+			refs = append(refs, ExternalReference{Kustomization: file.Path, Dir: dir})
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Dir != refs[j].Dir {
+			return refs[i].Dir < refs[j].Dir
+		}
+		return refs[i].Kustomization < refs[j].Kustomization
+	})
+
+	return refs
+}
+
+// withinDir checks if path is dir itself or lies below it
+func withinDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// DuplicateKustomization is a directory containing more than one kustomization file,
+// which kustomize refuses to build as the kustomization is ambiguous
+type DuplicateKustomization struct {
+	Dir   string   // Directory containing the files
+	Paths []string // Absolute paths to the kustomization files, sorted
+}
+
+// FindDuplicateKustomizations reports directories with more than one kustomization file,
+// e.g. both kustomization.yaml and kustomization.yml left behind by a rename
+func FindDuplicateKustomizations(files []KustomizeFile) []DuplicateKustomization {
+	byDir := make(map[string][]string)
+	for _, file := range files {
+		byDir[file.Dir] = append(byDir[file.Dir], file.Path)
+	}
+
+	var duplicates []DuplicateKustomization
+	for dir, paths := range byDir {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			duplicates = append(duplicates, DuplicateKustomization{Dir: dir, Paths: paths})
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i].Dir < duplicates[j].Dir })
+
+	return duplicates
+}
+
+// FindKustomizationFile returns the path of the kustomization file in dir, also accepting
+// the additional file names in extraNames
+func FindKustomizationFile(dir string, extraNames ...string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && kustfile.Match(entry.Name(), extraNames...) {
+			return filepath.Join(dir, entry.Name()), nil
+		}
+	}
+
+	return "", fmt.Errorf("no kustomization file found in %s", dir)
 }
@@ -1,30 +1,85 @@
 package discovery
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 )
 
-func TestIsKustomizationFile(t *testing.T) {
+func TestFindAllKustomizationNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"upper/kustomization.YAML", "custom/kustomization.gen.yaml"} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("resources: []\n"), 0o644); err != nil {
+			t.Fatalf("failed to write kustomization: %v", err)
+		}
+	}
+
+	files, _, err := New(WithKustomizationNames([]string{"kustomization.gen.yaml"})).FindAll(tmpDir)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	if len(files) != 2 {
+		t.Errorf("expected the uppercase extension and the custom name to be found, got %v", files)
+	}
+
+	files, _, err = New().FindAll(tmpDir)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	if len(files) != 1 || filepath.Base(files[0].Path) != "kustomization.YAML" {
+		t.Errorf("expected only the uppercase extension without custom names, got %v", files)
+	}
+}
+
+func TestIsRemoteRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"github.com/org/repo//overlays/base?ref=v1.2.3", true},
+		{"https://github.com/org/repo/base", true},
+		{"git::https://gitlab.com/org/repo.git//base", true},
+		{"git@github.com:org/repo.git", true},
+		{"../base", false},
+		{"deployment.yaml", false},
+		{"components/monitoring", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRemoteRef(tt.ref); got != tt.want {
+			t.Errorf("IsRemoteRef(%q) = %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestIsRemoteResource(t *testing.T) {
 	tests := []struct {
-		name     string
-		filename string
-		want     bool
+		ref  string
+		want bool
 	}{
-		{"standard yaml", "kustomization.yaml", true},
-		{"standard yml", "kustomization.yml", true},
-		{"capital K", "Kustomization", true},
-		{"random yaml", "deployment.yaml", false},
-		{"wrong name", "kustomize.yaml", false},
+		{"https://example.com/manifests", true},
+		{"https://raw.githubusercontent.com/org/repo/main/deploy.yaml", true},
+		{"https://github.com/cert-manager/cert-manager/releases/download/v1.14.0/cert-manager.yaml", true},
+		{"https://github.com/org/repo/base", false},
+		{"https://github.com/org/repo//overlays/base?ref=v1.2.3", false},
+		{"https://example.com/org/repo.git", false},
+		{"https://dev.azure.com/org/project/_git/repo", false},
+		{"git::https://gitlab.com/org/repo.git//base", false},
+		{"github.com/org/repo/base", false},
+		{"deployment.yaml", false},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := isKustomizationFile(tt.filename); got != tt.want {
-				t.Errorf("isKustomizationFile(%q) = %v, want %v", tt.filename, got, tt.want)
-			}
-		})
+		if got := IsRemoteResource(tt.ref); got != tt.want {
+			t.Errorf("IsRemoteResource(%q) = %v, want %v", tt.ref, got, tt.want)
+		}
 	}
 }
 
@@ -72,6 +127,141 @@ components:
 	}
 }
 
+func TestParseKustomizationPatchesAndGenerators(t *testing.T) {
+	tmpDir := t.TempDir()
+	kustomizationPath := filepath.Join(tmpDir, "kustomization.yaml")
+
+	content := `resources:
+  - ../base
+patches:
+  - path: patch-replicas.yaml
+  - patch: |-
+      - op: replace
+        path: /spec/replicas
+        value: 3
+patchesStrategicMerge:
+  - patch-memory.yaml
+patchesJson6902:
+  - path: patch-json.yaml
+configMapGenerator:
+  - name: app
+    files:
+      - config.properties
+      - custom-key=settings.json
+    envs:
+      - app.env
+secretGenerator:
+  - name: creds
+    env: creds.env
+`
+
+	if err := os.WriteFile(kustomizationPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	kf, err := New().ParseKustomization(kustomizationPath)
+	if err != nil {
+		t.Fatalf("ParseKustomization failed: %v", err)
+	}
+
+	wantPatches := []string{"patch-replicas.yaml", "patch-memory.yaml", "patch-json.yaml"}
+	if strings.Join(kf.Patches, ",") != strings.Join(wantPatches, ",") {
+		t.Errorf("expected patches %v, got %v", wantPatches, kf.Patches)
+	}
+
+	wantGenerators := []string{"config.properties", "settings.json", "app.env", "creds.env"}
+	if strings.Join(kf.GeneratorFiles, ",") != strings.Join(wantGenerators, ",") {
+		t.Errorf("expected generator files %v, got %v", wantGenerators, kf.GeneratorFiles)
+	}
+}
+
+func TestParseKustomizationTransformersAndGenerators(t *testing.T) {
+	tmpDir := t.TempDir()
+	kustomizationPath := filepath.Join(tmpDir, "kustomization.yaml")
+
+	content := `transformers:
+  - ../../transformers/labels
+  - |-
+    apiVersion: builtin
+    kind: NamespaceTransformer
+    metadata:
+      name: inline
+generators:
+  - generator-config.yaml
+`
+
+	if err := os.WriteFile(kustomizationPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	kf, err := New().ParseKustomization(kustomizationPath)
+	if err != nil {
+		t.Fatalf("ParseKustomization failed: %v", err)
+	}
+
+	if len(kf.Transformers) != 1 || kf.Transformers[0] != "../../transformers/labels" {
+		t.Errorf("expected only the transformer directory, got %v", kf.Transformers)
+	}
+
+	if len(kf.Generators) != 1 || kf.Generators[0] != "generator-config.yaml" {
+		t.Errorf("expected generator config file, got %v", kf.Generators)
+	}
+}
+
+func TestParseKustomizationSchemaFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	kustomizationPath := filepath.Join(tmpDir, "kustomization.yaml")
+
+	content := `openapi:
+  path: ../schemas/custom.json
+crds:
+  - crds/rollout.yaml
+resources:
+  - rollout.yaml
+`
+
+	if err := os.WriteFile(kustomizationPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	kf, err := New().ParseKustomization(kustomizationPath)
+	if err != nil {
+		t.Fatalf("ParseKustomization failed: %v", err)
+	}
+
+	if want := []string{"../schemas/custom.json", "crds/rollout.yaml"}; !slices.Equal(kf.SchemaFiles, want) {
+		t.Errorf("SchemaFiles = %v, want %v", kf.SchemaFiles, want)
+	}
+}
+
+func TestParseKustomizationHelmValues(t *testing.T) {
+	tmpDir := t.TempDir()
+	kustomizationPath := filepath.Join(tmpDir, "kustomization.yaml")
+
+	content := `helmCharts:
+  - name: ingress-nginx
+    repo: https://kubernetes.github.io/ingress-nginx
+    valuesFile: values-prod.yaml
+    additionalValuesFiles:
+      - ../common/values.yaml
+  - name: cert-manager
+    repo: https://charts.jetstack.io
+`
+
+	if err := os.WriteFile(kustomizationPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	kf, err := New().ParseKustomization(kustomizationPath)
+	if err != nil {
+		t.Fatalf("ParseKustomization failed: %v", err)
+	}
+
+	if want := []string{"values-prod.yaml", "../common/values.yaml"}; !slices.Equal(kf.HelmValues, want) {
+		t.Errorf("HelmValues = %v, want %v", kf.HelmValues, want)
+	}
+}
+
 func TestFindAll(t *testing.T) {
 	// Create test structure
 	tmpDir := t.TempDir()
@@ -104,7 +294,7 @@ func TestFindAll(t *testing.T) {
 	}
 
 	d := New()
-	files, err := d.FindAll(tmpDir)
+	files, _, err := d.FindAll(tmpDir)
 	if err != nil {
 		t.Fatalf("FindAll failed: %v", err)
 	}
@@ -113,3 +303,442 @@ func TestFindAll(t *testing.T) {
 		t.Errorf("expected 3 kustomization files, got %d", len(files))
 	}
 }
+
+// writeKustomization creates dir (relative to root) with a minimal kustomization.yaml
+func writeKustomization(t *testing.T, root, dir string) {
+	t.Helper()
+	writeKustomizationContent(t, root, dir, "resources:\n  - deployment.yaml\n")
+}
+
+// writeKustomizationContent creates dir (relative to root) with a kustomization.yaml holding content
+func writeKustomizationContent(t *testing.T, root, dir, content string) {
+	t.Helper()
+
+	fullDir := filepath.Join(root, dir)
+	if err := os.MkdirAll(fullDir, 0o755); err != nil {
+		t.Fatalf("failed to create %s: %v", dir, err)
+	}
+	if err := os.WriteFile(filepath.Join(fullDir, "kustomization.yaml"), []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s kustomization: %v", dir, err)
+	}
+}
+
+// discoveredDirs returns the discovered directories relative to root
+func discoveredDirs(t *testing.T, root string, files []KustomizeFile) map[string]bool {
+	t.Helper()
+
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f.Dir)
+		if err != nil {
+			t.Fatalf("failed to relativize %s: %v", f.Dir, err)
+		}
+		dirs[filepath.ToSlash(rel)] = true
+	}
+	return dirs
+}
+
+func TestFindAllExclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeKustomization(t, tmpDir, "k8s/base")
+	writeKustomization(t, tmpDir, "vendor/github.com/org/base")
+	writeKustomization(t, tmpDir, "examples/demo")
+
+	d := New(WithExclude([]string{"vendor", "examples/"}))
+	files, _, err := d.FindAll(tmpDir)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+
+	dirs := discoveredDirs(t, tmpDir, files)
+	if len(dirs) != 1 || !dirs["k8s/base"] {
+		t.Errorf("expected only k8s/base, got %v", dirs)
+	}
+}
+
+func TestFindAllInclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeKustomization(t, tmpDir, "k8s/base")
+	writeKustomization(t, tmpDir, "k8s/overlays/dev")
+	writeKustomization(t, tmpDir, "k8s/overlays/prod")
+	writeKustomization(t, tmpDir, "other/base")
+
+	d := New(WithInclude([]string{"k8s/overlays/prod"}))
+	files, _, err := d.FindAll(tmpDir)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+
+	dirs := discoveredDirs(t, tmpDir, files)
+	if len(dirs) != 1 || !dirs["k8s/overlays/prod"] {
+		t.Errorf("expected only k8s/overlays/prod, got %v", dirs)
+	}
+}
+
+func TestFindAllKustomizeIgnore(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeKustomization(t, tmpDir, "k8s/base")
+	writeKustomization(t, tmpDir, "k8s/legacy/app")
+	writeKustomization(t, tmpDir, "scratch/test")
+
+	ignore := "# ignored during discovery\n\nk8s/legacy\n  scratch/  \n"
+	if err := os.WriteFile(filepath.Join(tmpDir, IgnoreFileName), []byte(ignore), 0o644); err != nil {
+		t.Fatalf("failed to write ignore file: %v", err)
+	}
+
+	files, _, err := New().FindAll(tmpDir)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+
+	dirs := discoveredDirs(t, tmpDir, files)
+	if len(dirs) != 1 || !dirs["k8s/base"] {
+		t.Errorf("expected only k8s/base, got %v", dirs)
+	}
+}
+
+func TestFindAllFollowSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "repo")
+
+	// A shared base outside the root, symlinked into two services
+	writeKustomization(t, tmpDir, "shared")
+	writeKustomization(t, root, "svc-a")
+	writeKustomization(t, root, "svc-b")
+	for _, svc := range []string{"svc-a", "svc-b"} {
+		if err := os.Symlink(filepath.Join(tmpDir, "shared"), filepath.Join(root, svc, "base")); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	// A symlink cycle must not hang the walk
+	if err := os.Symlink(root, filepath.Join(root, "svc-a", "loop")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	files, _, err := New().FindAll(root)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	if len(files) != 2 {
+		t.Errorf("expected symlinks to be ignored by default, got %d files", len(files))
+	}
+
+	files, _, err = New(WithFollowSymlinks(true)).FindAll(root)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+
+	realShared, err := filepath.EvalSymlinks(filepath.Join(tmpDir, "shared"))
+	if err != nil {
+		t.Fatalf("failed to resolve shared dir: %v", err)
+	}
+
+	sharedCount := 0
+	for _, f := range files {
+		if f.Dir == realShared {
+			sharedCount++
+		}
+	}
+
+	if len(files) != 3 || sharedCount != 1 {
+		t.Errorf("expected 3 files with the shared base discovered once at its real path, got %+v", files)
+	}
+}
+
+func TestFindAllMaxDepth(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeKustomization(t, tmpDir, ".")
+	writeKustomization(t, tmpDir, "base")
+	writeKustomization(t, tmpDir, "overlays/dev")
+	writeKustomization(t, tmpDir, "apps/team/deep/config")
+
+	tests := []struct {
+		maxDepth int
+		want     int
+	}{
+		{0, 1},
+		{1, 2},
+		{2, 3},
+		{-1, 4},
+	}
+
+	for _, tt := range tests {
+		files, _, err := New(WithMaxDepth(tt.maxDepth)).FindAll(tmpDir)
+		if err != nil {
+			t.Fatalf("FindAll failed: %v", err)
+		}
+		if len(files) != tt.want {
+			t.Errorf("max depth %d: expected %d files, got %d", tt.maxDepth, tt.want, len(files))
+		}
+	}
+}
+
+func TestFindAllSkipsDefaultDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeKustomization(t, tmpDir, "base")
+	writeKustomization(t, tmpDir, "node_modules/pkg")
+	writeKustomization(t, tmpDir, "app/vendor/lib")
+
+	// A broken kustomization would emit a parse warning if it were ever parsed
+	if err := os.WriteFile(filepath.Join(tmpDir, "node_modules", "pkg", "kustomization.yaml"), []byte("resources: [\n"), 0o644); err != nil {
+		t.Fatalf("failed to write kustomization: %v", err)
+	}
+
+	files, _, err := New().FindAll(tmpDir)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+
+	dirs := discoveredDirs(t, tmpDir, files)
+	if len(dirs) != 1 || !dirs["base"] {
+		t.Errorf("expected only base, got %v", dirs)
+	}
+
+	// Overriding the skip list scans vendor again
+	files, _, err = New(WithSkipDirs([]string{"node_modules"})).FindAll(tmpDir)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+
+	dirs = discoveredDirs(t, tmpDir, files)
+	if len(dirs) != 2 || !dirs["app/vendor/lib"] {
+		t.Errorf("expected base and app/vendor/lib, got %v", dirs)
+	}
+}
+
+func TestFindDuplicateKustomizations(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"app/kustomization.yaml", "app/kustomization.yml", "other/kustomization.yaml"} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("resources: []\n"), 0o644); err != nil {
+			t.Fatalf("failed to write kustomization: %v", err)
+		}
+	}
+
+	files, _, err := New().FindAll(tmpDir)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+
+	duplicates := FindDuplicateKustomizations(files)
+	if len(duplicates) != 1 {
+		t.Fatalf("expected 1 duplicate, got %v", duplicates)
+	}
+	want := []string{filepath.Join(tmpDir, "app", "kustomization.yaml"), filepath.Join(tmpDir, "app", "kustomization.yml")}
+	if duplicates[0].Dir != filepath.Join(tmpDir, "app") || !slices.Equal(duplicates[0].Paths, want) {
+		t.Errorf("expected %s to contain %v, got %+v", filepath.Join(tmpDir, "app"), want, duplicates[0])
+	}
+}
+
+func BenchmarkFindAll(b *testing.B) {
+	tmpDir := b.TempDir()
+
+	// 200 overlays sharing 20 bases
+	for i := 0; i < 20; i++ {
+		dir := filepath.Join(tmpDir, "bases", fmt.Sprintf("app-%d", i))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			b.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources:\n  - deployment.yaml\n  - service.yaml\n"), 0o644); err != nil {
+			b.Fatalf("failed to write kustomization: %v", err)
+		}
+	}
+	for i := 0; i < 200; i++ {
+		dir := filepath.Join(tmpDir, "overlays", fmt.Sprintf("env-%d", i))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			b.Fatalf("failed to create dir: %v", err)
+		}
+		content := fmt.Sprintf("resources:\n  - ../../bases/app-%d\npatches:\n  - path: patch.yaml\n", i%20)
+		if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte(content), 0o644); err != nil {
+			b.Fatalf("failed to write kustomization: %v", err)
+		}
+	}
+
+	d := New()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		files, _, err := d.FindAll(tmpDir)
+		if err != nil {
+			b.Fatalf("FindAll failed: %v", err)
+		}
+		if len(files) != 220 {
+			b.Fatalf("expected 220 files, got %d", len(files))
+		}
+	}
+}
+
+func TestFindDanglingReferences(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeKustomization(t, tmpDir, "base")
+	if err := os.WriteFile(filepath.Join(tmpDir, "base", "deployment.yaml"), []byte("kind: Deployment\n"), 0o644); err != nil {
+		t.Fatalf("failed to write deployment: %v", err)
+	}
+
+	files := []KustomizeFile{
+		{
+			Path:       filepath.Join(tmpDir, "overlay", "kustomization.yaml"),
+			Dir:        filepath.Join(tmpDir, "overlay"),
+			Resources:  []string{"../base", "../base-typo", "github.com/org/repo//base?ref=v1"},
+			Components: []string{"../components/missing"},
+			Patches:    []string{"../base/deployment.yaml"},
+		},
+	}
+
+	dangling := FindDanglingReferences(files)
+
+	if len(dangling) != 2 {
+		t.Fatalf("expected 2 dangling references, got %d: %+v", len(dangling), dangling)
+	}
+
+	if dangling[0].Field != "resources" || dangling[0].Reference != "../base-typo" {
+		t.Errorf("unexpected dangling reference: %+v", dangling[0])
+	}
+
+	if dangling[1].Field != "components" || dangling[1].Reference != "../components/missing" {
+		t.Errorf("unexpected dangling reference: %+v", dangling[1])
+	}
+}
+
+func TestFindAllRoots(t *testing.T) {
+	root := t.TempDir()
+	writeKustomization(t, root, "deploy/app")
+	writeKustomization(t, root, "infra/k8s/ingress")
+	writeKustomization(t, root, "unrelated/app")
+
+	// Overlapping roots only report each kustomization once
+	roots := []string{filepath.Join(root, "deploy"), filepath.Join(root, "infra", "k8s"), filepath.Join(root, "deploy", "app")}
+	files, _, err := New().FindAllRoots(roots)
+	if err != nil {
+		t.Fatalf("FindAllRoots failed: %v", err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("expected 2 kustomizations, got %d", len(files))
+	}
+	dirs := discoveredDirs(t, root, files)
+	for _, want := range []string{"deploy/app", "infra/k8s/ingress"} {
+		if !dirs[want] {
+			t.Errorf("expected %s to be discovered, got %v", want, dirs)
+		}
+	}
+}
+
+func TestFindAllReturnsParseErrors(t *testing.T) {
+	root := t.TempDir()
+	writeKustomization(t, root, "apps/web")
+
+	writeKustomizationContent(t, root, "apps/broken", "resources: [\n")
+	broken := filepath.Join(root, "apps", "broken")
+
+	files, parseErrors, err := New().FindAll(root)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+
+	if len(files) != 1 {
+		t.Errorf("expected only the valid kustomization, got %d", len(files))
+	}
+	if len(parseErrors) != 1 || parseErrors[0].Path != filepath.Join(broken, "kustomization.yaml") {
+		t.Errorf("expected a parse error for the broken kustomization, got %v", parseErrors)
+	}
+}
+
+func TestFindInDirs(t *testing.T) {
+	root := t.TempDir()
+	writeKustomization(t, root, "apps/web")
+	writeKustomization(t, root, "apps/api")
+	writeKustomization(t, root, "apps/worker")
+
+	dirs := []string{filepath.Join(root, "apps", "web"), filepath.Join(root, "apps", "api"), filepath.Join(root, "apps", "web")}
+	files, _, err := New().FindInDirs(dirs)
+	if err != nil {
+		t.Fatalf("FindInDirs failed: %v", err)
+	}
+
+	got := discoveredDirs(t, root, files)
+	if len(files) != 2 || !got["apps/web"] || !got["apps/api"] {
+		t.Errorf("expected only the listed directories, got %v", got)
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, "docs"), 0o755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	_, _, err = New().FindInDirs([]string{filepath.Join(root, "apps", "web"), filepath.Join(root, "docs")})
+	if err == nil || !strings.Contains(err.Error(), "docs") {
+		t.Errorf("expected an error naming the directory without a kustomization file, got %v", err)
+	}
+}
+
+func TestFindExternal(t *testing.T) {
+	parent := t.TempDir()
+	repo := filepath.Join(parent, "repo")
+	for dir, content := range map[string]string{
+		"repo/deploy/apps/web":  "resources:\n  - ../../../shared/base\n  - ../api\n",
+		"repo/deploy/apps/api":  "resources:\n  - deployment.yaml\n",
+		"repo/shared/base":      "resources:\n  - ../common\n  - ../../../outside\n",
+		"repo/shared/common":    "resources:\n  - configmap.yaml\n",
+		"repo/shared/unrelated": "resources: []\n",
+		"outside":               "resources: []\n",
+	} {
+		writeKustomizationContent(t, parent, dir, content)
+	}
+
+	rootDirs := []string{filepath.Join(repo, "deploy")}
+	d := New()
+	files, _, err := d.FindAllRoots(rootDirs)
+	if err != nil {
+		t.Fatalf("FindAllRoots failed: %v", err)
+	}
+
+	refs := FindExternalReferences(files, rootDirs)
+	if len(refs) != 1 || refs[0].Dir != filepath.Join(repo, "shared", "base") {
+		t.Errorf("expected only the shared base to be referenced outside the root, got %+v", refs)
+	}
+
+	// The base above the root is followed transitively, but not out of the repository
+	external, parseErrors := d.FindExternal(files, rootDirs, repo)
+	if len(parseErrors) != 0 {
+		t.Fatalf("unexpected parse errors: %v", parseErrors)
+	}
+	got := discoveredDirs(t, repo, external)
+	if len(external) != 2 || !got["shared/base"] || !got["shared/common"] {
+		t.Errorf("expected shared/base and shared/common, got %v", got)
+	}
+}
+
+func TestFindAllHiddenDirs(t *testing.T) {
+	root := t.TempDir()
+	writeKustomization(t, root, "apps/web")
+	writeKustomization(t, root, ".deploy/base")
+	writeKustomization(t, root, ".git/base")
+
+	files, _, err := New().FindAll(root)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	if dirs := discoveredDirs(t, root, files); len(dirs) != 1 || !dirs["apps/web"] {
+		t.Errorf("expected hidden directories to be skipped by default, got %v", dirs)
+	}
+
+	files, _, err = New(WithInclude([]string{"apps/**", ".deploy/**", "**/base"})).FindAll(root)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	dirs := discoveredDirs(t, root, files)
+	if len(dirs) != 2 || !dirs["apps/web"] || !dirs[".deploy/base"] {
+		t.Errorf("expected the explicitly included .deploy/base but not .git/base, got %v", dirs)
+	}
+
+	// A hidden rootDir is always walked
+	files, _, err = New().FindAll(filepath.Join(root, ".deploy"))
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected .deploy/base to be found below a hidden root, got %d kustomizations", len(files))
+	}
+}
@@ -2,54 +2,248 @@ package git
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
 // Analyzer detects changed files between git references
 type Analyzer interface {
-	GetChangedFiles(baseRef, headRef string) ([]string, error)
+	GetChangedFiles(ctx context.Context, baseRef, headRef string) ([]string, error)
 }
 
-type analyzer struct{}
+// ErrInitialCommit is returned when no base reference was given and HEAD has no parent
+// to compare against, callers should fall back to checking everything
+var ErrInitialCommit = errors.New("HEAD is the initial commit, there is no previous commit to compare against")
 
-// New creates a new Git analyzer
-func New() Analyzer {
-	return &analyzer{}
+// ErrShallowClone is returned when no base reference was given and the parent of HEAD was
+// cut off by a shallow clone, which must not be mistaken for an initial commit
+var ErrShallowClone = errors.New("the previous commit is not available in this shallow clone, " +
+	"set fetch-depth: 2 (or 0) on actions/checkout, or set base-ref")
+
+type analyzer struct {
+	autoFetch         bool
+	recurseSubmodules bool
+	pathspecs         []string
 }
 
-// GetChangedFiles returns the list of files changed between baseRef and headRef
-func (a *analyzer) GetChangedFiles(baseRef, headRef string) ([]string, error) {
-	if baseRef == "" {
-		baseRef = "HEAD~1"
+// Option configures an Analyzer
+type Option func(*analyzer)
+
+// WithAutoFetch fetches a base reference missing from a shallow checkout and retries the diff
+func WithAutoFetch(autoFetch bool) Option {
+	return func(a *analyzer) {
+		a.autoFetch = autoFetch
 	}
+}
+
+// WithRecurseSubmodules reports the files changed inside a submodule whose recorded commit
+// changed, instead of the single submodule path git diff reports
+func WithRecurseSubmodules(recurse bool) Option {
+	return func(a *analyzer) {
+		a.recurseSubmodules = recurse
+	}
+}
+
+// WithPathspecs limits the diff to files matching the git pathspecs, e.g. subtree paths
+// relative to the working directory, so changes elsewhere in a monorepo aren't listed at all
+func WithPathspecs(pathspecs []string) Option {
+	return func(a *analyzer) {
+		a.pathspecs = pathspecs
+	}
+}
+
+// New creates a new Git analyzer
+func New(opts ...Option) Analyzer {
+	a := &analyzer{}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// GetChangedFiles returns the absolute paths of the files changed between baseRef and headRef.
+// Without a baseRef the previous commit is used, returning ErrInitialCommit if there is none
+// and ErrShallowClone if it wasn't fetched.
+func (a *analyzer) GetChangedFiles(ctx context.Context, baseRef, headRef string) ([]string, error) {
 	if headRef == "" {
 		headRef = "HEAD"
 	}
+	if baseRef == "" {
+		baseRef = headRef + "~1"
+		if _, _, err := runGit(ctx, "rev-parse", "--verify", "--quiet", baseRef+"^{commit}"); err != nil {
+			if shallow, _, err := runGit(ctx, "rev-parse", "--is-shallow-repository"); err == nil && strings.TrimSpace(shallow) == "true" {
+				return nil, ErrShallowClone
+			}
+			return nil, ErrInitialCommit
+		}
+		slog.Debug("No base reference provided, comparing against the previous commit", "base", baseRef, "head", headRef)
+	}
 
-	cmd := exec.Command("git", "diff", "--name-only", baseRef, headRef)
+	output, stderr, err := runGit(ctx, a.diffArgs(baseRef, headRef)...)
+	if err != nil && a.autoFetch && isUnknownRevision(stderr) {
+		slog.Info("Base reference not available locally, fetching it", "ref", baseRef)
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+		fetchedRef, fetchErr := fetchRef(ctx, baseRef)
+		if fetchErr != nil {
+			return nil, fmt.Errorf("git diff failed because %q is not available locally, and fetching it failed: %w", baseRef, fetchErr)
+		}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("git diff failed: %w\nStderr: %s", err, stderr.String())
+		output, stderr, err = runGit(ctx, a.diffArgs(fetchedRef, headRef)...)
+		if err != nil {
+			return nil, fmt.Errorf("git diff failed after fetching %q: %w\nStderr: %s", baseRef, err, stderr)
+		}
+		baseRef = fetchedRef
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed: %w\nStderr: %s", err, stderr)
 	}
 
-	output := stdout.String()
-	if output == "" {
+	paths := splitPaths(output)
+	if len(paths) == 0 {
 		return []string{}, nil
 	}
 
-	lines := strings.Split(strings.TrimSpace(output), "\n")
+	// git diff reports paths relative to the repository root, regardless of the working directory
+	topLevel, err := TopLevel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.recurseSubmodules {
+		if paths, err = expandSubmodules(ctx, topLevel, baseRef, headRef, paths); err != nil {
+			return nil, err
+		}
+	}
+
+	return ResolvePaths(topLevel, paths), nil
+}
+
+// diffArgs returns the git arguments listing the files changed between baseRef and headRef.
+// -z separates the paths with NULs and leaves them unquoted, git would otherwise quote and
+// C-escape paths with spaces or non-ASCII characters.
+func (a *analyzer) diffArgs(baseRef, headRef string) []string {
+	args := []string{"diff", "--name-only", "-z", baseRef, headRef}
+	if len(a.pathspecs) > 0 {
+		args = append(append(args, "--"), a.pathspecs...)
+	}
+	return args
+}
+
+// splitPaths splits the NUL-terminated paths of git -z output. Unlike lines, NUL-separated
+// paths survive file names containing newlines.
+func splitPaths(output string) []string {
+	paths := strings.Split(output, "\x00")
+	// Every path is terminated, leaving an empty element at the end
+	if paths[len(paths)-1] == "" {
+		paths = paths[:len(paths)-1]
+	}
+	return paths
+}
+
+// ResolveCommit returns the SHA of the commit ref points to
+func ResolveCommit(ctx context.Context, ref string) (string, error) {
+	sha, stderr, err := runGit(ctx, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %q: %w\nStderr: %s", ref, err, stderr)
+	}
+	return strings.TrimSpace(sha), nil
+}
+
+// DiffFiles returns a unified diff from oldPath to newPath, empty when they are identical.
+// The files don't have to be inside a repository.
+func DiffFiles(ctx context.Context, oldPath, newPath string) (string, error) {
+	out, stderr, err := runGit(ctx, "diff", "--no-index", "--no-color", "--no-ext-diff", oldPath, newPath)
+
+	// git diff --no-index exits with 1 when the files differ
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return "", fmt.Errorf("git diff failed: %w\nStderr: %s", err, stderr)
+	}
+	return out, nil
+}
+
+// TopLevel returns the absolute path of the root of the repository containing the working directory
+func TopLevel(ctx context.Context) (string, error) {
+	topLevel, stderr, err := runGit(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("failed to find the repository root: %w\nStderr: %s", err, stderr)
+	}
+	return filepath.FromSlash(strings.TrimSpace(topLevel)), nil
+}
+
+// ResolvePaths converts slash-separated paths relative to the repository root, as reported
+// by git, into absolute paths. Empty entries are dropped and absolute paths are kept as-is.
+// Paths aren't trimmed, file names may start or end with whitespace.
+func ResolvePaths(topLevel string, paths []string) []string {
 	var files []string
-	for _, line := range lines {
-		if line != "" {
-			files = append(files, strings.TrimSpace(line))
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		path = filepath.FromSlash(path)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(topLevel, path)
 		}
+		files = append(files, path)
+	}
+	return files
+}
+
+// RepoRelative returns path relative to the repository root topLevel, e.g. to locate it
+// in a worktree. It fails for paths outside the repository.
+func RepoRelative(topLevel, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(topLevel, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the repository", path)
 	}
+	return rel, nil
+}
+
+// fetchRef shallowly fetches ref from origin and returns the reference to diff against
+func fetchRef(ctx context.Context, ref string) (string, error) {
+	args := []string{"fetch", "--depth=1", "origin"}
+
+	// Remote-tracking branches are fetched into their tracking ref so ref keeps resolving,
+	// anything else (branch name, tag, SHA) is diffed through FETCH_HEAD
+	resolved := "FETCH_HEAD"
+	if branch, ok := strings.CutPrefix(ref, "origin/"); ok {
+		args = append(args, fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", branch, branch))
+		resolved = ref
+	} else {
+		args = append(args, ref)
+	}
+
+	if _, stderr, err := runGit(ctx, args...); err != nil {
+		return "", fmt.Errorf("git fetch failed: %w\nStderr: %s", err, stderr)
+	}
+
+	return resolved, nil
+}
+
+// isUnknownRevision checks if git failed because a revision doesn't exist locally
+func isUnknownRevision(stderr string) bool {
+	return strings.Contains(stderr, "unknown revision") ||
+		strings.Contains(stderr, "bad revision") ||
+		strings.Contains(stderr, "ambiguous argument")
+}
+
+// runGit runs a git command and returns its stdout and stderr, it is killed when ctx is done
+func runGit(ctx context.Context, args ...string) (string, string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
 
-	return files, nil
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
 }
@@ -0,0 +1,249 @@
+package git
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"testing"
+
+	impact "github.com/michielvha/kustomize-build-check/internal/analyzer"
+	"github.com/michielvha/kustomize-build-check/internal/discovery"
+	"github.com/michielvha/kustomize-build-check/internal/graph"
+	"github.com/michielvha/kustomize-build-check/internal/testutil"
+)
+
+func TestGetChangedFilesAutoFetch(t *testing.T) {
+	upstream := testutil.InitRepo(t)
+	testutil.CommitFile(t, upstream, "base/kustomization.yaml", "resources: []\n")
+	testutil.GitCmd(t, upstream, "branch", "feature")
+	testutil.CommitFile(t, upstream, "base/deployment.yaml", "kind: Deployment\n")
+
+	// Shallow single-branch clone, origin/feature is unknown
+	clone := filepath.Join(filepath.Dir(upstream), "clone")
+	testutil.GitCmd(t, upstream, "clone", "-q", "--depth=1", "--single-branch", "--branch", "main", "file://"+upstream, clone)
+	t.Chdir(clone)
+
+	if _, err := New().GetChangedFiles(t.Context(), "origin/feature", "HEAD"); err == nil {
+		t.Fatal("expected diff against unfetched ref to fail without auto-fetch")
+	}
+
+	files, err := New(WithAutoFetch(true)).GetChangedFiles(t.Context(), "origin/feature", "HEAD")
+	if err != nil {
+		t.Fatalf("GetChangedFiles failed: %v", err)
+	}
+
+	if want := filepath.Join(clone, "base", "deployment.yaml"); len(files) != 1 || files[0] != want {
+		t.Errorf("expected %s to be changed, got %v", want, files)
+	}
+}
+
+func TestGetChangedFilesInitialCommit(t *testing.T) {
+	repo := testutil.InitRepo(t)
+	testutil.CommitFile(t, repo, "base/kustomization.yaml", "resources: []\n")
+	t.Chdir(repo)
+
+	_, err := New().GetChangedFiles(t.Context(), "", "HEAD")
+	if !errors.Is(err, ErrInitialCommit) {
+		t.Errorf("expected ErrInitialCommit, got %v", err)
+	}
+}
+
+func TestGetChangedFilesShallowClone(t *testing.T) {
+	repo := testutil.InitRepo(t)
+	testutil.CommitFile(t, repo, "base/kustomization.yaml", "resources: []\n")
+	testutil.CommitFile(t, repo, "base/deployment.yaml", "kind: Deployment\n")
+
+	// Like actions/checkout with the default fetch-depth of 1
+	clone := filepath.Join(t.TempDir(), "clone")
+	testutil.GitCmd(t, repo, "clone", "-q", "--depth", "1", "file://"+filepath.ToSlash(repo), clone)
+	t.Chdir(clone)
+
+	_, err := New().GetChangedFiles(t.Context(), "", "HEAD")
+	if !errors.Is(err, ErrShallowClone) {
+		t.Errorf("expected ErrShallowClone, got %v", err)
+	}
+}
+
+func TestGetChangedFilesEmptyDiff(t *testing.T) {
+	repo := testutil.InitRepo(t)
+	testutil.CommitFile(t, repo, "base/kustomization.yaml", "resources: []\n")
+	testutil.CommitFile(t, repo, "base/deployment.yaml", "kind: Deployment\n")
+	t.Chdir(repo)
+
+	// Base equal to HEAD has no changes
+	files, err := New().GetChangedFiles(t.Context(), "HEAD", "HEAD")
+	if err != nil {
+		t.Fatalf("GetChangedFiles failed: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected no changes, got %v", files)
+	}
+
+	// Without a base the previous commit is used
+	files, err = New().GetChangedFiles(t.Context(), "", "HEAD")
+	if err != nil {
+		t.Fatalf("GetChangedFiles failed: %v", err)
+	}
+	if want := filepath.Join(repo, "base", "deployment.yaml"); len(files) != 1 || files[0] != want {
+		t.Errorf("expected %s to be changed, got %v", want, files)
+	}
+}
+
+func TestGetChangedFilesFromSubdirectory(t *testing.T) {
+	repo := testutil.InitRepo(t)
+	testutil.CommitFile(t, repo, "deploy/base/kustomization.yaml", "resources:\n  - deployment.yaml\n")
+	testutil.CommitFile(t, repo, "deploy/overlay/kustomization.yaml", "resources:\n  - ../base\n")
+	testutil.CommitFile(t, repo, "deploy/base/deployment.yaml", "kind: Deployment\n")
+
+	// Run with root-dir a level below the repository root
+	t.Chdir(filepath.Join(repo, "deploy"))
+
+	files, err := New().GetChangedFiles(t.Context(), "", "HEAD")
+	if err != nil {
+		t.Fatalf("GetChangedFiles failed: %v", err)
+	}
+
+	kustomizations, _, err := discovery.New().FindAll(".")
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	affected := impact.New().GetAffectedKustomizations(files, g, kustomizations)
+	sort.Strings(affected)
+
+	want := []string{filepath.Join(repo, "deploy", "base"), filepath.Join(repo, "deploy", "overlay")}
+	if !slices.Equal(affected, want) {
+		t.Errorf("expected %v to be affected, got %v", want, affected)
+	}
+}
+
+func TestGetChangedFilesPathspecs(t *testing.T) {
+	a := New(WithPathspecs([]string{"deploy/", "charts/"})).(*analyzer)
+	want := []string{"diff", "--name-only", "-z", "main", "HEAD", "--", "deploy/", "charts/"}
+	if args := a.diffArgs("main", "HEAD"); !slices.Equal(args, want) {
+		t.Errorf("diffArgs() = %v, want %v", args, want)
+	}
+	if args := New().(*analyzer).diffArgs("main", "HEAD"); slices.Contains(args, "--") {
+		t.Errorf("expected no pathspecs without diff paths, got %v", args)
+	}
+
+	repo := testutil.InitRepo(t)
+	testutil.CommitFile(t, repo, "deploy/base/kustomization.yaml", "resources: []\n")
+	testutil.GitCmd(t, repo, "tag", "base")
+	testutil.CommitFile(t, repo, "deploy/base/deployment.yaml", "kind: Deployment\n")
+	testutil.CommitFile(t, repo, "src/main.go", "package main\n")
+	t.Chdir(repo)
+
+	files, err := New(WithPathspecs([]string{"deploy"})).GetChangedFiles(t.Context(), "base", "HEAD")
+	if err != nil {
+		t.Fatalf("GetChangedFiles failed: %v", err)
+	}
+	if want := []string{filepath.Join(repo, "deploy", "base", "deployment.yaml")}; !slices.Equal(files, want) {
+		t.Errorf("expected only %v to be changed, got %v", want, files)
+	}
+}
+
+func TestGetChangedFilesQuotedNames(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file names can't contain quotes on windows")
+	}
+
+	repo := testutil.InitRepo(t)
+	// Without -z git prints these as "deploy/na\303\257ve.yaml" and "deploy/say \"hi\".yaml"
+	testutil.GitCmd(t, repo, "config", "core.quotePath", "true")
+	testutil.CommitFile(t, repo, "deploy/kustomization.yaml", "resources: []\n")
+	testutil.GitCmd(t, repo, "tag", "base")
+	testutil.CommitFile(t, repo, "deploy/naïve.yaml", "kind: Deployment\n")
+	testutil.CommitFile(t, repo, `deploy/say "hi".yaml`, "kind: Service\n")
+	t.Chdir(repo)
+
+	files, err := New().GetChangedFiles(t.Context(), "base", "HEAD")
+	if err != nil {
+		t.Fatalf("GetChangedFiles failed: %v", err)
+	}
+	want := []string{filepath.Join(repo, "deploy", "naïve.yaml"), filepath.Join(repo, "deploy", `say "hi".yaml`)}
+	if !slices.Equal(files, want) {
+		t.Errorf("expected %q to be changed, got %q", want, files)
+	}
+}
+
+func TestSplitPaths(t *testing.T) {
+	tests := []struct {
+		output string
+		want   []string
+	}{
+		{"", []string{}},
+		{"base/deployment.yaml\x00", []string{"base/deployment.yaml"}},
+		{"base/line\nbreak.yaml\x00overlay/na me.yaml\x00", []string{"base/line\nbreak.yaml", "overlay/na me.yaml"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitPaths(tt.output); !slices.Equal(got, tt.want) {
+			t.Errorf("splitPaths(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestGetChangedFilesWhitespaceInNames(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file names can't contain newlines on windows")
+	}
+
+	repo := testutil.InitRepo(t)
+	testutil.CommitFile(t, repo, "deploy/kustomization.yaml", "resources: []\n")
+	testutil.GitCmd(t, repo, "tag", "base")
+	testutil.CommitFile(t, repo, "deploy/line\nbreak.yaml", "kind: Deployment\n")
+	testutil.CommitFile(t, repo, "deploy/\nleading.yaml", "kind: Deployment\n")
+	testutil.CommitFile(t, repo, "deploy/trailing.yaml ", "kind: Deployment\n")
+	t.Chdir(repo)
+
+	files, err := New().GetChangedFiles(t.Context(), "base", "HEAD")
+	if err != nil {
+		t.Fatalf("GetChangedFiles failed: %v", err)
+	}
+	want := []string{
+		filepath.Join(repo, "deploy", "\nleading.yaml"),
+		filepath.Join(repo, "deploy", "line\nbreak.yaml"),
+		filepath.Join(repo, "deploy", "trailing.yaml "),
+	}
+	if !slices.Equal(files, want) {
+		t.Errorf("expected %q to be changed, got %q", want, files)
+	}
+}
+
+func TestResolveCommit(t *testing.T) {
+	repo := testutil.InitRepo(t)
+	testutil.CommitFile(t, repo, "base/kustomization.yaml", "resources: []\n")
+	testutil.GitCmd(t, repo, "tag", "v1")
+	t.Chdir(repo)
+
+	head, err := ResolveCommit(t.Context(), "HEAD")
+	if err != nil || len(head) != 40 {
+		t.Fatalf("ResolveCommit(HEAD) = %q, %v", head, err)
+	}
+	if tag, err := ResolveCommit(t.Context(), "v1"); err != nil || tag != head {
+		t.Errorf("expected the tag to resolve to %s, got %q, %v", head, tag, err)
+	}
+	if _, err := ResolveCommit(t.Context(), "missing"); err == nil {
+		t.Error("expected an error for an unknown ref")
+	}
+}
+
+func TestResolvePaths(t *testing.T) {
+	root := filepath.FromSlash("/repo")
+	got := ResolvePaths(root, []string{"k8s/base/deployment.yaml", " padded.yaml ", filepath.FromSlash("/elsewhere/file.yaml"), ""})
+	want := []string{
+		filepath.Join(root, "k8s", "base", "deployment.yaml"),
+		filepath.Join(root, " padded.yaml "),
+		filepath.FromSlash("/elsewhere/file.yaml"),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ResolvePaths() = %v, want %v", got, want)
+	}
+}
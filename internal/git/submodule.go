@@ -0,0 +1,94 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitlinkMode is the file mode git reports for the commit a submodule is recorded at
+const gitlinkMode = "160000"
+
+// gitlink is a submodule whose recorded commit changed between two commits
+type gitlink struct {
+	Path   string
+	OldSHA string // Empty for an added submodule
+	NewSHA string
+}
+
+// parseGitlinks returns the changed submodules in git diff --raw -z output. Removed
+// submodules are left out, they have no files left to expand to.
+func parseGitlinks(raw string) []gitlink {
+	var links []gitlink
+	entries := strings.Split(raw, "\x00")
+	for i := 0; i+1 < len(entries); i += 2 {
+		// :<old mode> <new mode> <old sha> <new sha> <status>\0<path>\0, without renames
+		// every entry has a single path
+		meta, name := entries[i], entries[i+1]
+		fields := strings.Fields(strings.TrimPrefix(meta, ":"))
+		if len(fields) < 5 || fields[1] != gitlinkMode {
+			continue
+		}
+		link := gitlink{Path: name, OldSHA: fields[2], NewSHA: fields[3]}
+		if fields[0] != gitlinkMode {
+			link.OldSHA = ""
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// expandSubmodules replaces the changed submodules among the paths changed in the repository
+// at dir with the files changed inside them, prefixed with the submodule path. Submodules
+// that aren't checked out or lack a commit keep their single entry.
+func expandSubmodules(ctx context.Context, dir, baseRef, headRef string, paths []string) ([]string, error) {
+	raw, stderr, err := runGit(ctx, "-C", dir, "diff", "--raw", "-z", "--no-abbrev", "--no-renames", baseRef, headRef)
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed: %w\nStderr: %s", err, stderr)
+	}
+
+	expanded := make(map[string][]string)
+	for _, link := range parseGitlinks(raw) {
+		inner, err := submoduleChanges(ctx, filepath.Join(dir, filepath.FromSlash(link.Path)), link)
+		if err != nil {
+			slog.Warn("Failed to diff inside submodule, treating it as a single change", "submodule", link.Path, "error", err)
+			continue
+		}
+		for i := range inner {
+			inner[i] = path.Join(link.Path, inner[i])
+		}
+		expanded[link.Path] = inner
+	}
+
+	var result []string
+	for _, p := range paths {
+		if inner, ok := expanded[p]; ok {
+			result = append(result, inner...)
+		} else {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// submoduleChanges returns the files changed inside the submodule checked out at dir,
+// relative to it, recursing into nested submodules
+func submoduleChanges(ctx context.Context, dir string, link gitlink) ([]string, error) {
+	if link.OldSHA == "" {
+		// Every file of an added submodule is new
+		output, stderr, err := runGit(ctx, "-C", dir, "ls-tree", "-r", "-z", "--name-only", link.NewSHA)
+		if err != nil {
+			return nil, fmt.Errorf("git ls-tree failed: %w\nStderr: %s", err, stderr)
+		}
+		return splitPaths(output), nil
+	}
+
+	output, stderr, err := runGit(ctx, "-C", dir, "diff", "--name-only", "-z", link.OldSHA, link.NewSHA)
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed: %w\nStderr: %s", err, stderr)
+	}
+	return expandSubmodules(ctx, dir, link.OldSHA, link.NewSHA, splitPaths(output))
+}
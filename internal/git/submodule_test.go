@@ -0,0 +1,68 @@
+package git
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/michielvha/kustomize-build-check/internal/testutil"
+)
+
+func TestParseGitlinks(t *testing.T) {
+	raw := strings.Join([]string{
+		":100644 100644 1111111111111111111111111111111111111111 2222222222222222222222222222222222222222 M", "deploy/base/deployment.yaml",
+		":160000 160000 3333333333333333333333333333333333333333 4444444444444444444444444444444444444444 M", "vendor/manifests",
+		":000000 160000 0000000000000000000000000000000000000000 5555555555555555555555555555555555555555 A", "vendor/added",
+		":160000 000000 6666666666666666666666666666666666666666 0000000000000000000000000000000000000000 D", "vendor/removed",
+		"",
+	}, "\x00")
+
+	want := []gitlink{
+		{Path: "vendor/manifests", OldSHA: "3333333333333333333333333333333333333333", NewSHA: "4444444444444444444444444444444444444444"},
+		{Path: "vendor/added", NewSHA: "5555555555555555555555555555555555555555"},
+	}
+	if got := parseGitlinks(raw); !slices.Equal(got, want) {
+		t.Errorf("parseGitlinks() = %v, want %v", got, want)
+	}
+}
+
+func TestGetChangedFilesRecurseSubmodules(t *testing.T) {
+	sub := testutil.InitRepo(t)
+	testutil.CommitFile(t, sub, "apps/web/kustomization.yaml", "resources: []\n")
+
+	repo := testutil.InitRepo(t)
+	testutil.CommitFile(t, repo, "README.md", "readme\n")
+	testutil.GitCmd(t, repo, "-c", "protocol.file.allow=always", "submodule", "add", "-q", sub, "vendor/manifests")
+	testutil.GitCmd(t, repo, "commit", "-q", "-m", "add submodule")
+
+	// Advance the submodule and record the new commit
+	testutil.CommitFile(t, filepath.Join(repo, "vendor", "manifests"), "apps/web/deployment.yaml", "kind: Deployment\n")
+	testutil.CommitFile(t, repo, "README.md", "docs\n")
+	t.Chdir(repo)
+
+	files, err := New().GetChangedFiles(t.Context(), "", "HEAD")
+	if err != nil {
+		t.Fatalf("GetChangedFiles failed: %v", err)
+	}
+	if want := []string{filepath.Join(repo, "README.md"), filepath.Join(repo, "vendor", "manifests")}; !slices.Equal(files, want) {
+		t.Errorf("expected the submodule as a single change by default, got %v", files)
+	}
+
+	files, err = New(WithRecurseSubmodules(true)).GetChangedFiles(t.Context(), "", "HEAD")
+	if err != nil {
+		t.Fatalf("GetChangedFiles failed: %v", err)
+	}
+	if want := []string{filepath.Join(repo, "README.md"), filepath.Join(repo, "vendor", "manifests", "apps", "web", "deployment.yaml")}; !slices.Equal(files, want) {
+		t.Errorf("expected the files changed inside the submodule, got %v", files)
+	}
+
+	// Adding a submodule adds all of its files
+	files, err = New(WithRecurseSubmodules(true)).GetChangedFiles(t.Context(), "HEAD~2", "HEAD~1")
+	if err != nil {
+		t.Fatalf("GetChangedFiles failed: %v", err)
+	}
+	if want := []string{filepath.Join(repo, ".gitmodules"), filepath.Join(repo, "vendor", "manifests", "apps", "web", "kustomization.yaml")}; !slices.Equal(files, want) {
+		t.Errorf("expected the files of the added submodule, got %v", files)
+	}
+}
@@ -0,0 +1,40 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Worktree checks out ref into a temporary detached worktree, leaving the working tree untouched.
+// The returned cleanup removes the worktree, callers should defer it right away so it also
+// runs when they panic. Calling cleanup more than once is safe.
+func Worktree(ctx context.Context, ref string) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "kustomize-build-check-worktree-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create worktree directory: %w", err)
+	}
+
+	if _, stderr, err := runGit(ctx, "worktree", "add", "--detach", dir, ref); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("failed to check out %s into a worktree: %w\nStderr: %s", ref, err, stderr)
+	}
+
+	var once sync.Once
+	cleanup := func() {
+		once.Do(func() {
+			// Use a fresh context so the worktree is removed even after cancellation
+			if _, stderr, err := runGit(context.Background(), "worktree", "remove", "--force", dir); err != nil {
+				slog.Warn("Failed to remove worktree, pruning it", "path", dir, "error", err, "stderr", stderr)
+				os.RemoveAll(dir)
+				if _, _, err := runGit(context.Background(), "worktree", "prune"); err != nil {
+					slog.Warn("Failed to prune worktrees", "error", err)
+				}
+			}
+		})
+	}
+
+	return dir, cleanup, nil
+}
@@ -0,0 +1,53 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/michielvha/kustomize-build-check/internal/testutil"
+)
+
+func TestWorktree(t *testing.T) {
+	repo := testutil.InitRepo(t)
+	testutil.CommitFile(t, repo, "app/kustomization.yaml", "resources: []\n")
+	testutil.CommitFile(t, repo, "app/kustomization.yaml", "resources:\n  - deployment.yaml\n")
+	t.Chdir(repo)
+
+	dir, cleanup, err := Worktree(t.Context(), "HEAD~1")
+	if err != nil {
+		t.Fatalf("Worktree failed: %v", err)
+	}
+	defer cleanup()
+
+	content, err := os.ReadFile(filepath.Join(dir, "app", "kustomization.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read file from worktree: %v", err)
+	}
+	if string(content) != "resources: []\n" {
+		t.Errorf("expected worktree to contain the previous revision, got %q", content)
+	}
+
+	cleanup()
+	cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected worktree dir to be removed, got %v", err)
+	}
+	if out, _, _ := runGit(t.Context(), "worktree", "list"); strings.Count(out, "\n") != 1 {
+		t.Errorf("expected only the main worktree to remain, got:\n%s", out)
+	}
+}
+
+func TestWorktreeUnknownRef(t *testing.T) {
+	repo := testutil.InitRepo(t)
+	testutil.CommitFile(t, repo, "app/kustomization.yaml", "resources: []\n")
+	t.Chdir(repo)
+
+	if _, _, err := Worktree(t.Context(), "does-not-exist"); err == nil {
+		t.Fatal("expected an error for an unknown ref")
+	}
+	if out, _, _ := runGit(t.Context(), "worktree", "list"); strings.Count(out, "\n") != 1 {
+		t.Errorf("expected no worktree to be left behind, got:\n%s", out)
+	}
+}
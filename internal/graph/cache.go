@@ -0,0 +1,240 @@
+package graph
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/michielvha/kustomize-build-check/internal/discovery"
+)
+
+// cacheVersion is bumped whenever the serialized format changes, older caches are rejected.
+// Version 2 added helm values files to Node.Files, and Node.RemoteResources.
+const cacheVersion = 2
+
+// fileStamp identifies the contents of a kustomization file. The modification time is
+// checked first, the hash covers fresh checkouts where every file has a new mtime.
+type fileStamp struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256"`
+}
+
+// serializedGraph is the cache file format
+type serializedGraph struct {
+	Version        int                       `json:"version"`
+	Nodes          map[string]*Node          `json:"nodes"`
+	ReverseLookup  map[string][]string       `json:"reverseLookup"`
+	Kustomizations []discovery.KustomizeFile `json:"kustomizations"`
+	Stamps         map[string]fileStamp      `json:"stamps"`
+}
+
+// Serialize writes the graph and the kustomizations it was built from, so a later run can
+// Load it and only re-parse the kustomization files that changed
+func (g *DependencyGraph) Serialize(w io.Writer) error {
+	out := serializedGraph{
+		Version:       cacheVersion,
+		Nodes:         g.nodes,
+		ReverseLookup: g.reverseLookup,
+		Stamps:        make(map[string]fileStamp),
+	}
+	for _, path := range g.sortedPaths() {
+		file, ok := g.sources[path]
+		if !ok {
+			continue
+		}
+		out.Kustomizations = append(out.Kustomizations, file)
+		if stamp, err := stampFile(file.Path); err == nil {
+			out.Stamps[file.Path] = stamp
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		return fmt.Errorf("failed to serialize graph: %w", err)
+	}
+	return nil
+}
+
+// Load reads a graph written by Serialize
+func Load(r io.Reader) (Graph, error) {
+	var in serializedGraph
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return nil, fmt.Errorf("failed to load graph: %w", err)
+	}
+	if in.Version != cacheVersion {
+		return nil, fmt.Errorf("graph cache version %d is not supported, expected %d", in.Version, cacheVersion)
+	}
+
+	g := &DependencyGraph{
+		nodes:         in.Nodes,
+		reverseLookup: in.ReverseLookup,
+		sources:       make(map[string]discovery.KustomizeFile),
+		stamps:        in.Stamps,
+	}
+	if g.nodes == nil {
+		g.nodes = make(map[string]*Node)
+	}
+	if g.reverseLookup == nil {
+		g.reverseLookup = make(map[string][]string)
+	}
+	for _, file := range in.Kustomizations {
+		if node, ok := g.nodes[file.Dir]; !ok || node.Path != file.Dir {
+			return nil, fmt.Errorf("graph cache is inconsistent, %s has no node", file.Dir)
+		}
+		g.sources[file.Dir] = file
+	}
+
+	return g, nil
+}
+
+// CachedKustomization returns the kustomization parsed from the file at path when the graph was
+// serialized, provided the file hasn't changed since. It is safe for concurrent use.
+func (g *DependencyGraph) CachedKustomization(path string) (discovery.KustomizeFile, bool) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return discovery.KustomizeFile{}, false
+	}
+	cached, ok := g.stamps[absPath]
+	if !ok {
+		return discovery.KustomizeFile{}, false
+	}
+	file, ok := g.sources[filepath.Dir(absPath)]
+	if !ok || file.Path != absPath {
+		return discovery.KustomizeFile{}, false
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil || info.Size() != cached.Size {
+		return discovery.KustomizeFile{}, false
+	}
+	if !info.ModTime().Equal(cached.ModTime) {
+		stamp, err := stampFile(absPath)
+		if err != nil || stamp.SHA256 != cached.SHA256 {
+			return discovery.KustomizeFile{}, false
+		}
+	}
+
+	return file, true
+}
+
+// Update patches the graph to match files, typically after Load. Nodes of unchanged
+// kustomizations are kept, only changed, added and removed ones are relinked.
+func (g *DependencyGraph) Update(files []discovery.KustomizeFile) error {
+	current := make(map[string]discovery.KustomizeFile, len(files))
+	for _, file := range files {
+		current[file.Dir] = file
+	}
+
+	var changed, added, removed []string
+	for dir, old := range g.sources {
+		file, ok := current[dir]
+		switch {
+		case !ok:
+			removed = append(removed, dir)
+		case !reflect.DeepEqual(old, file):
+			changed = append(changed, dir)
+		}
+	}
+	for _, file := range files {
+		if _, ok := g.sources[file.Dir]; !ok {
+			added = append(added, file.Dir)
+		}
+	}
+
+	slog.Debug("Updating dependency graph",
+		"changed", len(changed),
+		"added", len(added),
+		"removed", len(removed))
+
+	// Drop the links of changed and removed kustomizations, dependents of a removed
+	// kustomization just lose their link to it
+	for _, dir := range append(append([]string{}, changed...), removed...) {
+		g.unlink(dir)
+	}
+	for _, dir := range removed {
+		delete(g.nodes, dir)
+		delete(g.sources, dir)
+		delete(g.reverseLookup, dir)
+	}
+
+	// Dependents of a changed kustomization still reference it and keep their reverse lookups
+	relinked := make(map[string]bool, len(changed)+len(added))
+	for _, dir := range append(append([]string{}, changed...), added...) {
+		g.addNode(current[dir])
+		relinked[dir] = true
+	}
+
+	// Unchanged kustomizations referencing an added one weren't linked to it before
+	if len(added) > 0 {
+		isAdded := make(map[string]bool, len(added))
+		for _, dir := range added {
+			isAdded[dir] = true
+		}
+		for dir, node := range g.nodes {
+			if relinked[dir] {
+				continue
+			}
+			for _, dep := range node.Dependencies {
+				if depPath := g.resolveDependency(dir, dep); isAdded[depPath] {
+					g.reverseLookup[depPath] = append(g.reverseLookup[depPath], dir)
+				}
+			}
+		}
+	}
+
+	for _, dir := range append(append([]string{}, changed...), added...) {
+		g.link(current[dir])
+	}
+
+	for path, node := range g.nodes {
+		node.IsBase = len(g.reverseLookup[path]) > 0
+	}
+	// The graph now reflects files rather than the cache
+	g.stamps = nil
+
+	return nil
+}
+
+// unlink removes the reverse lookups from the dependencies of the kustomization in dir
+func (g *DependencyGraph) unlink(dir string) {
+	node, ok := g.nodes[dir]
+	if !ok {
+		return
+	}
+	for _, dep := range node.Dependencies {
+		depPath := g.resolveDependency(dir, dep)
+		dependents := g.reverseLookup[depPath]
+		kept := dependents[:0]
+		for _, dependent := range dependents {
+			if dependent != dir {
+				kept = append(kept, dependent)
+			}
+		}
+		if len(kept) == 0 {
+			delete(g.reverseLookup, depPath)
+		} else {
+			g.reverseLookup[depPath] = kept
+		}
+	}
+}
+
+// stampFile computes the stamp of the file at path
+func stampFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	sum := sha256.Sum256(data)
+	return fileStamp{Size: info.Size(), ModTime: info.ModTime(), SHA256: hex.EncodeToString(sum[:])}, nil
+}
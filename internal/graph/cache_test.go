@@ -0,0 +1,135 @@
+package graph
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/michielvha/kustomize-build-check/internal/discovery"
+)
+
+func TestUpdateMatchesBuild(t *testing.T) {
+	old := []discovery.KustomizeFile{
+		{Path: "/test/base/kustomization.yaml", Dir: "/test/base", Resources: []string{"deployment.yaml"}},
+		{Path: "/test/overlays/dev/kustomization.yaml", Dir: "/test/overlays/dev", Resources: []string{"../../base"}},
+		{Path: "/test/overlays/prod/kustomization.yaml", Dir: "/test/overlays/prod", Resources: []string{"../../base"}},
+		{Path: "/test/overlays/old/kustomization.yaml", Dir: "/test/overlays/old", Resources: []string{"../../base"}},
+	}
+	current := []discovery.KustomizeFile{
+		// Changed to depend on a new component
+		{Path: "/test/base/kustomization.yaml", Dir: "/test/base", Resources: []string{"deployment.yaml"}, Components: []string{"../components/monitoring"}},
+		{Path: "/test/overlays/dev/kustomization.yaml", Dir: "/test/overlays/dev", Resources: []string{"../../base"}},
+		// Changed to stop depending on base
+		{Path: "/test/overlays/prod/kustomization.yaml", Dir: "/test/overlays/prod", Resources: []string{"service.yaml"}},
+		// Added, referenced by an unchanged kustomization before it existed
+		{Path: "/test/components/monitoring/kustomization.yaml", Dir: "/test/components/monitoring"},
+		{Path: "/test/overlays/staging/kustomization.yaml", Dir: "/test/overlays/staging", Resources: []string{"../../base", "../dev"}},
+	}
+
+	g := New()
+	if err := g.Build(old); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := g.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := loaded.Update(current); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	want := New()
+	if err := want.Build(current); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	wantGraph, gotGraph := want.(*DependencyGraph), loaded.(*DependencyGraph)
+	if !reflect.DeepEqual(gotGraph.nodes, wantGraph.nodes) {
+		t.Errorf("nodes = %v, want %v", gotGraph.nodes, wantGraph.nodes)
+	}
+	if got, want := sortedLookup(gotGraph.reverseLookup), sortedLookup(wantGraph.reverseLookup); !reflect.DeepEqual(got, want) {
+		t.Errorf("reverse lookup = %v, want %v", got, want)
+	}
+	if loaded.GetNode("/test/overlays/old") != nil {
+		t.Error("expected removed kustomization to be dropped")
+	}
+}
+
+func sortedLookup(lookup map[string][]string) map[string][]string {
+	sorted := make(map[string][]string, len(lookup))
+	for base, dependents := range lookup {
+		dependents = append([]string{}, dependents...)
+		sort.Strings(dependents)
+		sorted[base] = dependents
+	}
+	return sorted
+}
+
+func TestLoadRejectsOtherVersion(t *testing.T) {
+	// Version 1 caches are missing the helm values files of each node
+	for _, version := range []int{0, 1, cacheVersion + 1} {
+		if _, err := Load(bytes.NewBufferString(fmt.Sprintf(`{"version": %d}`, version))); err == nil {
+			t.Errorf("expected an error for cache version %d", version)
+		}
+	}
+}
+
+func TestCachedKustomization(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kustomization.yaml")
+	if err := os.WriteFile(path, []byte("resources:\n- deployment.yaml\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file := discovery.KustomizeFile{Path: path, Dir: dir, Resources: []string{"deployment.yaml"}}
+
+	g := New()
+	if err := g.Build([]discovery.KustomizeFile{file}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := g.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	load := func() Graph {
+		t.Helper()
+		loaded, err := Load(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		return loaded
+	}
+
+	if got, ok := load().CachedKustomization(path); !ok || !reflect.DeepEqual(got, file) {
+		t.Errorf("CachedKustomization() = %v, %t, want the unchanged file", got, ok)
+	}
+
+	// A fresh checkout only changes the modification time
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := load().CachedKustomization(path); !ok {
+		t.Error("expected a touched but unchanged file to be cached")
+	}
+
+	if err := os.WriteFile(path, []byte("resources:\n- service.yaml\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := load().CachedKustomization(path); ok {
+		t.Error("expected a changed file not to be cached")
+	}
+	if _, ok := load().CachedKustomization(filepath.Join(t.TempDir(), "kustomization.yaml")); ok {
+		t.Error("expected an unknown file not to be cached")
+	}
+}
@@ -2,11 +2,14 @@ package graph
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/michielvha/kustomize-build-check/internal/discovery"
+	"github.com/michielvha/kustomize-build-check/internal/pathglob"
 )
 
 // Node represents a kustomization in the dependency graph
@@ -14,12 +17,22 @@ type Node struct {
 	Path         string
 	IsBase       bool
 	Dependencies []string // Paths this node depends on
+	RemoteDeps   []string // Remote bases (git/URL references) that are not resolved locally
+	// RemoteResources are manifests kustomize downloads from HTTP(S) URLs
+	RemoteResources []string
+	Files           []string // Absolute paths of local files this node reads directly
+	NoFanout        bool     // Changes aren't propagated to dependents, the node is treated as a leaf
 }
 
 // DependencyGraph represents the relationship between kustomizations
 type DependencyGraph struct {
 	nodes         map[string]*Node
 	reverseLookup map[string][]string // base -> [overlays that depend on it]
+
+	// sources are the kustomizations the graph was built from by directory, kept for Update
+	sources map[string]discovery.KustomizeFile
+	// stamps identify the contents of the kustomization files of a graph loaded from a cache
+	stamps map[string]fileStamp
 }
 
 // Graph interface for dependency operations
@@ -27,8 +40,21 @@ type Graph interface {
 	Build(files []discovery.KustomizeFile) error
 	GetDependentOverlays(basePath string) []string
 	GetAllDependents(path string) []string
+	GetDependentsWithinDepth(path string, maxDepth int) []string
 	IsBase(path string) bool
 	GetNode(path string) *Node
+	GetOrphans() []string
+	GetBuildRoots() []string
+	GetUnresolved() []UnresolvedDependency
+	SetNoFanout(paths []string)
+	GetInputClosure(path string) []string
+	DetectCycles() [][]string
+	DeployOrder(paths []string) ([]DeployNode, error)
+	Update(files []discovery.KustomizeFile) error
+	CachedKustomization(path string) (discovery.KustomizeFile, bool)
+	Serialize(w io.Writer) error
+	ToDOT() string
+	ToMermaid(paths ...string) string
 }
 
 // New creates a new dependency graph
@@ -36,6 +62,7 @@ func New() Graph {
 	return &DependencyGraph{
 		nodes:         make(map[string]*Node),
 		reverseLookup: make(map[string][]string),
+		sources:       make(map[string]discovery.KustomizeFile),
 	}
 }
 
@@ -45,44 +72,12 @@ func (g *DependencyGraph) Build(files []discovery.KustomizeFile) error {
 
 	// First pass: create all nodes
 	for _, file := range files {
-		g.nodes[file.Dir] = &Node{
-			Path:         file.Dir,
-			IsBase:       false,
-			Dependencies: []string{},
-		}
-		slog.Debug("Created node", "path", file.Dir)
+		g.addNode(file)
 	}
 
 	// Second pass: establish dependencies
 	for _, file := range files {
-		deps := g.extractDependencies(&file)
-
-		node := g.nodes[file.Dir]
-		node.Dependencies = deps
-
-		if len(deps) > 0 {
-			slog.Debug("Found dependencies", "kustomization", file.Dir, "dependencies", deps)
-		}
-
-		// For each dependency, mark it as a base and add reverse lookup
-		for _, dep := range deps {
-			// Resolve relative path to absolute
-			absDepPath := filepath.Join(file.Dir, dep)
-			absDepPath = filepath.Clean(absDepPath)
-
-			// Check if this dependency is a kustomization directory
-			if depNode, exists := g.nodes[absDepPath]; exists {
-				depNode.IsBase = true
-				g.reverseLookup[absDepPath] = append(g.reverseLookup[absDepPath], file.Dir)
-				slog.Debug("Added reverse lookup",
-					"base", absDepPath,
-					"dependent", file.Dir)
-			} else {
-				slog.Debug("Dependency not found in discovered kustomizations",
-					"dependency", absDepPath,
-					"referenced_by", file.Dir)
-			}
-		}
+		g.link(file)
 	}
 
 	slog.Debug("Dependency graph built",
@@ -92,14 +87,85 @@ func (g *DependencyGraph) Build(files []discovery.KustomizeFile) error {
 	return nil
 }
 
-// extractDependencies extracts all dependency paths from a kustomization file
-func (g *DependencyGraph) extractDependencies(file *discovery.KustomizeFile) []string {
-	var deps []string
+// addNode creates the node of a kustomization without linking its dependencies
+func (g *DependencyGraph) addNode(file discovery.KustomizeFile) {
+	g.sources[file.Dir] = file
+	g.nodes[file.Dir] = &Node{
+		Path:         file.Dir,
+		IsBase:       false,
+		Dependencies: []string{},
+		Files:        extractFiles(&file),
+	}
+	slog.Debug("Created node", "path", file.Dir)
+}
+
+// link records the dependencies of a kustomization, marking the ones that are nodes as bases
+func (g *DependencyGraph) link(file discovery.KustomizeFile) {
+	deps, remoteDeps, remoteResources := g.extractDependencies(&file)
+
+	node := g.nodes[file.Dir]
+	node.Dependencies = deps
+	node.RemoteDeps = remoteDeps
+	node.RemoteResources = remoteResources
+
+	if len(deps) > 0 {
+		slog.Debug("Found dependencies", "kustomization", file.Dir, "dependencies", deps)
+	}
+	if len(remoteDeps) > 0 {
+		slog.Debug("Found remote dependencies", "kustomization", file.Dir, "remote_dependencies", remoteDeps)
+	}
+
+	// For each dependency, mark it as a base and add reverse lookup
+	for _, dep := range deps {
+		absDepPath := g.resolveDependency(file.Dir, dep)
+
+		// Check if this dependency is a kustomization directory
+		if depNode, exists := g.nodes[absDepPath]; exists {
+			depNode.IsBase = true
+			g.reverseLookup[absDepPath] = append(g.reverseLookup[absDepPath], file.Dir)
+			slog.Debug("Added reverse lookup",
+				"base", absDepPath,
+				"dependent", file.Dir)
+		} else {
+			slog.Debug("Dependency not found in discovered kustomizations",
+				"dependency", absDepPath,
+				"referenced_by", file.Dir)
+		}
+	}
+}
+
+// resolveDependency returns the absolute path of a dependency of the kustomization in dir
+func (g *DependencyGraph) resolveDependency(dir, dep string) string {
+	absDepPath := filepath.Clean(filepath.Join(dir, dep))
 
+	// Symlinked bases are discovered at their real location
+	if _, exists := g.nodes[absDepPath]; !exists {
+		if realPath, err := filepath.EvalSymlinks(absDepPath); err == nil {
+			absDepPath = realPath
+		}
+	}
+	return absDepPath
+}
+
+// extractDependencies extracts all dependency paths from a kustomization file.
+// Local directory references are returned as deps, remote references
+// (git URLs, HTTP URLs, etc.) are returned separately as remoteDeps, and
+// manifests downloaded over HTTP(S) as remoteResources.
+func (g *DependencyGraph) extractDependencies(file *discovery.KustomizeFile) (deps, remoteDeps, remoteResources []string) {
 	// Check resources for kustomization directories
 	for _, resource := range file.Resources {
-		// Skip if it's a file (has extension)
-		if filepath.Ext(resource) != "" {
+		// Remote references must be checked first, "?ref=v1.2.3" looks like an extension
+		if discovery.IsRemoteResource(resource) {
+			remoteResources = append(remoteResources, resource)
+			continue
+		}
+		if discovery.IsRemoteRef(resource) {
+			remoteDeps = append(remoteDeps, resource)
+			continue
+		}
+
+		// Skip if it's a file (has extension) or a glob pattern of files
+		if filepath.Ext(resource) != "" || pathglob.HasMeta(resource) {
 			continue
 		}
 
@@ -107,13 +173,58 @@ func (g *DependencyGraph) extractDependencies(file *discovery.KustomizeFile) []s
 		deps = append(deps, resource)
 	}
 
-	// Add deprecated bases field
-	deps = append(deps, file.Bases...)
+	// Add deprecated bases field and components
+	for _, ref := range append(append([]string{}, file.Bases...), file.Components...) {
+		if discovery.IsRemoteRef(ref) {
+			remoteDeps = append(remoteDeps, ref)
+			continue
+		}
+		deps = append(deps, ref)
+	}
+
+	// Transformer and generator directories are kustomizations too, files are handled by the analyzer
+	for _, ref := range append(append([]string{}, file.Transformers...), file.Generators...) {
+		if discovery.IsRemoteRef(ref) {
+			remoteDeps = append(remoteDeps, ref)
+			continue
+		}
+		if filepath.Ext(ref) == "" {
+			deps = append(deps, ref)
+		}
+	}
+
+	return deps, remoteDeps, remoteResources
+}
+
+// extractFiles returns the absolute paths of all local files a kustomization reads directly:
+// the kustomization file itself, file resources, transformer and generator configs,
+// patches, generator inputs, schema files and helm values files
+func extractFiles(file *discovery.KustomizeFile) []string {
+	var files []string
+	if file.Path != "" {
+		files = append(files, file.Path)
+	}
 
-	// Add components
-	deps = append(deps, file.Components...)
+	fileRefs := append(append(append([]string{}, file.Resources...), file.Transformers...), file.Generators...)
+	for _, ref := range fileRefs {
+		if discovery.IsRemoteRef(ref) || filepath.Ext(ref) == "" {
+			continue
+		}
+		files = append(files, filepath.Clean(filepath.Join(file.Dir, ref)))
+	}
+
+	for _, ref := range append(append(append([]string{}, file.Patches...), file.GeneratorFiles...), file.SchemaFiles...) {
+		files = append(files, filepath.Clean(filepath.Join(file.Dir, ref)))
+	}
+
+	// Values files can also be fetched over HTTP
+	for _, ref := range file.HelmValues {
+		if !discovery.IsRemoteRef(ref) {
+			files = append(files, filepath.Clean(filepath.Join(file.Dir, ref)))
+		}
+	}
 
-	return deps
+	return files
 }
 
 // GetDependentOverlays returns all overlays that depend on the given base path
@@ -121,29 +232,44 @@ func (g *DependencyGraph) GetDependentOverlays(basePath string) []string {
 	basePath = filepath.Clean(basePath)
 
 	if overlays, exists := g.reverseLookup[basePath]; exists {
-		// Return a copy to prevent external modification
+		// Return a sorted copy to prevent external modification and keep the order stable
 		result := make([]string, len(overlays))
 		copy(result, overlays)
+		sort.Strings(result)
 		return result
 	}
 
 	return []string{}
 }
 
-// GetAllDependents recursively returns all kustomizations that depend on the given path
+// GetAllDependents recursively returns all kustomizations that depend on the given path, sorted
 // This traverses up the dependency tree to find all consumers (direct and indirect)
 func (g *DependencyGraph) GetAllDependents(path string) []string {
+	return g.GetDependentsWithinDepth(path, -1)
+}
+
+// GetDependentsWithinDepth returns the kustomizations that depend on the given path through
+// at most maxDepth levels, sorted, 1 only returns direct dependents. A negative maxDepth is unlimited.
+func (g *DependencyGraph) GetDependentsWithinDepth(path string, maxDepth int) []string {
 	path = filepath.Clean(path)
 
-	visited := make(map[string]bool)
+	// Shortest depth each dependent was reached at
+	visited := make(map[string]int)
 	result := []string{}
 
-	slog.Debug("Finding all dependents", "path", path)
+	slog.Debug("Finding all dependents", "path", path, "max_depth", maxDepth)
 
 	// Recursive helper function
-	var collectDependents func(currentPath string)
-	collectDependents = func(currentPath string) {
+	var collectDependents func(currentPath string, depth int)
+	collectDependents = func(currentPath string, depth int) {
 		currentPath = filepath.Clean(currentPath)
+		if maxDepth >= 0 && depth >= maxDepth {
+			return
+		}
+		if node, exists := g.nodes[currentPath]; exists && node.NoFanout {
+			slog.Debug("Not propagating to dependents of no-fanout kustomization", "path", currentPath)
+			return
+		}
 
 		// Get direct dependents
 		if dependents, exists := g.reverseLookup[currentPath]; exists {
@@ -154,22 +280,28 @@ func (g *DependencyGraph) GetAllDependents(path string) []string {
 			for _, dependent := range dependents {
 				dependent = filepath.Clean(dependent)
 
-				// Avoid cycles
-				if visited[dependent] {
+				// Avoid cycles, but revisit a dependent reached through a shorter path
+				// when limited so its own dependents aren't cut off too early
+				prev, seen := visited[dependent]
+				if seen && (maxDepth < 0 || prev <= depth+1) {
 					slog.Debug("Skipping already visited dependent", "path", dependent)
 					continue
 				}
 
-				visited[dependent] = true
-				result = append(result, dependent)
+				visited[dependent] = depth + 1
+				if !seen {
+					result = append(result, dependent)
+				}
 
 				// Recursively get dependents of this dependent
-				collectDependents(dependent)
+				collectDependents(dependent, depth+1)
 			}
 		}
 	}
 
-	collectDependents(path)
+	collectDependents(path, 0)
+	// The traversal order follows the order kustomizations were linked in
+	sort.Strings(result)
 
 	slog.Debug("All dependents found",
 		"path", path,
@@ -178,6 +310,122 @@ func (g *DependencyGraph) GetAllDependents(path string) []string {
 	return result
 }
 
+// GetInputClosure returns every file and directory the kustomization at path pulls in,
+// following bases and components recursively. Directory dependencies that aren't
+// kustomizations themselves are returned as directories.
+func (g *DependencyGraph) GetInputClosure(path string) []string {
+	path = filepath.Clean(path)
+
+	visited := make(map[string]bool)
+	inputs := make(map[string]bool)
+
+	var collectInputs func(currentPath string)
+	collectInputs = func(currentPath string) {
+		// Avoid cycles
+		if visited[currentPath] {
+			return
+		}
+		visited[currentPath] = true
+
+		node, exists := g.nodes[currentPath]
+		if !exists {
+			// Plain directory of manifests
+			inputs[currentPath] = true
+			return
+		}
+
+		inputs[currentPath] = true
+		for _, file := range node.Files {
+			inputs[file] = true
+		}
+
+		for _, dep := range node.Dependencies {
+			collectInputs(g.resolveDependency(node.Path, dep))
+		}
+	}
+
+	collectInputs(path)
+
+	result := make([]string, 0, len(inputs))
+	for input := range inputs {
+		result = append(result, input)
+	}
+	sort.Strings(result)
+
+	slog.Debug("Input closure computed", "path", path, "inputs", len(result))
+
+	return result
+}
+
+// DetectCycles returns every dependency cycle in the graph as the sequence of node paths
+// forming it, starting at the lexicographically smallest path of the cycle
+func (g *DependencyGraph) DetectCycles() [][]string {
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+
+	state := make(map[string]int)
+	var stack []string
+	var cycles [][]string
+	seen := make(map[string]bool)
+
+	var visit func(path string)
+	visit = func(path string) {
+		state[path] = inProgress
+		stack = append(stack, path)
+
+		for _, dep := range g.resolveDependencies(g.nodes[path]) {
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case inProgress:
+				// Found a back edge, the cycle is the stack from dep onwards
+				start := len(stack) - 1
+				for stack[start] != dep {
+					start--
+				}
+				cycle := normalizeCycle(stack[start:])
+				if key := strings.Join(cycle, "\x00"); !seen[key] {
+					seen[key] = true
+					cycles = append(cycles, cycle)
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[path] = done
+	}
+
+	for _, path := range g.sortedPaths() {
+		if state[path] == unvisited {
+			visit(path)
+		}
+	}
+
+	if len(cycles) > 0 {
+		slog.Debug("Dependency cycles detected", "cycles", cycles)
+	}
+
+	return cycles
+}
+
+// normalizeCycle rotates a cycle to start at its smallest path so equal cycles compare equal
+func normalizeCycle(cycle []string) []string {
+	minIdx := 0
+	for i, path := range cycle {
+		if path < cycle[minIdx] {
+			minIdx = i
+		}
+	}
+
+	normalized := make([]string, 0, len(cycle))
+	normalized = append(normalized, cycle[minIdx:]...)
+	normalized = append(normalized, cycle[:minIdx]...)
+	return normalized
+}
+
 // IsBase checks if the given path is a base (used by other kustomizations)
 func (g *DependencyGraph) IsBase(path string) bool {
 	path = filepath.Clean(path)
@@ -195,6 +443,83 @@ func (g *DependencyGraph) GetNode(path string) *Node {
 	return g.nodes[path]
 }
 
+// SetNoFanout marks the kustomizations in paths as leaves whose changes don't propagate to
+// their dependents, clearing the mark on all other kustomizations
+func (g *DependencyGraph) SetNoFanout(paths []string) {
+	noFanout := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		noFanout[filepath.Clean(path)] = true
+	}
+	for path, node := range g.nodes {
+		node.NoFanout = noFanout[path]
+	}
+}
+
+// GetOrphans returns kustomizations that nothing depends on and that have no
+// dependencies themselves, which are often leftovers from deleted services
+func (g *DependencyGraph) GetOrphans() []string {
+	orphans := []string{}
+
+	for path, node := range g.nodes {
+		if len(node.Dependencies) > 0 || len(node.RemoteDeps) > 0 || len(node.RemoteResources) > 0 {
+			continue
+		}
+		if len(g.reverseLookup[path]) > 0 {
+			continue
+		}
+		orphans = append(orphans, path)
+	}
+
+	sort.Strings(orphans)
+	return orphans
+}
+
+// GetBuildRoots returns the kustomizations that are no base of another one, sorted. They're
+// what would be deployed, building them covers every base they pull in.
+func (g *DependencyGraph) GetBuildRoots() []string {
+	roots := []string{}
+
+	for path, node := range g.nodes {
+		if !node.IsBase {
+			roots = append(roots, path)
+		}
+	}
+
+	sort.Strings(roots)
+	return roots
+}
+
+// UnresolvedDependency is a local dependency of a kustomization that doesn't resolve to a
+// node, e.g. a typo, a deleted directory or a base outside the discovered tree
+type UnresolvedDependency struct {
+	Kustomization string // Directory of the kustomization declaring the dependency
+	Dependency    string // The dependency as written in the kustomization
+	Path          string // Absolute path the dependency resolves to
+}
+
+// GetUnresolved returns the dependencies that don't resolve to a node, sorted by
+// kustomization. Changes to what they point at never reach the kustomization.
+func (g *DependencyGraph) GetUnresolved() []UnresolvedDependency {
+	var unresolved []UnresolvedDependency
+
+	for path, node := range g.nodes {
+		for _, dep := range node.Dependencies {
+			absDepPath := g.resolveDependency(path, dep)
+			if _, exists := g.nodes[absDepPath]; !exists {
+				unresolved = append(unresolved, UnresolvedDependency{Kustomization: path, Dependency: dep, Path: absDepPath})
+			}
+		}
+	}
+
+	sort.Slice(unresolved, func(i, j int) bool {
+		if unresolved[i].Kustomization != unresolved[j].Kustomization {
+			return unresolved[i].Kustomization < unresolved[j].Kustomization
+		}
+		return unresolved[i].Dependency < unresolved[j].Dependency
+	})
+	return unresolved
+}
+
 // String provides a human-readable representation of the graph
 func (g *DependencyGraph) String() string {
 	var sb strings.Builder
@@ -215,6 +540,20 @@ func (g *DependencyGraph) String() string {
 			}
 		}
 
+		if len(node.RemoteDeps) > 0 {
+			sb.WriteString("    Remote dependencies:\n")
+			for _, dep := range node.RemoteDeps {
+				sb.WriteString(fmt.Sprintf("      - %s\n", dep))
+			}
+		}
+
+		if len(node.RemoteResources) > 0 {
+			sb.WriteString("    Remote resources:\n")
+			for _, resource := range node.RemoteResources {
+				sb.WriteString(fmt.Sprintf("      - %s\n", resource))
+			}
+		}
+
 		if overlays := g.GetDependentOverlays(path); len(overlays) > 0 {
 			sb.WriteString("    Used by:\n")
 			for _, overlay := range overlays {
@@ -225,3 +564,132 @@ func (g *DependencyGraph) String() string {
 
 	return sb.String()
 }
+
+// ToDOT renders the graph in Graphviz DOT format, with edges pointing from overlay to base
+func (g *DependencyGraph) ToDOT() string {
+	paths := g.sortedPaths()
+
+	var sb strings.Builder
+	sb.WriteString("digraph kustomize {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [shape=box, style=rounded];\n")
+
+	for _, path := range paths {
+		if g.nodes[path].IsBase {
+			sb.WriteString(fmt.Sprintf("  %s [label=%s, shape=box3d, style=filled, fillcolor=lightblue];\n",
+				dotQuote(path), dotQuote(path+"\n[BASE]")))
+		} else {
+			sb.WriteString(fmt.Sprintf("  %s [label=%s];\n", dotQuote(path), dotQuote(path)))
+		}
+	}
+
+	for _, base := range paths {
+		dependents := g.GetDependentOverlays(base)
+		sort.Strings(dependents)
+		for _, dependent := range dependents {
+			sb.WriteString(fmt.Sprintf("  %s -> %s;\n", dotQuote(dependent), dotQuote(base)))
+		}
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// ToMermaid renders the graph as a Mermaid flowchart, with edges pointing from overlay to base.
+// When paths are given, only those nodes and the bases they depend on are included,
+// to keep the diagram readable on large repositories.
+func (g *DependencyGraph) ToMermaid(paths ...string) string {
+	included := make(map[string]bool)
+	if len(paths) == 0 {
+		for path := range g.nodes {
+			included[path] = true
+		}
+	}
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if node, exists := g.nodes[path]; exists {
+			included[path] = true
+			for _, dep := range g.resolveDependencies(node) {
+				included[dep] = true
+			}
+		}
+	}
+
+	// Assign stable IDs, since paths contain characters Mermaid doesn't accept in IDs
+	ids := make(map[string]string)
+	var sorted []string
+	for _, path := range g.sortedPaths() {
+		if included[path] {
+			ids[path] = fmt.Sprintf("n%d", len(sorted))
+			sorted = append(sorted, path)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("graph TD\n")
+
+	var bases []string
+	for _, path := range sorted {
+		sb.WriteString(fmt.Sprintf("  %s[\"%s\"]\n", ids[path], mermaidLabel(path)))
+		if g.nodes[path].IsBase {
+			bases = append(bases, ids[path])
+		}
+	}
+
+	for _, path := range sorted {
+		for _, dep := range g.resolveDependencies(g.nodes[path]) {
+			if included[dep] {
+				sb.WriteString(fmt.Sprintf("  %s --> %s\n", ids[path], ids[dep]))
+			}
+		}
+	}
+
+	if len(bases) > 0 {
+		sb.WriteString("  classDef base fill:#dbeafe,stroke:#2563eb\n")
+		sb.WriteString(fmt.Sprintf("  class %s base\n", strings.Join(bases, ",")))
+	}
+
+	return sb.String()
+}
+
+// resolveDependencies returns the absolute paths of the node's dependencies that are known nodes
+func (g *DependencyGraph) resolveDependencies(node *Node) []string {
+	var resolved []string
+	for _, dep := range node.Dependencies {
+		depPath := g.resolveDependency(node.Path, dep)
+		if _, exists := g.nodes[depPath]; exists {
+			resolved = append(resolved, depPath)
+		}
+	}
+	sort.Strings(resolved)
+	return resolved
+}
+
+// mermaidLabel escapes characters that would break a quoted Mermaid label
+func mermaidLabel(s string) string {
+	return strings.NewReplacer(
+		`"`, "#quot;",
+		"<", "#lt;",
+		">", "#gt;",
+		"\n", " ",
+	).Replace(s)
+}
+
+// sortedPaths returns all node paths in lexicographic order
+func (g *DependencyGraph) sortedPaths() []string {
+	paths := make([]string, 0, len(g.nodes))
+	for path := range g.nodes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// dotQuote quotes a string as a DOT ID.
+// Newlines are rendered as DOT line breaks.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
@@ -1,7 +1,10 @@
 package graph
 
 import (
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/michielvha/kustomize-build-check/internal/discovery"
@@ -55,12 +58,13 @@ func TestGetDependentOverlays(t *testing.T) {
 			Dir:       "/test/base",
 			Resources: []string{},
 		},
+		// Linked out of order, the result is sorted regardless
 		{
-			Dir:       "/test/overlay1",
+			Dir:       "/test/overlay2",
 			Resources: []string{"../base"},
 		},
 		{
-			Dir:       "/test/overlay2",
+			Dir:       "/test/overlay1",
 			Resources: []string{"../base"},
 		},
 		{
@@ -75,25 +79,8 @@ func TestGetDependentOverlays(t *testing.T) {
 	}
 
 	overlays := g.GetDependentOverlays("/test/base")
-
-	if len(overlays) != 2 {
-		t.Errorf("expected 2 overlays, got %d", len(overlays))
-	}
-
-	// Verify both overlays are in the list
-	found1, found2 := false, false
-	for _, overlay := range overlays {
-		cleanOverlay := filepath.Clean(overlay)
-		if cleanOverlay == "/test/overlay1" {
-			found1 = true
-		}
-		if cleanOverlay == "/test/overlay2" {
-			found2 = true
-		}
-	}
-
-	if !found1 || !found2 {
-		t.Error("expected to find both overlay1 and overlay2")
+	if want := []string{"/test/overlay1", "/test/overlay2"}; !slices.Equal(overlays, want) {
+		t.Errorf("GetDependentOverlays() = %v, want %v", overlays, want)
 	}
 }
 
@@ -136,7 +123,7 @@ func TestExtractDependencies(t *testing.T) {
 		Components: []string{"../../components/monitoring"},
 	}
 
-	deps := g.extractDependencies(file)
+	deps, _, _ := g.extractDependencies(file)
 
 	// Should have: ../base (from resources), ../../common (from bases), ../../components/monitoring (from components)
 	// Should NOT have: deployment.yaml, service.yaml (they have extensions)
@@ -146,6 +133,116 @@ func TestExtractDependencies(t *testing.T) {
 	}
 }
 
+func TestRemoteBasesNotResolvedLocally(t *testing.T) {
+	files := []discovery.KustomizeFile{
+		{
+			// A local directory that happens to match where a mangled remote ref would resolve
+			Dir:       "/test/overlay/github.com/org/repo/base",
+			Resources: []string{"deployment.yaml"},
+		},
+		{
+			Dir: "/test/overlay",
+			Resources: []string{
+				"github.com/org/repo//overlays/base?ref=v1.2.3",
+				"github.com/org/repo/base",
+			},
+			Bases:      []string{"git::https://gitlab.com/org/repo.git//base"},
+			Components: []string{"git@github.com:org/repo.git/components/monitoring"},
+		},
+	}
+
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	node := g.GetNode("/test/overlay")
+	if node == nil {
+		t.Fatal("expected overlay node to exist")
+	}
+
+	if len(node.Dependencies) != 0 {
+		t.Errorf("expected no local dependencies, got %v", node.Dependencies)
+	}
+
+	if len(node.RemoteDeps) != 4 {
+		t.Errorf("expected 4 remote dependencies, got %d: %v", len(node.RemoteDeps), node.RemoteDeps)
+	}
+
+	if g.IsBase("/test/overlay/github.com/org/repo/base") {
+		t.Error("expected remote base to not be treated as a local base node")
+	}
+}
+
+func TestRemoteResources(t *testing.T) {
+	files := []discovery.KustomizeFile{
+		{
+			Dir: "/test/overlay",
+			Resources: []string{
+				"https://example.com/manifests",
+				"https://github.com/org/repo/releases/download/v1.0.0/install.yaml",
+				"../base",
+			},
+		},
+		{Dir: "/test/base", Resources: []string{"deployment.yaml"}},
+	}
+
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	node := g.GetNode("/test/overlay")
+	if want := []string{"../base"}; !slices.Equal(node.Dependencies, want) {
+		t.Errorf("Dependencies = %v, want %v", node.Dependencies, want)
+	}
+	if len(node.RemoteDeps) != 0 {
+		t.Errorf("expected no remote bases, got %v", node.RemoteDeps)
+	}
+	want := []string{"https://example.com/manifests", "https://github.com/org/repo/releases/download/v1.0.0/install.yaml"}
+	if !slices.Equal(node.RemoteResources, want) {
+		t.Errorf("RemoteResources = %v, want %v", node.RemoteResources, want)
+	}
+	if unresolved := g.GetUnresolved(); len(unresolved) != 0 {
+		t.Errorf("expected remote resources to not be unresolved dependencies, got %v", unresolved)
+	}
+	for _, file := range node.Files {
+		if strings.Contains(file, "example.com") {
+			t.Errorf("expected remote resources to not be local files, got %v", node.Files)
+		}
+	}
+}
+
+func TestTransformerDirectoryIsDependency(t *testing.T) {
+	files := []discovery.KustomizeFile{
+		{Dir: "/test/transformers/labels", Resources: []string{"labels.yaml"}},
+		{
+			Dir:          "/test/overlay",
+			Resources:    []string{"deployment.yaml"},
+			Transformers: []string{"../transformers/labels"},
+			Generators:   []string{"generator.yaml"},
+		},
+	}
+
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	if !g.IsBase("/test/transformers/labels") {
+		t.Error("expected transformer directory to be treated as a base")
+	}
+
+	dependents := g.GetAllDependents("/test/transformers/labels")
+	if len(dependents) != 1 || dependents[0] != "/test/overlay" {
+		t.Errorf("expected overlay to depend on transformer, got %v", dependents)
+	}
+
+	if node := g.GetNode("/test/overlay"); len(node.Dependencies) != 1 {
+		t.Errorf("expected generator file to not be a directory dependency, got %v", node.Dependencies)
+	}
+}
+
 func TestGetAllDependents(t *testing.T) {
 	// Test recursive dependent lookup
 	// Structure: base -> overlay1 -> overlay2
@@ -174,49 +271,94 @@ func TestGetAllDependents(t *testing.T) {
 		t.Fatalf("Build failed: %v", err)
 	}
 
-	// When base changes, all dependents should be affected
+	// When base changes, all dependents should be affected, in sorted order
+	// rather than the order they were reached in
 	allDependents := g.GetAllDependents("/test/base")
+	if want := []string{"/test/overlay1", "/test/overlay2", "/test/overlay3"}; !slices.Equal(allDependents, want) {
+		t.Errorf("GetAllDependents() = %v, want %v", allDependents, want)
+	}
 
-	// Should get: overlay1, overlay2 (via overlay1), overlay3
-	expectedCount := 3
-	if len(allDependents) != expectedCount {
-		t.Errorf("expected %d dependents for base, got %d: %v", expectedCount, len(allDependents), allDependents)
+	// When overlay1 changes, only overlay2 should be affected (not overlay3)
+	overlay1Dependents := g.GetAllDependents("/test/overlay1")
+	if len(overlay1Dependents) != 1 {
+		t.Errorf("expected 1 dependent for overlay1, got %d: %v", len(overlay1Dependents), overlay1Dependents)
 	}
 
-	// Verify all expected dependents are present
-	expectedDependents := map[string]bool{
-		"/test/overlay1": false,
-		"/test/overlay2": false,
-		"/test/overlay3": false,
+	if filepath.Clean(overlay1Dependents[0]) != "/test/overlay2" {
+		t.Errorf("expected overlay2 as dependent of overlay1, got %s", overlay1Dependents[0])
 	}
+}
 
-	for _, dep := range allDependents {
-		cleanDep := filepath.Clean(dep)
-		if _, exists := expectedDependents[cleanDep]; exists {
-			expectedDependents[cleanDep] = true
-		}
+func TestGetDependentsWithinDepth(t *testing.T) {
+	// Structure: base -> overlay1 -> overlay2
+	files := []discovery.KustomizeFile{
+		{Dir: "/test/base", Resources: []string{"deployment.yaml"}},
+		{Dir: "/test/overlay1", Resources: []string{"../base"}},
+		{Dir: "/test/overlay2", Resources: []string{"../overlay1"}},
 	}
 
-	for path, found := range expectedDependents {
-		if !found {
-			t.Errorf("expected to find dependent %s", path)
-		}
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
 	}
 
-	// When overlay1 changes, only overlay2 should be affected (not overlay3)
-	overlay1Dependents := g.GetAllDependents("/test/overlay1")
-	if len(overlay1Dependents) != 1 {
-		t.Errorf("expected 1 dependent for overlay1, got %d: %v", len(overlay1Dependents), overlay1Dependents)
+	if got := g.GetDependentsWithinDepth("/test/base", 1); strings.Join(got, ",") != "/test/overlay1" {
+		t.Errorf("expected only overlay1 at depth 1, got %v", got)
+	}
+	if got := g.GetDependentsWithinDepth("/test/base", 2); len(got) != 2 {
+		t.Errorf("expected overlay1 and overlay2 at depth 2, got %v", got)
 	}
+	if got := g.GetDependentsWithinDepth("/test/base", 0); len(got) != 0 {
+		t.Errorf("expected no dependents at depth 0, got %v", got)
+	}
+}
 
-	if filepath.Clean(overlay1Dependents[0]) != "/test/overlay2" {
-		t.Errorf("expected overlay2 as dependent of overlay1, got %s", overlay1Dependents[0])
+func TestGetAllDependentsNoFanout(t *testing.T) {
+	// Structure: base -> overlay1 -> overlay2, with overlay1 not fanning out
+	files := []discovery.KustomizeFile{
+		{Dir: "/test/base", Resources: []string{"deployment.yaml"}},
+		{Dir: "/test/overlay1", Resources: []string{"../base"}},
+		{Dir: "/test/overlay2", Resources: []string{"../overlay1"}},
+	}
+
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	g.SetNoFanout([]string{"/test/overlay1"})
+
+	if got := g.GetAllDependents("/test/base"); strings.Join(got, ",") != "/test/overlay1" {
+		t.Errorf("expected propagation to stop at overlay1, got %v", got)
+	}
+	if got := g.GetAllDependents("/test/overlay1"); len(got) != 0 {
+		t.Errorf("expected no dependents of a no-fanout kustomization, got %v", got)
+	}
+
+	g.SetNoFanout(nil)
+	if got := g.GetAllDependents("/test/base"); len(got) != 2 {
+		t.Errorf("expected overlay1 and overlay2 once the mark is cleared, got %v", got)
 	}
 }
 
-func TestGetAllDependentsNoCycles(t *testing.T) {
-	// Test that cycles don't cause infinite loops
-	// This shouldn't happen in real kustomize but we should handle it gracefully
+func TestGetDependentsWithinDepthShortestPath(t *testing.T) {
+	// c is reachable from a both directly and through b, its dependent d is
+	// within depth 2 through the direct edge even if the longer path is walked first
+	g := New().(*DependencyGraph)
+	g.reverseLookup = map[string][]string{
+		"/test/a": {"/test/b", "/test/c"},
+		"/test/b": {"/test/c"},
+		"/test/c": {"/test/d"},
+	}
+
+	got := g.GetDependentsWithinDepth("/test/a", 2)
+	if strings.Join(got, ",") != "/test/b,/test/c,/test/d" {
+		t.Errorf("expected b, c and d within depth 2, got %v", got)
+	}
+}
+
+// newCyclicGraph returns a graph where a -> b -> c -> a.
+// This shouldn't happen in real kustomize but we should handle it gracefully.
+func newCyclicGraph() *DependencyGraph {
 	g := New().(*DependencyGraph)
 
 	g.nodes = map[string]*Node{
@@ -231,6 +373,13 @@ func TestGetAllDependentsNoCycles(t *testing.T) {
 		"/test/c": {"/test/b"},
 	}
 
+	return g
+}
+
+func TestGetAllDependentsNoCycles(t *testing.T) {
+	// Test that cycles don't cause infinite loops
+	g := newCyclicGraph()
+
 	// Should not hang or panic
 	dependents := g.GetAllDependents("/test/a")
 
@@ -239,3 +388,289 @@ func TestGetAllDependentsNoCycles(t *testing.T) {
 		t.Errorf("cycle handling failed, got too many dependents: %d", len(dependents))
 	}
 }
+
+func TestGetOrphans(t *testing.T) {
+	files := []discovery.KustomizeFile{
+		{Dir: "/test/base", Resources: []string{"deployment.yaml"}},
+		{Dir: "/test/overlay", Resources: []string{"../base"}},
+		{Dir: "/test/leftover", Resources: []string{"deployment.yaml"}},
+		{Dir: "/test/remote", Resources: []string{"github.com/org/repo//base?ref=v1"}},
+	}
+
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	orphans := g.GetOrphans()
+	if len(orphans) != 1 || orphans[0] != "/test/leftover" {
+		t.Errorf("expected only /test/leftover to be an orphan, got %v", orphans)
+	}
+}
+
+func TestGetBuildRoots(t *testing.T) {
+	files := []discovery.KustomizeFile{
+		{Dir: "/test/base", Resources: []string{"deployment.yaml"}},
+		{Dir: "/test/overlays/prod", Resources: []string{"../../base"}},
+		{Dir: "/test/overlays/dev", Resources: []string{"../../base"}},
+		{Dir: "/test/standalone", Resources: []string{"deployment.yaml"}},
+	}
+
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	want := []string{"/test/overlays/dev", "/test/overlays/prod", "/test/standalone"}
+	if got := g.GetBuildRoots(); !slices.Equal(got, want) {
+		t.Errorf("GetBuildRoots() = %v, want %v", got, want)
+	}
+}
+
+func TestGetUnresolved(t *testing.T) {
+	files := []discovery.KustomizeFile{
+		{Dir: "/test/base", Resources: []string{"deployment.yaml"}},
+		{Dir: "/test/overlays/dev", Resources: []string{"../../base", "../../base-typo"}, Components: []string{"../../components/missing"}},
+		{Dir: "/test/remote", Resources: []string{"github.com/org/repo//base?ref=v1"}},
+	}
+
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	want := []UnresolvedDependency{
+		{Kustomization: "/test/overlays/dev", Dependency: "../../base-typo", Path: "/test/base-typo"},
+		{Kustomization: "/test/overlays/dev", Dependency: "../../components/missing", Path: "/test/components/missing"},
+	}
+	if got := g.GetUnresolved(); !slices.Equal(got, want) {
+		t.Errorf("GetUnresolved() = %+v, want %+v", got, want)
+	}
+}
+
+func TestToDOT(t *testing.T) {
+	files := []discovery.KustomizeFile{
+		{Dir: "/test/base", Resources: []string{"deployment.yaml"}},
+		{Dir: "/test/overlays/dev", Resources: []string{"../../base"}},
+	}
+
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	dot := g.ToDOT()
+
+	if !strings.HasPrefix(dot, "digraph kustomize {") {
+		t.Errorf("expected DOT digraph, got:\n%s", dot)
+	}
+
+	if !strings.Contains(dot, `"/test/overlays/dev" -> "/test/base";`) {
+		t.Errorf("expected edge from overlay to base, got:\n%s", dot)
+	}
+
+	if !strings.Contains(dot, `"/test/base" [label="/test/base\n[BASE]", shape=box3d`) {
+		t.Errorf("expected base node to be marked, got:\n%s", dot)
+	}
+
+	if dot != g.ToDOT() {
+		t.Error("expected DOT output to be stable across calls")
+	}
+}
+
+func TestToMermaid(t *testing.T) {
+	files := []discovery.KustomizeFile{
+		{Dir: "/test/base", Resources: []string{"deployment.yaml"}},
+		{Dir: "/test/overlays/dev", Resources: []string{"../../base"}},
+		{Dir: "/test/overlays/prod", Resources: []string{"../../base"}},
+		{Dir: "/test/unrelated", Resources: []string{"deployment.yaml"}},
+	}
+
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	mermaid := g.ToMermaid("/test/overlays/dev")
+
+	if !strings.HasPrefix(mermaid, "graph TD\n") {
+		t.Errorf("expected Mermaid graph TD, got:\n%s", mermaid)
+	}
+
+	// Only the affected overlay and its base should be rendered
+	if !strings.Contains(mermaid, `n0["/test/base"]`) || !strings.Contains(mermaid, `n1["/test/overlays/dev"]`) {
+		t.Errorf("expected base and dev overlay nodes, got:\n%s", mermaid)
+	}
+
+	if strings.Contains(mermaid, "/test/overlays/prod") || strings.Contains(mermaid, "/test/unrelated") {
+		t.Errorf("expected unrelated nodes to be left out, got:\n%s", mermaid)
+	}
+
+	if !strings.Contains(mermaid, "n1 --> n0") {
+		t.Errorf("expected edge from overlay to base, got:\n%s", mermaid)
+	}
+
+	if !strings.Contains(mermaid, "class n0 base") {
+		t.Errorf("expected base node to be styled, got:\n%s", mermaid)
+	}
+}
+
+func TestMermaidLabel(t *testing.T) {
+	if got := mermaidLabel(`/repo/"quoted"<dir>`); got != "/repo/#quot;quoted#quot;#lt;dir#gt;" {
+		t.Errorf("unexpected label: %s", got)
+	}
+}
+
+func TestGetInputClosure(t *testing.T) {
+	files := []discovery.KustomizeFile{
+		{
+			Path:      "/test/base/kustomization.yaml",
+			Dir:       "/test/base",
+			Resources: []string{"deployment.yaml", "../crds"},
+		},
+		{
+			Path:       "/test/overlay/kustomization.yaml",
+			Dir:        "/test/overlay",
+			Resources:  []string{"../base", "github.com/org/repo//base?ref=v1"},
+			Components: []string{"../components/monitoring"},
+			Patches:    []string{"patch.yaml"},
+		},
+		{
+			Path:           "/test/components/monitoring/kustomization.yaml",
+			Dir:            "/test/components/monitoring",
+			Resources:      []string{"../../overlay"}, // cycle back to the overlay
+			GeneratorFiles: []string{"config.env"},
+		},
+	}
+
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	closure := g.GetInputClosure("/test/overlay")
+
+	expected := []string{
+		"/test/base",
+		"/test/base/deployment.yaml",
+		"/test/base/kustomization.yaml",
+		"/test/components/monitoring",
+		"/test/components/monitoring/config.env",
+		"/test/components/monitoring/kustomization.yaml",
+		"/test/crds",
+		"/test/overlay",
+		"/test/overlay/kustomization.yaml",
+		"/test/overlay/patch.yaml",
+	}
+
+	if strings.Join(closure, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected closure:\n got: %v\nwant: %v", closure, expected)
+	}
+}
+
+func TestBuildResolvesSymlinkedBases(t *testing.T) {
+	tmpDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to resolve temp dir: %v", err)
+	}
+
+	common := filepath.Join(tmpDir, "common")
+	service := filepath.Join(tmpDir, "service")
+	for _, dir := range []string{common, service} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.Symlink(common, filepath.Join(service, "base")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	files := []discovery.KustomizeFile{
+		{Dir: common, Resources: []string{"deployment.yaml"}},
+		{Dir: service, Resources: []string{"base"}},
+	}
+
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	if !g.IsBase(common) {
+		t.Error("expected symlinked common directory to be marked as base")
+	}
+
+	closure := g.GetInputClosure(service)
+	if !slices.Contains(closure, filepath.Join(common, "deployment.yaml")) {
+		t.Errorf("expected the symlinked base's files in the input closure, got %v", closure)
+	}
+}
+
+func TestDetectCycles(t *testing.T) {
+	cycles := newCyclicGraph().DetectCycles()
+
+	if len(cycles) != 1 {
+		t.Fatalf("expected 1 cycle, got %d: %v", len(cycles), cycles)
+	}
+
+	if got := strings.Join(cycles[0], " -> "); got != "/test/a -> /test/b -> /test/c" {
+		t.Errorf("unexpected cycle: %s", got)
+	}
+}
+
+func TestDetectCyclesNone(t *testing.T) {
+	files := []discovery.KustomizeFile{
+		{Dir: "/test/base", Resources: []string{"deployment.yaml"}},
+		{Dir: "/test/overlay1", Resources: []string{"../base"}},
+		{Dir: "/test/overlay2", Resources: []string{"../overlay1", "../base"}},
+	}
+
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	if cycles := g.DetectCycles(); len(cycles) != 0 {
+		t.Errorf("expected no cycles, got %v", cycles)
+	}
+}
+
+func TestBuildLinksBasesAcrossRoots(t *testing.T) {
+	root := t.TempDir()
+
+	files := map[string]string{
+		"infra/k8s/base/kustomization.yaml":    "resources:\n  - deployment.yaml\n",
+		"deploy/overlay/kustomization.yaml":    "resources:\n  - ../../infra/k8s/base\n",
+		"infra/k8s/base/deployment.yaml":       "kind: Deployment\n",
+		"unrelated/ignored/kustomization.yaml": "resources: []\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	kustomizations, _, err := discovery.New().FindAllRoots([]string{filepath.Join(root, "deploy"), filepath.Join(root, "infra", "k8s")})
+	if err != nil {
+		t.Fatalf("FindAllRoots failed: %v", err)
+	}
+
+	g := New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	base, _ := filepath.Abs(filepath.Join(root, "infra", "k8s", "base"))
+	overlay, _ := filepath.Abs(filepath.Join(root, "deploy", "overlay"))
+
+	dependents := g.GetAllDependents(base)
+	if len(dependents) != 1 || dependents[0] != overlay {
+		t.Errorf("expected %s to depend on the base from the other root, got %v", overlay, dependents)
+	}
+	if g.GetNode(filepath.Join(root, "unrelated", "ignored")) != nil {
+		t.Error("kustomizations outside the roots should not be in the graph")
+	}
+}
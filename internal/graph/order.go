@@ -0,0 +1,94 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrCycle is returned by DeployOrder when kustomizations depend on each other in a cycle,
+// which leaves them without a valid order
+var ErrCycle = errors.New("dependency cycle")
+
+// DeployNode is a kustomization in deploy order with the ones it must be deployed after
+type DeployNode struct {
+	Path         string   `json:"path"`
+	Dependencies []string `json:"dependencies"`
+}
+
+// DeployOrder sorts paths topologically, so each kustomization comes after the ones in paths
+// it depends on, directly or through kustomizations outside paths. Dependencies only lists
+// kustomizations in paths, paths that aren't nodes are left out. The order is deterministic.
+func (g *DependencyGraph) DeployOrder(paths []string) ([]DeployNode, error) {
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+
+	wanted := make(map[string]bool)
+	for _, path := range paths {
+		wanted[filepath.Clean(path)] = true
+	}
+
+	state := make(map[string]int)
+	// The kustomizations in paths each node depends on, nearest first
+	reached := make(map[string][]string)
+	var stack []string
+	order := []DeployNode{}
+
+	var visit func(path string) error
+	visit = func(path string) error {
+		state[path] = inProgress
+		stack = append(stack, path)
+
+		var deps []string
+		for _, dep := range g.resolveDependencies(g.nodes[path]) {
+			switch state[dep] {
+			case unvisited:
+				if err := visit(dep); err != nil {
+					return err
+				}
+			case inProgress:
+				start := slices.Index(stack, dep)
+				cycle := normalizeCycle(stack[start:])
+				return fmt.Errorf("%w: %s -> %s", ErrCycle, strings.Join(cycle, " -> "), cycle[0])
+			}
+			// Kustomizations outside paths are collapsed into their own dependencies
+			if wanted[dep] {
+				deps = append(deps, dep)
+			} else {
+				deps = append(deps, reached[dep]...)
+			}
+		}
+		slices.Sort(deps)
+		deps = slices.Compact(deps)
+		reached[path] = deps
+
+		stack = stack[:len(stack)-1]
+		state[path] = done
+		if wanted[path] {
+			order = append(order, DeployNode{Path: path, Dependencies: append([]string{}, deps...)})
+		}
+		return nil
+	}
+
+	sorted := make([]string, 0, len(wanted))
+	for path := range wanted {
+		if _, exists := g.nodes[path]; exists {
+			sorted = append(sorted, path)
+		}
+	}
+	slices.Sort(sorted)
+	for _, path := range sorted {
+		if state[path] == unvisited {
+			if err := visit(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return order, nil
+}
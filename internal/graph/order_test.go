@@ -0,0 +1,94 @@
+package graph
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/michielvha/kustomize-build-check/internal/discovery"
+)
+
+func TestDeployOrder(t *testing.T) {
+	// overlays/dev -> mid -> base, with mid not affected, and an unrelated app
+	files := []discovery.KustomizeFile{
+		{Dir: "/test/overlays/dev", Resources: []string{"../../mid"}},
+		{Dir: "/test/mid", Resources: []string{"../base"}},
+		{Dir: "/test/base", Resources: []string{"deployment.yaml"}},
+		{Dir: "/test/app", Resources: []string{"deployment.yaml"}},
+	}
+
+	g := New()
+	if err := g.Build(files); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	order, err := g.DeployOrder([]string{"/test/overlays/dev", "/test/base", "/test/app", "/test/unknown"})
+	if err != nil {
+		t.Fatalf("DeployOrder failed: %v", err)
+	}
+	want := []DeployNode{
+		{Path: "/test/app", Dependencies: []string{}},
+		{Path: "/test/base", Dependencies: []string{}},
+		{Path: "/test/overlays/dev", Dependencies: []string{"/test/base"}},
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("DeployOrder() = %+v, want %+v", order, want)
+	}
+
+	if order, err := g.DeployOrder(nil); err != nil || len(order) != 0 || order == nil {
+		t.Errorf("expected an empty order for no paths, got %v, %v", order, err)
+	}
+}
+
+func TestDeployOrderSymlinkedBase(t *testing.T) {
+	tmpDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to resolve temp dir: %v", err)
+	}
+
+	// service/base links to common, which is discovered at its real location
+	common := filepath.Join(tmpDir, "common")
+	service := filepath.Join(tmpDir, "service")
+	for _, dir := range []string{common, service} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.Symlink(common, filepath.Join(service, "base")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	g := New()
+	if err := g.Build([]discovery.KustomizeFile{
+		{Dir: service, Resources: []string{"base"}},
+		{Dir: common, Resources: []string{"deployment.yaml"}},
+	}); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	order, err := g.DeployOrder([]string{service, common})
+	if err != nil {
+		t.Fatalf("DeployOrder failed: %v", err)
+	}
+	want := []DeployNode{
+		{Path: common, Dependencies: []string{}},
+		{Path: service, Dependencies: []string{common}},
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("DeployOrder() = %+v, want %+v", order, want)
+	}
+	if mermaid := g.ToMermaid(); !strings.Contains(mermaid, " --> ") {
+		t.Errorf("expected the symlinked edge in the diagram, got:\n%s", mermaid)
+	}
+}
+
+func TestDeployOrderCycle(t *testing.T) {
+	g := newCyclicGraph()
+
+	if _, err := g.DeployOrder([]string{"/test/a"}); !errors.Is(err, ErrCycle) {
+		t.Errorf("expected ErrCycle, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package helm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Repo is a Helm chart repository registered before building, so helmCharts can be fetched
+type Repo struct {
+	Name string
+	URL  string
+}
+
+// CacheHomeEnv is the environment variable pointing helm at its cache of repository indexes and charts
+const CacheHomeEnv = "HELM_CACHE_HOME"
+
+// homeEnvs are the helm directories kustomize replaces with a throw-away home for every build
+var homeEnvs = []string{"HELM_CONFIG_HOME", CacheHomeEnv, "HELM_DATA_HOME"}
+
+// commandName is the file name of the script written by WriteCommand
+const commandName = "kustomize-build-check-helm"
+
+// ErrHelmNotFound is returned by AddRepos when repositories were requested but helm isn't installed
+var ErrHelmNotFound = errors.New("helm not found")
+
+// ParseRepos parses name=url entries
+func ParseRepos(entries []string) ([]Repo, error) {
+	var repos []Repo
+	for _, entry := range entries {
+		name, repoURL, ok := strings.Cut(entry, "=")
+		name, repoURL = strings.TrimSpace(name), strings.TrimSpace(repoURL)
+		if !ok || name == "" || repoURL == "" {
+			return nil, fmt.Errorf("helm repository %q must be in name=url format", entry)
+		}
+		repos = append(repos, Repo{Name: name, URL: repoURL})
+	}
+	return repos, nil
+}
+
+// AddRepos registers repos with helm repo add and refreshes their indexes with a single helm repo update.
+// A non-empty cacheDir is used as HELM_CACHE_HOME, it should match the one the builds use.
+// Builds only see the repositories through the helm command written by WriteCommand.
+func AddRepos(ctx context.Context, repos []Repo, cacheDir string) error {
+	if len(repos) == 0 {
+		return nil
+	}
+	if _, err := exec.LookPath("helm"); err != nil {
+		return fmt.Errorf("%w, it is required to add helm-repos: %w", ErrHelmNotFound, err)
+	}
+
+	for _, repo := range repos {
+		slog.Info("Adding Helm repository", "name", repo.Name, "url", redactURL(repo.URL))
+		// Re-adding a repository from a previous run is not an error
+		if err := runHelm(ctx, cacheDir, "repo", "add", "--force-update", repo.Name, repo.URL); err != nil {
+			return fmt.Errorf("failed to add Helm repository %s: %w", repo.Name, err)
+		}
+	}
+
+	slog.Info("Updating Helm repositories", "count", len(repos))
+	if err := runHelm(ctx, cacheDir, "repo", "update"); err != nil {
+		return fmt.Errorf("failed to update Helm repositories: %w", err)
+	}
+
+	return nil
+}
+
+// WriteCommand writes a script to dir for kustomize's --helm-command. Kustomize runs helm with
+// HELM_CONFIG_HOME, HELM_CACHE_HOME and HELM_DATA_HOME pointing at a temporary directory per
+// build, so neither a shared cache nor repositories added with AddRepos would be seen. The
+// script restores the values these variables have in env, or helm's defaults when unset, and
+// runs the helm found in PATH.
+func WriteCommand(dir string, env []string) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("#!/bin/sh\n")
+	for _, name := range homeEnvs {
+		if value, ok := lookupEnv(env, name); ok {
+			fmt.Fprintf(&sb, "export %s=%s\n", name, shellQuote(value))
+		} else {
+			fmt.Fprintf(&sb, "unset %s\n", name)
+		}
+	}
+	sb.WriteString("exec helm \"$@\"\n")
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create helm command directory: %w", err)
+	}
+	path := filepath.Join(dir, commandName)
+	if err := os.WriteFile(path, []byte(sb.String()), 0o755); err != nil {
+		return "", fmt.Errorf("failed to write helm command: %w", err)
+	}
+	return path, nil
+}
+
+// lookupEnv returns the last value of name in env, which is the one a process sees
+func lookupEnv(env []string, name string) (string, bool) {
+	for i := len(env) - 1; i >= 0; i-- {
+		if value, ok := strings.CutPrefix(env[i], name+"="); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// shellQuote quotes s as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// redactURL hides credentials embedded in a repository URL
+func redactURL(repoURL string) string {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return repoURL
+	}
+	return u.Redacted()
+}
+
+// runHelm runs a helm command, including its stderr in the error
+func runHelm(ctx context.Context, cacheDir string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "helm", args...)
+	if cacheDir != "" {
+		cmd.Env = append(os.Environ(), CacheHomeEnv+"="+cacheDir)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w\nStderr: %s", err, stderr.String())
+	}
+	return nil
+}
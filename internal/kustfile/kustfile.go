@@ -0,0 +1,19 @@
+package kustfile
+
+import (
+	"slices"
+	"strings"
+)
+
+// Names are the kustomization file names kustomize looks for, in its order of preference
+var Names = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// Match reports whether the file name is a kustomization file: one of Names, the .yaml and
+// .yml extension matching in any case, or one of extraNames
+func Match(name string, extraNames ...string) bool {
+	if slices.Contains(Names, name) || slices.Contains(extraNames, name) {
+		return true
+	}
+	stem, ext, found := strings.Cut(name, ".")
+	return found && stem == "kustomization" && (strings.EqualFold(ext, "yaml") || strings.EqualFold(ext, "yml"))
+}
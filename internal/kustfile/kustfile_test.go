@@ -0,0 +1,31 @@
+package kustfile
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		filename   string
+		extraNames []string
+		want       bool
+	}{
+		{"standard yaml", "kustomization.yaml", nil, true},
+		{"standard yml", "kustomization.yml", nil, true},
+		{"capital K", "Kustomization", nil, true},
+		{"uppercase extension", "kustomization.YAML", nil, true},
+		{"mixed case extension", "kustomization.Yml", nil, true},
+		{"random yaml", "deployment.yaml", nil, false},
+		{"wrong name", "kustomize.yaml", nil, false},
+		{"double extension", "kustomization.yaml.bak", nil, false},
+		{"custom name", "kustomization.gen.yaml", []string{"kustomization.gen.yaml"}, true},
+		{"custom name not configured", "kustomization.gen.yaml", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Match(tt.filename, tt.extraNames...); got != tt.want {
+				t.Errorf("Match(%q, %v) = %v, want %v", tt.filename, tt.extraNames, got, tt.want)
+			}
+		})
+	}
+}
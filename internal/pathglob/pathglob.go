@@ -0,0 +1,127 @@
+package pathglob
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Match reports whether the slash-separated path matches the glob pattern.
+// It supports the path.Match syntax per segment, plus "**" matching zero
+// or more whole segments. Trailing slashes on the pattern are ignored.
+func Match(pattern, name string) bool {
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	name = strings.Trim(filepath.ToSlash(name), "/")
+
+	return matchSegments(splitSegments(pattern), splitSegments(name))
+}
+
+// MatchTree reports whether the path or any of its parent directories match the pattern,
+// so a pattern like "vendor" matches everything below vendor/
+func MatchTree(pattern, name string) bool {
+	name = strings.Trim(filepath.ToSlash(name), "/")
+
+	for {
+		if Match(pattern, name) {
+			return true
+		}
+
+		idx := strings.LastIndex(name, "/")
+		if idx < 0 {
+			return false
+		}
+		name = name[:idx]
+	}
+}
+
+// MatchAny reports whether the path matches any of the patterns
+func MatchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchAnyTree reports whether the path or any of its parents match any of the patterns
+func MatchAnyTree(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if MatchTree(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPrefix reports whether the path could be a parent directory of a path matching the pattern,
+// e.g. to decide whether a directory has to be walked to find matches
+func MatchPrefix(pattern, name string) bool {
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	name = strings.Trim(filepath.ToSlash(name), "/")
+
+	return matchPrefixSegments(splitSegments(pattern), splitSegments(name))
+}
+
+// HasMeta reports whether the path contains glob meta characters
+func HasMeta(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+func splitSegments(s string) []string {
+	if s == "" || s == "." {
+		return nil
+	}
+	return strings.Split(s, "/")
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse consecutive ** segments
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+
+	return len(name) == 0
+}
+
+func matchPrefixSegments(pattern, name []string) bool {
+	for len(name) > 0 {
+		if len(pattern) == 0 {
+			return false
+		}
+		// ** can absorb any number of leading directories
+		if pattern[0] == "**" {
+			return true
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return true
+}
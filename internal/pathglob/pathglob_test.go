@@ -0,0 +1,65 @@
+package pathglob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"k8s", "k8s", true},
+		{"k8s/", "k8s", true},
+		{"k8s/*/base", "k8s/app/base", true},
+		{"k8s/*/base", "k8s/app/overlays/base", false},
+		{"**/base", "base", true},
+		{"**/base", "k8s/app/base", true},
+		{"k8s/**", "k8s/app/base", true},
+		{"k8s/**/prod", "k8s/prod", true},
+		{"k8s/**/prod", "k8s/app/overlays/prod", true},
+		{"*.yaml", "configs/app.yaml", false},
+		{"configs/*.yaml", "configs/app.yaml", true},
+		{"vendor", "vendored", false},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTree(t *testing.T) {
+	if !MatchTree("vendor", "vendor/github.com/org/base") {
+		t.Error("expected vendor to match a path below vendor/")
+	}
+
+	if MatchTree("vendor", "app/vendored/base") {
+		t.Error("expected vendor to not match vendored/")
+	}
+
+	if !MatchTree("k8s/apps", "k8s/apps") {
+		t.Error("expected exact match")
+	}
+}
+
+func TestMatchPrefix(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{".deploy/base", ".deploy", true},
+		{".deploy/base", ".deploy/base", true},
+		{".deploy/base", ".config", false},
+		{"apps/*/prod", "apps/web", true},
+		{"**/prod", "apps/web", true},
+		{"apps/web", "apps/web/base", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchPrefix(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("MatchPrefix(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
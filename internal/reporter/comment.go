@@ -0,0 +1,184 @@
+package reporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michielvha/kustomize-build-check/internal/builder"
+)
+
+// commentMarker is a hidden HTML marker used to find the sticky comment on subsequent runs
+const commentMarker = "<!-- kustomize-build-check -->"
+
+// issueComment is the subset of the GitHub issue comment API object we need
+type issueComment struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+}
+
+// PostPullRequestComment creates or updates a single sticky comment on the
+// pull request with the same Markdown summary written to the step summary
+func (r *reporter) PostPullRequestComment(results []builder.BuildResult, token string) error {
+	results = r.redactResults(results)
+	if token == "" {
+		return fmt.Errorf("no GitHub token provided")
+	}
+
+	repo := os.Getenv("GITHUB_REPOSITORY")
+	if repo == "" {
+		return fmt.Errorf("GITHUB_REPOSITORY is not set")
+	}
+
+	prNumber, err := pullRequestNumber()
+	if err != nil {
+		return err
+	}
+
+	apiURL := strings.TrimSuffix(os.Getenv("GITHUB_API_URL"), "/")
+	if apiURL == "" {
+		apiURL = "https://api.github.com"
+	}
+
+	client := &githubClient{
+		http:  &http.Client{Timeout: 30 * time.Second},
+		token: token,
+	}
+
+	// Each shard keeps its own sticky comment
+	marker := commentMarker
+	if r.shardTotal > 1 {
+		marker = fmt.Sprintf("<!-- kustomize-build-check shard %d/%d -->", r.shardIndex, r.shardTotal)
+	}
+	body := marker + "\n" + r.renderMarkdownSummary(results)
+	commentsURL := fmt.Sprintf("%s/repos/%s/issues/%d/comments", apiURL, repo, prNumber)
+
+	existing, err := client.findComment(commentsURL, marker)
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]string{"body": body}
+	if existing != nil {
+		slog.Debug("Updating existing PR comment", "comment_id", existing.ID)
+		return client.do(http.MethodPatch, fmt.Sprintf("%s/repos/%s/issues/comments/%d", apiURL, repo, existing.ID), payload, nil)
+	}
+
+	slog.Debug("Creating PR comment", "pr", prNumber)
+	return client.do(http.MethodPost, commentsURL, payload, nil)
+}
+
+// pullRequestNumber determines the pull request number from the GitHub event payload or ref
+func pullRequestNumber() (int, error) {
+	if eventPath := os.Getenv("GITHUB_EVENT_PATH"); eventPath != "" {
+		data, err := os.ReadFile(eventPath)
+		if err == nil {
+			var event struct {
+				Number      int `json:"number"`
+				PullRequest struct {
+					Number int `json:"number"`
+				} `json:"pull_request"`
+			}
+			if err := json.Unmarshal(data, &event); err == nil {
+				if event.PullRequest.Number > 0 {
+					return event.PullRequest.Number, nil
+				}
+				if event.Number > 0 {
+					return event.Number, nil
+				}
+			}
+		}
+	}
+
+	// refs/pull/<number>/merge
+	ref := os.Getenv("GITHUB_REF")
+	if strings.HasPrefix(ref, "refs/pull/") {
+		parts := strings.Split(ref, "/")
+		if len(parts) >= 3 {
+			if n, err := strconv.Atoi(parts[2]); err == nil {
+				return n, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("could not determine pull request number, is this a pull_request event?")
+}
+
+// githubClient is a minimal GitHub REST API client
+type githubClient struct {
+	http  *http.Client
+	token string
+}
+
+// findComment returns the comment containing the marker, or nil if there is none
+func (c *githubClient) findComment(commentsURL, marker string) (*issueComment, error) {
+	for page := 1; ; page++ {
+		var comments []issueComment
+		url := fmt.Sprintf("%s?per_page=100&page=%d", commentsURL, page)
+		if err := c.do(http.MethodGet, url, nil, &comments); err != nil {
+			return nil, err
+		}
+
+		for i := range comments {
+			if strings.Contains(comments[i].Body, marker) {
+				return &comments[i], nil
+			}
+		}
+
+		if len(comments) < 100 {
+			return nil, nil
+		}
+	}
+}
+
+// do performs an API request, encoding payload and decoding the response into out when non-nil
+func (c *githubClient) do(method, url string, payload, out any) error {
+	var reqBody io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("GitHub API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("GitHub token lacks permission to comment on the pull request (needs pull-requests: write): %s", resp.Status)
+	case resp.StatusCode >= 300:
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GitHub API %s %s returned %s: %s", method, url, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode GitHub API response: %w", err)
+		}
+	}
+
+	return nil
+}
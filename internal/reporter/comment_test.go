@@ -0,0 +1,79 @@
+package reporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/michielvha/kustomize-build-check/internal/builder"
+)
+
+func TestPostPullRequestComment(t *testing.T) {
+	var comments []issueComment
+	var created, updated int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var payload map[string]string
+		switch {
+		case req.Method == http.MethodGet && req.URL.Path == "/repos/org/repo/issues/42/comments":
+			_ = json.NewEncoder(w).Encode(comments)
+		case req.Method == http.MethodPost && req.URL.Path == "/repos/org/repo/issues/42/comments":
+			_ = json.NewDecoder(req.Body).Decode(&payload)
+			comments = append(comments, issueComment{ID: 1, Body: payload["body"]})
+			created++
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("{}"))
+		case req.Method == http.MethodPatch && req.URL.Path == "/repos/org/repo/issues/comments/1":
+			_ = json.NewDecoder(req.Body).Decode(&payload)
+			comments[0].Body = payload["body"]
+			updated++
+			_, _ = w.Write([]byte("{}"))
+		default:
+			t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("GITHUB_API_URL", server.URL)
+	t.Setenv("GITHUB_REPOSITORY", "org/repo")
+	t.Setenv("GITHUB_EVENT_PATH", "")
+	t.Setenv("GITHUB_REF", "refs/pull/42/merge")
+
+	r := New()
+	results := []builder.BuildResult{{Path: "/repo/overlays/dev", Success: true}}
+
+	// First run creates the comment, second run updates it in place
+	for i := 0; i < 2; i++ {
+		if err := r.PostPullRequestComment(results, "token"); err != nil {
+			t.Fatalf("PostPullRequestComment failed: %v", err)
+		}
+	}
+
+	if created != 1 || updated != 1 {
+		t.Errorf("expected 1 create and 1 update, got %d and %d", created, updated)
+	}
+
+	if len(comments) != 1 || !strings.HasPrefix(comments[0].Body, commentMarker) {
+		t.Errorf("expected a single comment with the marker, got %+v", comments)
+	}
+}
+
+func TestPostPullRequestCommentForbidden(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	t.Setenv("GITHUB_API_URL", server.URL)
+	t.Setenv("GITHUB_REPOSITORY", "org/repo")
+	t.Setenv("GITHUB_EVENT_PATH", "")
+	t.Setenv("GITHUB_REF", "refs/pull/42/merge")
+
+	err := New().PostPullRequestComment(nil, "token")
+	if err == nil || !strings.Contains(err.Error(), "lacks permission") {
+		t.Errorf("expected permission error, got %v", err)
+	}
+}
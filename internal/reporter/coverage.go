@@ -0,0 +1,132 @@
+package reporter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// CoverageStatus tells whether an affected kustomization was exercised
+type CoverageStatus string
+
+const (
+	CoverageBuilt   CoverageStatus = "built"
+	CoverageSkipped CoverageStatus = "skipped"
+)
+
+// Coverage records for the changes of a run which affected kustomizations were built and
+// which were skipped, so auditors can verify every affected overlay was exercised
+type Coverage struct {
+	// ChangedFilesHash is the SHA-256 of the sorted names of the changed files the affected
+	// set was computed from. It doesn't cover their contents, two diffs touching the same
+	// files have the same hash.
+	ChangedFilesHash string `json:"changedFilesHash"`
+	// BaseCommit and HeadCommit are the resolved commits the changes were diffed between,
+	// identifying the diff itself. They're empty when the changed files were given directly.
+	BaseCommit string         `json:"baseCommit,omitempty"`
+	HeadCommit string         `json:"headCommit,omitempty"`
+	Paths      []CoveragePath `json:"paths"`
+}
+
+// CoveragePath is the coverage of a single kustomization
+type CoveragePath struct {
+	Path   string         `json:"path"`
+	Status CoverageStatus `json:"status"`
+	Reason SkipReason     `json:"reason,omitempty"`
+}
+
+// NewCoverage computes the coverage of the affected and skipped kustomizations. Paths are
+// sorted so the same changes always produce the same coverage.
+func NewCoverage(changedFiles, affected []string, skipped []Skipped) Coverage {
+	sortedFiles := append([]string{}, changedFiles...)
+	sort.Strings(sortedFiles)
+	hash := sha256.New()
+	for _, file := range sortedFiles {
+		fmt.Fprintln(hash, file)
+	}
+
+	statuses := make(map[string]CoveragePath)
+	for _, path := range affected {
+		statuses[path] = CoveragePath{Path: path, Status: CoverageBuilt}
+	}
+	for _, s := range skipped {
+		statuses[s.Path] = CoveragePath{Path: s.Path, Status: CoverageSkipped, Reason: s.Reason}
+	}
+
+	coverage := Coverage{ChangedFilesHash: hex.EncodeToString(hash.Sum(nil)), Paths: make([]CoveragePath, 0, len(statuses))}
+	for _, status := range statuses {
+		coverage.Paths = append(coverage.Paths, status)
+	}
+	sort.Slice(coverage.Paths, func(i, j int) bool { return coverage.Paths[i].Path < coverage.Paths[j].Path })
+
+	return coverage
+}
+
+// SetCoverage records the coverage of the run, it is included in the JSON report and
+// written to the step summary by WriteCoverageSummary
+func (r *reporter) SetCoverage(coverage Coverage) {
+	r.coverage = &coverage
+}
+
+// WriteCoverageSummary appends the coverage set with SetCoverage to GITHUB_STEP_SUMMARY
+func (r *reporter) WriteCoverageSummary() error {
+	if r.coverage == nil {
+		return nil
+	}
+
+	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryFile == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_STEP_SUMMARY: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(renderCoverageSummary(*r.coverage)); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+
+	return nil
+}
+
+// renderCoverageSummary renders the coverage as a Markdown table
+func renderCoverageSummary(coverage Coverage) string {
+	built := 0
+	for _, p := range coverage.Paths {
+		if p.Status == CoverageBuilt {
+			built++
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n### 🧾 Coverage\n\n")
+	changes := fmt.Sprintf("changed files `%s`", coverage.ChangedFilesHash)
+	if coverage.BaseCommit != "" && coverage.HeadCommit != "" {
+		changes = fmt.Sprintf("the changes `%s..%s`", shortCommit(coverage.BaseCommit), shortCommit(coverage.HeadCommit))
+	}
+	sb.WriteString(fmt.Sprintf("%d of %d affected kustomization(s) were built for %s.\n\n", built, len(coverage.Paths), changes))
+	if len(coverage.Paths) == 0 {
+		return sb.String()
+	}
+	sb.WriteString("| Path | Status |\n")
+	sb.WriteString("|------|--------|\n")
+	for _, p := range coverage.Paths {
+		status := string(p.Status)
+		if p.Reason != "" {
+			status = fmt.Sprintf("%s (%s)", status, p.Reason)
+		}
+		sb.WriteString(fmt.Sprintf("| %s | %s |\n", p.Path, status))
+	}
+	return sb.String()
+}
+
+// shortCommit abbreviates a commit SHA for display
+func shortCommit(sha string) string {
+	return sha[:min(len(sha), 12)]
+}
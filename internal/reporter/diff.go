@@ -0,0 +1,103 @@
+package reporter
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/michielvha/kustomize-build-check/internal/differ"
+)
+
+// maxDiffLines caps each rendered diff so a large change doesn't exhaust the 1MiB step summary limit
+const maxDiffLines = 500
+
+// WriteDiffSummary appends the rendered output diffs to GITHUB_STEP_SUMMARY, one collapsible section per path
+func (r *reporter) WriteDiffSummary(diffs []differ.Result) error {
+	diffs = r.redactDiffs(diffs)
+	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryFile == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_STEP_SUMMARY: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(renderDiffSummary(diffs)); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+
+	return nil
+}
+
+// renderDiffSummary renders the diffs as Markdown, unchanged kustomizations are listed without a section
+func renderDiffSummary(diffs []differ.Result) string {
+	var sb strings.Builder
+	sb.WriteString("\n### 📝 Rendered Diff\n\n")
+
+	var unchanged []string
+	for _, d := range diffs {
+		switch {
+		case d.Error != "":
+			sb.WriteString(fmt.Sprintf("- **%s**: diff failed: %s\n", d.Path, firstLine(d.Error)))
+		case d.Diff == "":
+			unchanged = append(unchanged, d.Path)
+		default:
+			added, removed := diffStat(d.Diff)
+			label := fmt.Sprintf("+%d -%d", added, removed)
+			if d.New {
+				label += ", new"
+			}
+			sb.WriteString(fmt.Sprintf("<details>\n<summary>%s (%s)</summary>\n\n", d.Path, label))
+			sb.WriteString("```diff\n")
+			sb.WriteString(truncateLines(d.Diff, maxDiffLines))
+			sb.WriteString("```\n\n</details>\n\n")
+		}
+	}
+
+	if len(unchanged) > 0 {
+		sb.WriteString(fmt.Sprintf("%d kustomization(s) render unchanged output: %s\n", len(unchanged), strings.Join(unchanged, ", ")))
+	}
+	if len(diffs) == 0 {
+		sb.WriteString("No successful builds to diff\n")
+	}
+
+	return sb.String()
+}
+
+// diffStat counts the added and removed lines of a unified diff
+func diffStat(diff string) (added, removed int) {
+	// Skip the file header, a removed YAML document separator would look like one
+	if i := strings.Index(diff, "\n@@"); i >= 0 {
+		diff = diff[i+1:]
+	}
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// truncateLines keeps the first n lines of s, noting how many were dropped
+func truncateLines(s string, n int) string {
+	lines := strings.SplitAfter(s, "\n")
+	if len(lines) <= n {
+		if !strings.HasSuffix(s, "\n") {
+			s += "\n"
+		}
+		return s
+	}
+	return strings.Join(lines[:n], "") + fmt.Sprintf("... %d more lines\n", len(lines)-n)
+}
+
+// firstLine returns the first line of s
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,37 @@
+package reporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/michielvha/kustomize-build-check/internal/builder"
+)
+
+// JSONLWriter streams build results as JSON Lines, one trimmed result per line, so log
+// processors can consume them while the builds are still running
+type JSONLWriter struct {
+	w      io.Writer
+	redact bool
+}
+
+// NewJSONLWriter creates a JSONLWriter writing to w, masking secrets in errors when redact is set
+func NewJSONLWriter(w io.Writer, redact bool) *JSONLWriter {
+	return &JSONLWriter{w: w, redact: redact}
+}
+
+// Write writes result as a single line. Each line is written with one call to the
+// underlying writer, so an unbuffered file sees it as soon as the build completes.
+func (j *JSONLWriter) Write(result builder.BuildResult) error {
+	if j.redact {
+		result.Error = redactSecrets(result.Error, false)
+	}
+	line, err := json.Marshal(newTrimmedResult(result))
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+	if _, err := j.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package reporter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+
+	"github.com/michielvha/kustomize-build-check/internal/builder"
+)
+
+// junitTestSuite is the root <testsuite> element of a JUnit XML report
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is a single <testcase> element, one per kustomization
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+// junitFailure is the <failure> element of a failed testcase
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnitReport writes the build results as a JUnit XML report to path
+func (r *reporter) WriteJUnitReport(results []builder.BuildResult, path string) error {
+	results = r.redactResults(results)
+	summary := r.GenerateSummary(results)
+
+	suite := junitTestSuite{
+		Name:      "kustomize-build-check",
+		Tests:     summary.Total,
+		Failures:  summary.Failed,
+		TestCases: make([]junitTestCase, 0, len(results)),
+	}
+
+	var totalSeconds float64
+	for _, result := range results {
+		totalSeconds += result.Duration.Seconds()
+
+		testCase := junitTestCase{
+			Name:      result.Path,
+			ClassName: "kustomize-build",
+			Time:      fmt.Sprintf("%.3f", result.Duration.Seconds()),
+		}
+
+		if !result.Success {
+			failure := &junitFailure{
+				Message: "kustomize build failed",
+				Type:    "BuildFailure",
+				Text:    result.Error,
+			}
+			if result.TimedOut {
+				failure.Message = fmt.Sprintf("kustomize build timed out after %.2fs", result.Duration.Seconds())
+				failure.Type = "Timeout"
+			}
+			testCase.Failure = failure
+		}
+
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	suite.Time = fmt.Sprintf("%.3f", totalSeconds)
+
+	// encoding/xml takes care of escaping the error text
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JUnit report: %w", err)
+	}
+
+	content := append([]byte(xml.Header), data...)
+	content = append(content, '\n')
+
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package reporter
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/michielvha/kustomize-build-check/internal/builder"
+	"github.com/michielvha/kustomize-build-check/internal/differ"
+)
+
+// redacted replaces secret values, matching the mask GitHub uses for secrets in logs
+const redacted = "***"
+
+// tokenPatterns match credentials that are recognizable regardless of where they appear
+var tokenPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36,}`),
+	regexp.MustCompile(`github_pat_[A-Za-z0-9_]{22,}`),
+	regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`xox[abposr]-[A-Za-z0-9-]{10,}`),
+	regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`),
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+}
+
+var (
+	secretKindPattern    = regexp.MustCompile(`^kind:\s*["']?Secret["']?\s*$`)
+	secretSectionPattern = regexp.MustCompile(`^(data|stringData):(.*)$`)
+	secretEntryPattern   = regexp.MustCompile(`^(\s+)([^\s:][^:]*:)(\s*)(.*)$`)
+)
+
+// redactResults returns copies of results with secrets masked in their output and error
+func (r *reporter) redactResults(results []builder.BuildResult) []builder.BuildResult {
+	if !r.redact {
+		return results
+	}
+	redactedResults := make([]builder.BuildResult, len(results))
+	for i, result := range results {
+		result.Output = redactSecrets(result.Output, false)
+		result.Error = redactSecrets(result.Error, false)
+		result.Stderr = redactSecrets(result.Stderr, false)
+		if result.Warnings != nil {
+			result.Warnings = slices.Clone(result.Warnings)
+			for j, warning := range result.Warnings {
+				result.Warnings[j] = redactSecrets(warning, false)
+			}
+		}
+		redactedResults[i] = result
+	}
+	return redactedResults
+}
+
+// redactDiffs returns copies of diffs with secrets masked in the rendered output
+func (r *reporter) redactDiffs(diffs []differ.Result) []differ.Result {
+	if !r.redact {
+		return diffs
+	}
+	redactedDiffs := make([]differ.Result, len(diffs))
+	for i, d := range diffs {
+		d.Diff = redactSecrets(d.Diff, true)
+		d.Error = redactSecrets(d.Error, false)
+		redactedDiffs[i] = d
+	}
+	return redactedDiffs
+}
+
+// redactSecrets masks the data and stringData values of rendered Secrets and anything matching
+// tokenPatterns. With diff set, lines carry a one-character unified diff prefix.
+func redactSecrets(text string, diff bool) string {
+	if text == "" {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	prefixes := make([]string, len(lines))
+	for i, line := range lines {
+		if diff && line != "" && !strings.HasPrefix(line, "@@") && !strings.HasPrefix(line, "+++") && !strings.HasPrefix(line, "--- a/") {
+			prefixes[i], lines[i] = line[:1], line[1:]
+		}
+	}
+
+	// Documents are redacted as a whole because kustomize sorts data before kind.
+	// A diff hunk may show a Secret's data without its kind, so hunks start a new document.
+	start := 0
+	for i := 0; i <= len(lines); i++ {
+		if i == len(lines) || lines[i] == "---" || (diff && strings.HasPrefix(lines[i], "@@")) {
+			redactSecretDocument(lines[start:i], diff)
+			start = i + 1
+		}
+	}
+
+	for i, line := range lines {
+		for _, pattern := range tokenPatterns {
+			line = pattern.ReplaceAllString(line, redacted)
+		}
+		lines[i] = prefixes[i] + line
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// redactSecretDocument masks the data and stringData values in place if lines are a Secret.
+// With partial set, lines may be a fragment and are treated as a Secret unless they show another kind.
+func redactSecretDocument(lines []string, partial bool) {
+	isSecret, hasKind := false, false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "kind:") {
+			hasKind = true
+			isSecret = secretKindPattern.MatchString(line)
+			break
+		}
+	}
+	if !isSecret && (hasKind || !partial) {
+		return
+	}
+
+	inSection := false
+	entryIndent := ""
+	for i, line := range lines {
+		if m := secretSectionPattern.FindStringSubmatch(line); m != nil {
+			inSection, entryIndent = true, ""
+			// Flow style, e.g. data: {password: aHVudGVyMg==}
+			if value := strings.TrimSpace(m[2]); value != "" {
+				lines[i] = m[1] + ": " + redacted
+				inSection = false
+			}
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if line == "" || (line[0] != ' ' && line[0] != '\t') {
+			inSection = false
+			continue
+		}
+
+		m := secretEntryPattern.FindStringSubmatch(line)
+		if m != nil && (entryIndent == "" || m[1] == entryIndent) {
+			entryIndent = m[1]
+			if m[4] != "" {
+				lines[i] = m[1] + m[2] + " " + redacted
+			}
+			continue
+		}
+		// Continuation of a multi-line value
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		lines[i] = indent + redacted
+	}
+}
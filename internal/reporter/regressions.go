@@ -0,0 +1,48 @@
+package reporter
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReportPreexistingFailures prints the kustomizations that were already failing at baseRef
+// and appends them to GITHUB_STEP_SUMMARY, so they're not mistaken for regressions
+func (r *reporter) ReportPreexistingFailures(paths []string, baseRef string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\n%s %d failing build(s) were already failing at %s:\n", r.symbols.Warn, len(paths), baseRef)
+	for _, path := range paths {
+		fmt.Printf("     - %s\n", path)
+	}
+
+	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryFile == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_STEP_SUMMARY: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(renderPreexistingSummary(paths, baseRef)); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+
+	return nil
+}
+
+// renderPreexistingSummary renders the pre-existing failures as Markdown
+func renderPreexistingSummary(paths []string, baseRef string) string {
+	var sb strings.Builder
+	sb.WriteString("\n### 🩹 Pre-existing Failures\n\n")
+	sb.WriteString(fmt.Sprintf("These kustomizations were already failing at `%s` and don't fail the check:\n\n", baseRef))
+	for _, path := range paths {
+		sb.WriteString(fmt.Sprintf("- %s\n", path))
+	}
+	return sb.String()
+}
@@ -4,9 +4,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/michielvha/kustomize-build-check/internal/builder"
+	"github.com/michielvha/kustomize-build-check/internal/differ"
+	"github.com/michielvha/kustomize-build-check/internal/graph"
+	"github.com/michielvha/kustomize-build-check/internal/kustfile"
 )
 
 // Summary contains aggregated build results
@@ -15,28 +21,174 @@ type Summary struct {
 	Success int
 	Failed  int
 	Results []builder.BuildResult
+
+	// TotalDuration is the sum of all build durations, WallClock the elapsed time of the
+	// whole build step as measured by the caller (zero when unknown)
+	TotalDuration time.Duration
+	WallClock     time.Duration
+	Slowest       builder.BuildResult
+
+	// SummaryByKind counts the failed builds per error kind, unclassified ones as unknown
+	SummaryByKind map[string]int
 }
 
 // Reporter formats and outputs build results
 type Reporter interface {
 	GenerateSummary(results []builder.BuildResult) Summary
+	SetWallClock(d time.Duration)
+	SetCoverage(coverage Coverage)
+	WriteCoverageSummary() error
 	PrintResults(results []builder.BuildResult)
 	SetGitHubOutputs(results []builder.BuildResult) error
+	SetAffectedPathsOutput(paths []string) error
+	SetDeployOrderOutput(order []graph.DeployNode) error
 	WriteGitHubStepSummary(results []builder.BuildResult) error
+	WriteGitHubAnnotations(results []builder.BuildResult)
+	WriteJSONReport(results []builder.BuildResult, path string) error
+	WriteJUnitReport(results []builder.BuildResult, path string) error
+	PostPullRequestComment(results []builder.BuildResult, token string) error
+	WritePlannedBuildsSummary(paths []string) error
+	ReportOrphans(orphans []string) error
+	ReportSkipped(skipped []Skipped) error
+	ReportPreexistingFailures(paths []string, baseRef string) error
+	WriteGraphSummary(mermaid string) error
+	WriteDiffSummary(diffs []differ.Result) error
+}
+
+// JSONReportSchemaVersion is the version of the JSON report schema.
+// Bump it whenever a field is renamed or removed.
+const JSONReportSchemaVersion = 2
+
+// JSONReport is the structured report written by WriteJSONReport
+type JSONReport struct {
+	SchemaVersion int                `json:"schemaVersion"`
+	Summary       JSONReportSummary  `json:"summary"`
+	Results       []JSONReportResult `json:"results"`
+	Coverage      *Coverage          `json:"coverage,omitempty"`
+}
+
+// JSONReportSummary contains the aggregated counts of a JSON report
+type JSONReportSummary struct {
+	Total   int `json:"total"`
+	Success int `json:"success"`
+	Failed  int `json:"failed"`
+}
+
+// JSONReportResult contains a single build result of a JSON report
+type JSONReportResult struct {
+	Path            string   `json:"path"`
+	Success         bool     `json:"success"`
+	DurationSeconds float64  `json:"durationSeconds"`
+	Error           string   `json:"error,omitempty"`
+	ErrorKind       string   `json:"errorKind,omitempty"`
+	TimedOut        bool     `json:"timedOut"`
+	Cached          bool     `json:"cached"`
+	Warnings        []string `json:"warnings,omitempty"`
+}
+
+type reporter struct {
+	wallClock time.Duration
+	verbose   bool
+	quiet     bool
+	symbols   Symbols
+	redact    bool
+	coverage  *Coverage
+
+	shardIndex int
+	shardTotal int
+	errorLines int
+	reasons    map[string]string
+}
+
+// Option configures a Reporter
+type Option func(*reporter)
+
+// WithVerbose includes the CPU time and peak memory of each build in the console output
+func WithVerbose(verbose bool) Option {
+	return func(r *reporter) {
+		r.verbose = verbose
+	}
+}
+
+// WithQuiet only prints failed builds and the summary line to the console
+func WithQuiet(quiet bool) Option {
+	return func(r *reporter) {
+		r.quiet = quiet
+	}
+}
+
+// WithPlainText uses ASCII markers such as [PASS] instead of emoji in console output
+func WithPlainText(plain bool) Option {
+	return func(r *reporter) {
+		r.symbols = ConsoleSymbols(plain)
+	}
+}
+
+// WithRedaction masks rendered Secret data and credentials in everything the reporter writes, it is on by default
+func WithRedaction(redact bool) Option {
+	return func(r *reporter) {
+		r.redact = redact
+	}
+}
+
+// WithShard marks the reports as covering only shard index (1-based) of total,
+// a total of 1 or less means the run isn't sharded
+func WithShard(index, total int) Option {
+	return func(r *reporter) {
+		r.shardIndex = index
+		r.shardTotal = total
+	}
 }
 
-type reporter struct{}
+// WithReasons names for each affected kustomization why it was affected next to it in the
+// step summary, e.g. "base/deployment.yaml changed"
+func WithReasons(reasons map[string]string) Option {
+	return func(r *reporter) {
+		r.reasons = reasons
+	}
+}
+
+// WithErrorLines shows the first n lines of each error on the console and in the step summary
+// instead of 5 and 10 lines, a negative n shows full errors and 0 keeps the defaults
+func WithErrorLines(n int) Option {
+	return func(r *reporter) {
+		r.errorLines = n
+	}
+}
+
+// Default number of error lines shown per failed build
+const (
+	consoleErrorLines = 5
+	summaryErrorLines = 10
+)
+
+// errorLineLimit returns the number of error lines to show, or -1 for full errors
+func (r *reporter) errorLineLimit(defaultLines int) int {
+	switch {
+	case r.errorLines < 0:
+		return -1
+	case r.errorLines == 0:
+		return defaultLines
+	default:
+		return r.errorLines
+	}
+}
 
 // New creates a new Reporter
-func New() Reporter {
-	return &reporter{}
+func New(opts ...Option) Reporter {
+	r := &reporter{symbols: ConsoleSymbols(false), redact: true}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // GenerateSummary creates a summary from build results
 func (r *reporter) GenerateSummary(results []builder.BuildResult) Summary {
 	summary := Summary{
-		Total:   len(results),
-		Results: results,
+		Total:         len(results),
+		Results:       results,
+		SummaryByKind: make(map[string]int),
 	}
 
 	for _, result := range results {
@@ -44,32 +196,83 @@ func (r *reporter) GenerateSummary(results []builder.BuildResult) Summary {
 			summary.Success++
 		} else {
 			summary.Failed++
+			summary.SummaryByKind[string(errorKind(result))]++
+		}
+		summary.TotalDuration += result.Duration
+		if result.Duration > summary.Slowest.Duration {
+			summary.Slowest = result
 		}
 	}
+	summary.WallClock = r.wallClock
 
 	return summary
 }
 
-// PrintResults outputs results to console with formatting
+// SetWallClock records the elapsed time of the build step for the summary
+func (r *reporter) SetWallClock(d time.Duration) {
+	r.wallClock = d
+}
+
+// timingLine describes where the build time went, e.g. to decide on more parallelism
+func timingLine(summary Summary) string {
+	line := fmt.Sprintf("Build time: %.2fs total", summary.TotalDuration.Seconds())
+	if summary.WallClock > 0 {
+		line += fmt.Sprintf(", %.2fs wall clock", summary.WallClock.Seconds())
+	}
+	if summary.Slowest.Path != "" {
+		line += fmt.Sprintf(", slowest %s (%.2fs)", summary.Slowest.Path, summary.Slowest.Duration.Seconds())
+	}
+	return line
+}
+
+// kindsLine breaks the failures down by error kind, telling one systemic cause apart
+// from many independent ones
+func kindsLine(summary Summary) string {
+	var parts []string
+	for _, kc := range countErrorKinds(summary.SummaryByKind) {
+		parts = append(parts, fmt.Sprintf("%d %s", kc.count, kc.kind))
+	}
+	return "Failures by kind: " + strings.Join(parts, ", ")
+}
+
+// PrintResults outputs results to console with formatting.
+// In quiet mode only failed builds and the summary line are printed.
 func (r *reporter) PrintResults(results []builder.BuildResult) {
+	results = r.redactResults(results)
 	if len(results) == 0 {
-		fmt.Println("✓ No kustomizations need testing")
+		fmt.Printf("%s No kustomizations need testing\n", r.symbols.Pass)
 		return
 	}
 
-	fmt.Println("\nKustomize Build Results:")
-	fmt.Println(strings.Repeat("=", 80))
+	if !r.quiet {
+		fmt.Printf("\nKustomize Build Results%s:\n", r.shardSuffix())
+		fmt.Println(strings.Repeat("=", 80))
+	}
 
-	for _, result := range results {
-		if result.Success {
-			fmt.Printf("✅ %s - Build successful (%.2fs)\n", result.Path, result.Duration.Seconds())
+	// Failures first so they're visible without scrolling
+	for _, result := range sortResults(results) {
+		if result.Success && r.quiet {
+			continue
+		}
+
+		if result.Cached {
+			fmt.Printf("%s %s - Build successful (cached)\n", r.symbols.Pass, result.Path)
+		} else if result.Success {
+			fmt.Printf("%s %s - Build successful (%.2fs)\n", r.symbols.Pass, result.Path, result.Duration.Seconds())
+			r.printResourceUsage(result)
+			r.printStderr(result)
 		} else {
-			fmt.Printf("❌ %s - Build failed (%.2fs)\n", result.Path, result.Duration.Seconds())
+			fmt.Printf("%s %s - Build failed (%.2fs)\n", r.symbols.Fail, result.Path, result.Duration.Seconds())
+			r.printResourceUsage(result)
+			if hint, ok := errorHints[result.ErrorKind]; ok {
+				fmt.Printf("   %s %s\n", r.symbols.Hint, hint)
+			}
 			if result.Error != "" {
 				// Print first few lines of error
+				limit := r.errorLineLimit(consoleErrorLines)
 				errorLines := strings.Split(result.Error, "\n")
 				for i, line := range errorLines {
-					if i >= 5 {
+					if limit >= 0 && i >= limit {
 						fmt.Println("   ...")
 						break
 					}
@@ -81,14 +284,90 @@ func (r *reporter) PrintResults(results []builder.BuildResult) {
 		}
 	}
 
+	if warned := warnedResults(results); len(warned) > 0 && !r.quiet {
+		fmt.Printf("\n%s %d successful build(s) printed warnings:\n", r.symbols.Warn, len(warned))
+		for _, result := range warned {
+			fmt.Printf("   %s\n", result.Path)
+			for _, warning := range result.Warnings {
+				fmt.Printf("     %s\n", warning)
+			}
+		}
+	}
+
 	summary := r.GenerateSummary(results)
-	fmt.Println(strings.Repeat("=", 80))
-	fmt.Printf("\nSummary: %d total, %d successful, %d failed\n",
+	if !r.quiet {
+		fmt.Println(strings.Repeat("=", 80))
+		fmt.Println()
+	}
+	fmt.Printf("Summary: %d total, %d successful, %d failed\n",
 		summary.Total, summary.Success, summary.Failed)
+	if !r.quiet {
+		if summary.Failed > 0 {
+			fmt.Println(kindsLine(summary))
+		}
+		fmt.Println(timingLine(summary))
+	}
+}
+
+// sortResults returns a copy of results with failures before successes, each group sorted
+// by duration with the slowest first so slow builds surface, and by path on equal durations
+func sortResults(results []builder.BuildResult) []builder.BuildResult {
+	sorted := append([]builder.BuildResult{}, results...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Success != b.Success {
+			return !a.Success
+		}
+		if a.Duration != b.Duration {
+			return a.Duration > b.Duration
+		}
+		return a.Path < b.Path
+	})
+	return sorted
+}
+
+// printResourceUsage prints the CPU time and peak memory of a build in verbose mode
+func (r *reporter) printResourceUsage(result builder.BuildResult) {
+	if !r.verbose {
+		return
+	}
+	fmt.Printf("   cpu: %.2fs user, %.2fs system", result.UserTime.Seconds(), result.SystemTime.Seconds())
+	if result.MaxRSS > 0 {
+		fmt.Printf(", peak memory: %s", formatBytes(result.MaxRSS))
+	}
+	fmt.Println()
+}
+
+// printStderr prints what a successful build wrote to stderr in verbose mode,
+// e.g. plugin notices, failed builds already show it as their error
+func (r *reporter) printStderr(result builder.BuildResult) {
+	if !r.verbose {
+		return
+	}
+	for _, line := range strings.Split(result.Stderr, "\n") {
+		if strings.TrimSpace(line) != "" {
+			fmt.Printf("   stderr: %s\n", line)
+		}
+	}
+}
+
+// formatBytes formats a byte count using binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
 }
 
 // SetGitHubOutputs sets GitHub Actions output variables
 func (r *reporter) SetGitHubOutputs(results []builder.BuildResult) error {
+	results = r.redactResults(results)
 	summary := r.GenerateSummary(results)
 
 	// Get GitHub output file path
@@ -108,21 +387,26 @@ func (r *reporter) SetGitHubOutputs(results []builder.BuildResult) error {
 		}
 	}()
 
-	// Convert results to JSON
-	resultsJSON, err := json.Marshal(results)
+	// Rendered manifests and full errors easily exceed the size limit of an output,
+	// they're left to the JSON report
+	outputResults := make([]trimmedResult, 0, len(results))
+	for _, result := range results {
+		outputResults = append(outputResults, newTrimmedResult(result))
+	}
+	resultsJSON, err := json.Marshal(outputResults)
 	if err != nil {
 		return fmt.Errorf("failed to marshal results: %w", err)
 	}
 
 	// Write outputs
 	outputs := []string{
-		fmt.Sprintf("failed-count=%d", summary.Failed),
-		fmt.Sprintf("success-count=%d", summary.Success),
-		fmt.Sprintf("results=%s", resultsJSON),
+		fmt.Sprintf("failed-count=%d\n", summary.Failed),
+		fmt.Sprintf("success-count=%d\n", summary.Success),
+		multilineOutput("results", string(resultsJSON)),
 	}
 
 	for _, output := range outputs {
-		if _, err := f.WriteString(output + "\n"); err != nil {
+		if _, err := f.WriteString(output); err != nil {
 			return fmt.Errorf("failed to write output: %w", err)
 		}
 	}
@@ -130,8 +414,118 @@ func (r *reporter) SetGitHubOutputs(results []builder.BuildResult) error {
 	return nil
 }
 
+// outputErrorLines is the number of error lines kept per result in the results output
+const outputErrorLines = 5
+
+// trimmedResult is a build result in the results output and JSON Lines stream. It leaves
+// out the rendered output and keeps only the head of the error to stay below the size limit
+// of an output.
+type trimmedResult struct {
+	Path            string  `json:"path"`
+	Success         bool    `json:"success"`
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	ErrorKind       string  `json:"errorKind,omitempty"`
+	TimedOut        bool    `json:"timedOut"`
+}
+
+// newTrimmedResult converts a build result into a trimmedResult
+func newTrimmedResult(result builder.BuildResult) trimmedResult {
+	return trimmedResult{
+		Path:            result.Path,
+		Success:         result.Success,
+		Error:           errorHead(result.Error, outputErrorLines),
+		DurationSeconds: result.Duration.Seconds(),
+		ErrorKind:       string(result.ErrorKind),
+		TimedOut:        result.TimedOut,
+	}
+}
+
+// errorHead returns the first n non-empty lines of an error
+func errorHead(errText string, n int) string {
+	var lines []string
+	for _, line := range strings.Split(errText, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(lines) == n {
+			lines = append(lines, "...")
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SetAffectedPathsOutput sets the affected-paths output to a JSON array of the kustomization
+// directories that were selected for building, so downstream jobs can fan out over them
+func (r *reporter) SetAffectedPathsOutput(paths []string) error {
+	outputFile := os.Getenv("GITHUB_OUTPUT")
+	if outputFile == "" {
+		// Not running in GitHub Actions, skip
+		return nil
+	}
+
+	sorted := append([]string{}, paths...)
+	sort.Strings(sorted)
+
+	pathsJSON, err := json.Marshal(sorted)
+	if err != nil {
+		return fmt.Errorf("failed to marshal affected paths: %w", err)
+	}
+
+	f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_OUTPUT: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(multilineOutput("affected-paths", string(pathsJSON))); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	return nil
+}
+
+// SetDeployOrderOutput sets the deploy-order output to a JSON array of the affected
+// kustomizations with their dependencies, bases before the overlays using them
+func (r *reporter) SetDeployOrderOutput(order []graph.DeployNode) error {
+	outputFile := os.Getenv("GITHUB_OUTPUT")
+	if outputFile == "" {
+		// Not running in GitHub Actions, skip
+		return nil
+	}
+
+	orderJSON, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deploy order: %w", err)
+	}
+
+	f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_OUTPUT: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(multilineOutput("deploy-order", string(orderJSON))); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	return nil
+}
+
+// multilineOutput formats a GITHUB_OUTPUT entry using the heredoc delimiter syntax
+func multilineOutput(name, value string) string {
+	delimiter := "EOF_KUSTOMIZE_BUILD_CHECK"
+	for strings.Contains(value, delimiter) {
+		delimiter += "_"
+	}
+	return fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter)
+}
+
 // WriteGitHubStepSummary writes a Markdown summary to GITHUB_STEP_SUMMARY
 func (r *reporter) WriteGitHubStepSummary(results []builder.BuildResult) error {
+	results = r.redactResults(results)
 	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
 	if summaryFile == "" {
 		return nil
@@ -143,37 +537,191 @@ func (r *reporter) WriteGitHubStepSummary(results []builder.BuildResult) error {
 	}
 	defer f.Close()
 
+	if _, err := f.WriteString(r.renderMarkdownSummary(results)); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+
+	return nil
+}
+
+// WritePlannedBuildsSummary writes the builds a dry run would have executed to GITHUB_STEP_SUMMARY
+func (r *reporter) WritePlannedBuildsSummary(paths []string) error {
+	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryFile == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_STEP_SUMMARY: %w", err)
+	}
+	defer f.Close()
+
+	var sb strings.Builder
+	sb.WriteString("## Kustomize Build Check Results (dry run)\n\n")
+	sb.WriteString("### 📋 Planned Builds\n\n")
+	if len(paths) == 0 {
+		sb.WriteString("No kustomizations affected by changes\n")
+	}
+	for _, path := range paths {
+		if reason := r.because(path, ""); reason != "" {
+			path += " (" + reason + ")"
+		}
+		sb.WriteString(fmt.Sprintf("- %s\n", path))
+	}
+	sb.WriteString(fmt.Sprintf("\n%d build(s) would run. No builds were executed.\n", len(paths)))
+
+	if _, err := f.WriteString(sb.String()); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+
+	return nil
+}
+
+// ReportOrphans prints kustomizations that nothing depends on and appends them to GITHUB_STEP_SUMMARY
+func (r *reporter) ReportOrphans(orphans []string) error {
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\n%s Found %d orphaned kustomization(s) that nothing depends on:\n", r.symbols.Warn, len(orphans))
+	for _, orphan := range orphans {
+		fmt.Printf("     - %s\n", orphan)
+	}
+
+	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryFile == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_STEP_SUMMARY: %w", err)
+	}
+	defer f.Close()
+
+	var sb strings.Builder
+	sb.WriteString("\n### ⚠️ Orphaned Kustomizations\n\n")
+	sb.WriteString("These kustomizations have no dependencies and nothing depends on them:\n\n")
+	for _, orphan := range orphans {
+		sb.WriteString(fmt.Sprintf("- %s\n", orphan))
+	}
+
+	if _, err := f.WriteString(sb.String()); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+
+	return nil
+}
+
+// WriteGraphSummary appends a Mermaid dependency graph to GITHUB_STEP_SUMMARY
+func (r *reporter) WriteGraphSummary(mermaid string) error {
+	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryFile == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_STEP_SUMMARY: %w", err)
+	}
+	defer f.Close()
+
+	var sb strings.Builder
+	sb.WriteString("\n### 🕸️ Dependency Graph\n\n")
+	sb.WriteString("```mermaid\n")
+	sb.WriteString(mermaid)
+	sb.WriteString("```\n")
+
+	if _, err := f.WriteString(sb.String()); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+
+	return nil
+}
+
+// shardSuffix describes the shard of a sharded run for titles, it is empty otherwise
+func (r *reporter) shardSuffix() string {
+	if r.shardTotal <= 1 {
+		return ""
+	}
+	return fmt.Sprintf(" (shard %d/%d)", r.shardIndex, r.shardTotal)
+}
+
+// because names why path was affected following sep, set with WithReasons
+func (r *reporter) because(path, sep string) string {
+	if reason := r.reasons[path]; reason != "" {
+		return sep + "because " + reason
+	}
+	return ""
+}
+
+// renderMarkdownSummary renders the build results as a Markdown summary
+func (r *reporter) renderMarkdownSummary(results []builder.BuildResult) string {
 	summary := r.GenerateSummary(results)
+	results = sortResults(results)
 
 	var sb strings.Builder
-	sb.WriteString("## Kustomize Build Check Results\n\n")
+	sb.WriteString("## Kustomize Build Check Results" + r.shardSuffix() + "\n\n")
+	if r.shardTotal > 1 {
+		sb.WriteString(fmt.Sprintf("Only shard %d of %d ran in this job, the other shards build the remaining affected kustomizations.\n\n", r.shardIndex, r.shardTotal))
+	}
 	sb.WriteString("| Metric | Count |\n")
 	sb.WriteString("|--------|-------|\n")
 	sb.WriteString(fmt.Sprintf("| Total Builds | %d |\n", summary.Total))
 	sb.WriteString(fmt.Sprintf("| ✅ Passed | %d |\n", summary.Success))
 	sb.WriteString(fmt.Sprintf("| ❌ Failed | %d |\n", summary.Failed))
+	sb.WriteString(fmt.Sprintf("| ⏱️ Total Build Time | %.2fs |\n", summary.TotalDuration.Seconds()))
+	if summary.WallClock > 0 {
+		sb.WriteString(fmt.Sprintf("| ⏱️ Wall Clock | %.2fs |\n", summary.WallClock.Seconds()))
+	}
+	if summary.Slowest.Path != "" {
+		sb.WriteString(fmt.Sprintf("| 🐢 Slowest Build | %s (%.2fs) |\n", summary.Slowest.Path, summary.Slowest.Duration.Seconds()))
+	}
 	sb.WriteString("\n")
 
 	if summary.Failed > 0 {
+		sb.WriteString("| Failure Category | Count |\n")
+		sb.WriteString("|------------------|-------|\n")
+		for _, kc := range countErrorKinds(summary.SummaryByKind) {
+			sb.WriteString(fmt.Sprintf("| %s | %d |\n", kc.kind, kc.count))
+		}
+		sb.WriteString("\n")
+
 		sb.WriteString("### ❌ Build Errors\n\n")
 		for _, result := range results {
 			if !result.Success {
-				sb.WriteString(fmt.Sprintf("- **%s**\n", result.Path))
+				sb.WriteString(fmt.Sprintf("- **%s** (%s%s)\n", result.Path, errorKind(result), r.because(result.Path, ", ")))
 				sb.WriteString("```\n")
 				// Limit error output to avoid blowing up the summary
+				limit := r.errorLineLimit(summaryErrorLines)
 				errorLines := strings.Split(result.Error, "\n")
-				if len(errorLines) > 10 {
-					sb.WriteString(strings.Join(errorLines[:10], "\n"))
-					sb.WriteString(fmt.Sprintf("\n... (+%d more lines)", len(errorLines)-10))
+				if limit >= 0 && len(errorLines) > limit {
+					sb.WriteString(strings.Join(errorLines[:limit], "\n"))
+					sb.WriteString(fmt.Sprintf("\n... (+%d more lines)", len(errorLines)-limit))
 				} else {
 					sb.WriteString(result.Error)
 				}
 				sb.WriteString("\n```\n")
+				if hint, ok := errorHints[result.ErrorKind]; ok {
+					sb.WriteString(fmt.Sprintf("\n  > 💡 %s\n\n", hint))
+				}
 			}
 		}
 		sb.WriteString("\n")
 	}
 
+	if warned := warnedResults(results); len(warned) > 0 {
+		sb.WriteString("### ⚠️ Warnings\n\n")
+		for _, result := range warned {
+			sb.WriteString(fmt.Sprintf("- **%s**\n", result.Path))
+			sb.WriteString("```\n")
+			sb.WriteString(strings.Join(result.Warnings, "\n"))
+			sb.WriteString("\n```\n")
+		}
+		sb.WriteString("\n")
+	}
+
 	if summary.Success > 0 {
 		sb.WriteString("### ✅ Successful Builds\n\n")
 		sb.WriteString("<details>\n<summary>Click to see passed builds</summary>\n\n")
@@ -185,8 +733,164 @@ func (r *reporter) WriteGitHubStepSummary(results []builder.BuildResult) error {
 		sb.WriteString("\n</details>\n")
 	}
 
-	if _, err := f.WriteString(sb.String()); err != nil {
-		return fmt.Errorf("failed to write summary: %w", err)
+	return sb.String()
+}
+
+// warnedResults returns the successful builds that printed warnings
+func warnedResults(results []builder.BuildResult) []builder.BuildResult {
+	var warned []builder.BuildResult
+	for _, result := range results {
+		if result.Success && len(result.Warnings) > 0 {
+			warned = append(warned, result)
+		}
+	}
+	return warned
+}
+
+// errorHints are actionable suggestions for failures with a well-known fix
+var errorHints = map[builder.ErrorKind]string{
+	builder.ErrorKindHelmNotEnabled: "This kustomization inflates Helm charts, set the enable-helm input to true (kustomize build --enable-helm)",
+	builder.ErrorKindWarning:        "Warnings fail the build with fail-on-warning set, deprecated fields can be migrated with kustomize edit fix",
+}
+
+// errorKindCount is the number of failed builds of an error kind
+type errorKindCount struct {
+	kind  string
+	count int
+}
+
+// countErrorKinds sorts the failure counts per error kind, most frequent first
+func countErrorKinds(byKind map[string]int) []errorKindCount {
+	kinds := make([]errorKindCount, 0, len(byKind))
+	for kind, count := range byKind {
+		kinds = append(kinds, errorKindCount{kind: kind, count: count})
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if kinds[i].count != kinds[j].count {
+			return kinds[i].count > kinds[j].count
+		}
+		return kinds[i].kind < kinds[j].kind
+	})
+	return kinds
+}
+
+// errorKind returns the error kind of a failed build, treating unclassified results as unknown
+func errorKind(result builder.BuildResult) builder.ErrorKind {
+	if result.ErrorKind == "" {
+		return builder.ErrorKindUnknown
+	}
+	return result.ErrorKind
+}
+
+// WriteGitHubAnnotations writes an ::error workflow command for each failed build,
+// so failures show up inline on the pull request's Files Changed tab
+func (r *reporter) WriteGitHubAnnotations(results []builder.BuildResult) {
+	results = r.redactResults(results)
+	for _, result := range results {
+		if result.Success {
+			continue
+		}
+
+		file := annotationFile(result.Path)
+		fmt.Println(formatAnnotation(file, condenseError(result.Error)))
+	}
+}
+
+// formatAnnotation formats an ::error workflow command with escaped property and message values
+func formatAnnotation(file, message string) string {
+	return fmt.Sprintf("::error file=%s::%s", escapeAnnotationProperty(file), escapeAnnotationData(message))
+}
+
+// escapeAnnotationData escapes a workflow command message per the GitHub Actions spec
+func escapeAnnotationData(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+	s = strings.ReplaceAll(s, "\n", "%0A")
+	return s
+}
+
+// escapeAnnotationProperty escapes a workflow command property value per the GitHub Actions spec
+func escapeAnnotationProperty(s string) string {
+	s = escapeAnnotationData(s)
+	s = strings.ReplaceAll(s, ":", "%3A")
+	s = strings.ReplaceAll(s, ",", "%2C")
+	return s
+}
+
+// condenseError collapses a multi-line build error into a single line
+func condenseError(errText string) string {
+	var parts []string
+	for _, line := range strings.Split(errText, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			parts = append(parts, line)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// annotationFile returns the kustomization file in dir, relative to the workspace
+// so GitHub can map the annotation to a file in the pull request
+func annotationFile(dir string) string {
+	file := filepath.Join(dir, kustfile.Names[0])
+	for _, name := range kustfile.Names {
+		candidate := filepath.Join(dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			file = candidate
+			break
+		}
+	}
+
+	workspace := os.Getenv("GITHUB_WORKSPACE")
+	if workspace == "" {
+		var err error
+		if workspace, err = os.Getwd(); err != nil {
+			return filepath.ToSlash(file)
+		}
+	}
+
+	if rel, err := filepath.Rel(workspace, file); err == nil && !strings.HasPrefix(rel, "..") {
+		file = rel
+	}
+
+	return filepath.ToSlash(file)
+}
+
+// WriteJSONReport writes a versioned JSON report of the build results to path
+func (r *reporter) WriteJSONReport(results []builder.BuildResult, path string) error {
+	results = r.redactResults(results)
+	summary := r.GenerateSummary(results)
+
+	report := JSONReport{
+		SchemaVersion: JSONReportSchemaVersion,
+		Summary: JSONReportSummary{
+			Total:   summary.Total,
+			Success: summary.Success,
+			Failed:  summary.Failed,
+		},
+		Results:  make([]JSONReportResult, 0, len(results)),
+		Coverage: r.coverage,
+	}
+
+	for _, result := range results {
+		report.Results = append(report.Results, JSONReportResult{
+			Path:            result.Path,
+			Success:         result.Success,
+			DurationSeconds: result.Duration.Seconds(),
+			Error:           result.Error,
+			ErrorKind:       string(result.ErrorKind),
+			TimedOut:        result.TimedOut,
+			Cached:          result.Cached,
+			Warnings:        result.Warnings,
+		})
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON report: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write JSON report: %w", err)
 	}
 
 	return nil
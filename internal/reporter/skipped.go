@@ -0,0 +1,67 @@
+package reporter
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SkipReason explains why a kustomization was not checked
+type SkipReason string
+
+const (
+	SkipReasonSkipPaths  SkipReason = "matched skip-paths"
+	SkipReasonParseError SkipReason = "failed to parse"
+	SkipReasonDeadline   SkipReason = "deadline"
+	SkipReasonFailFast   SkipReason = "fail-fast after a failed build"
+)
+
+// Skipped is a kustomization that was left out of the check
+type Skipped struct {
+	Path   string
+	Reason SkipReason
+}
+
+// ReportSkipped prints the number of skipped kustomizations and appends them
+// to GITHUB_STEP_SUMMARY, so a green check never quietly hides what wasn't built
+func (r *reporter) ReportSkipped(skipped []Skipped) error {
+	if len(skipped) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\n%s Skipped %d kustomization(s)\n", r.symbols.Warn, len(skipped))
+	if !r.quiet {
+		for _, s := range skipped {
+			fmt.Printf("     - %s (%s)\n", s.Path, s.Reason)
+		}
+	}
+
+	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryFile == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_STEP_SUMMARY: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(renderSkippedSummary(skipped)); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+
+	return nil
+}
+
+// renderSkippedSummary renders the skipped kustomizations as a collapsible Markdown section
+func renderSkippedSummary(skipped []Skipped) string {
+	var sb strings.Builder
+	sb.WriteString("\n### ⏭️ Skipped Kustomizations\n\n")
+	sb.WriteString(fmt.Sprintf("<details>\n<summary>%d kustomization(s) were not checked</summary>\n\n", len(skipped)))
+	for _, s := range skipped {
+		sb.WriteString(fmt.Sprintf("- %s (%s)\n", s.Path, s.Reason))
+	}
+	sb.WriteString("\n</details>\n")
+	return sb.String()
+}
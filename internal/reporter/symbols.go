@@ -0,0 +1,23 @@
+package reporter
+
+// Symbols are the status markers used in console output
+type Symbols struct {
+	Pass string
+	Fail string
+	Warn string
+	Hint string
+}
+
+var (
+	emojiSymbols = Symbols{Pass: "✅", Fail: "❌", Warn: "⚠️ ", Hint: "💡"}
+	plainSymbols = Symbols{Pass: "[PASS]", Fail: "[FAIL]", Warn: "[WARN]", Hint: "[HINT]"}
+)
+
+// ConsoleSymbols returns the emoji markers, or ASCII markers when plain is set
+// for log sinks that mangle emoji
+func ConsoleSymbols(plain bool) Symbols {
+	if plain {
+		return plainSymbols
+	}
+	return emojiSymbols
+}
@@ -0,0 +1,53 @@
+package testutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/michielvha/kustomize-build-check/internal/builder"
+)
+
+// Builder is a fake builder.Builder that renders kustomizations from files in their directory
+type Builder struct {
+	// OutputFile is returned as the rendered output when set, builds fail when it can't be read
+	OutputFile string
+	// FailMarker fails builds of directories containing a file with this name
+	FailMarker string
+	// TruncateMarker marks the output of directories containing a file with this name as truncated
+	TruncateMarker string
+}
+
+func (b Builder) Build(_ context.Context, path string, _ bool) builder.BuildResult {
+	if b.FailMarker != "" {
+		if _, err := os.Stat(filepath.Join(path, b.FailMarker)); err == nil {
+			return builder.BuildResult{Path: path, Error: "found " + b.FailMarker}
+		}
+	}
+
+	var output string
+	if b.OutputFile != "" {
+		out, err := os.ReadFile(filepath.Join(path, b.OutputFile))
+		if err != nil {
+			return builder.BuildResult{Path: path, Error: err.Error()}
+		}
+		output = string(out)
+	}
+	result := builder.BuildResult{Path: path, Success: true, Output: output}
+	if b.TruncateMarker != "" {
+		if _, err := os.Stat(filepath.Join(path, b.TruncateMarker)); err == nil {
+			result.OutputTruncated = true
+		}
+	}
+	return result
+}
+
+func (b Builder) BuildAll(ctx context.Context, paths []string, enableHelm bool) []builder.BuildResult {
+	var results []builder.BuildResult
+	for _, path := range paths {
+		results = append(results, b.Build(ctx, path, enableHelm))
+	}
+	return results
+}
+
+func (Builder) CheckBinary() error { return nil }
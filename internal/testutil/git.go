@@ -0,0 +1,65 @@
+// Package testutil provides git repository helpers and a fake builder shared by the package tests
+package testutil
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// GitCmd runs a git command in dir and returns its output, failing the test on error
+func GitCmd(t testing.TB, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+	return string(out)
+}
+
+// writeFile writes a file (relative to dir), creating its parent directories
+func writeFile(t testing.TB, dir, name, content string) {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
+
+// CommitFile writes a file and commits it
+func CommitFile(t testing.TB, dir, name, content string) {
+	t.Helper()
+
+	writeFile(t, dir, name, content)
+	GitCmd(t, dir, "add", "-A")
+	GitCmd(t, dir, "commit", "-q", "-m", "update "+name)
+}
+
+// InitRepo creates a git repository in a temp dir, skipping the test without git
+func InitRepo(t testing.TB) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	// git reports the resolved repository root
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to resolve temp dir: %v", err)
+	}
+	GitCmd(t, dir, "init", "-q", "-b", "main")
+	return dir
+}
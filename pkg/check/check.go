@@ -0,0 +1,1154 @@
+package check
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/michielvha/kustomize-build-check/internal/analyzer"
+	"github.com/michielvha/kustomize-build-check/internal/builder"
+	"github.com/michielvha/kustomize-build-check/internal/cache"
+	"github.com/michielvha/kustomize-build-check/internal/differ"
+	"github.com/michielvha/kustomize-build-check/internal/discovery"
+	"github.com/michielvha/kustomize-build-check/internal/git"
+	"github.com/michielvha/kustomize-build-check/internal/graph"
+	"github.com/michielvha/kustomize-build-check/internal/helm"
+	"github.com/michielvha/kustomize-build-check/internal/kustfile"
+	"github.com/michielvha/kustomize-build-check/internal/reporter"
+)
+
+// Config holds all settings for a kustomize build check run.
+// Start from DefaultConfig, several zero values disable checks, e.g. a MaxDepth of 0.
+type Config struct {
+	BaseRef           string
+	RootDirs          []string
+	EnableHelm        bool
+	FailOnError       bool
+	Annotations       bool
+	JSONOutput        string
+	JUnitOutput       string
+	PRComment         bool
+	GitHubToken       string
+	DryRun            bool
+	Include           []string
+	Exclude           []string
+	ReportOrphans     bool
+	GraphOutput       string
+	RenderGraph       bool
+	RenderDiff        bool
+	RegressionsOnly   bool
+	Retries           int
+	CacheDir          string
+	FollowSymlinks    bool
+	MaxDepth          int
+	SkipDirs          []string
+	FailOnCycle       bool
+	StrictRefs        bool
+	AutoFetch         bool
+	Verbose           bool
+	Quiet             bool
+	NoEmoji           bool
+	MaxBuilds         int
+	Concurrency       int
+	Timeout           time.Duration
+	TotalTimeout      time.Duration
+	MaxOutputBytes    int
+	IncludeDependents bool
+	MaxDependentDepth int
+	BuildBases        bool
+	SkipPaths         []string
+	ForcePaths        []string
+	NoFanoutPaths     []string
+	FailOnParseError  bool
+	ChangedFiles      []string
+	RepoRoot          string
+	BuildEnv          []string
+	RedactSecrets     bool
+	KustomizePath     string
+	HelmRepos         []HelmRepo
+	HelmCacheDir      string
+	KustomizationList string
+	GraphCache        string
+	CoverageReport    bool
+
+	// Shard only builds a deterministic subset of the affected kustomizations, so a large
+	// affected set can be split across parallel jobs
+	Shard Shard
+
+	// KustomizationNames are file names accepted as kustomization files on top of
+	// kustomization.yaml, kustomization.yml and Kustomization
+	KustomizationNames []string
+
+	// Query prints the dependencies and dependents of the kustomization in this directory
+	// instead of checking changes, nothing is built
+	Query string
+
+	// TemplateSuffixes are stripped from changed files, so a changed template affects the
+	// kustomizations referencing the file rendered from it
+	TemplateSuffixes []string
+
+	// RecurseSubmodules detects the files changed inside submodules instead of only
+	// the submodule path
+	RecurseSubmodules bool
+
+	// Mode selects what a run does, ModeBuild unless set
+	Mode Mode
+
+	// JSONLOutput streams each build result as a line of JSON to this file as the build
+	// completes, "-" writes to stdout
+	JSONLOutput string
+
+	// IncludeExternalBases also discovers the kustomizations referenced from within RootDirs
+	// that lie outside them, up to the repository root
+	IncludeExternalBases bool
+
+	// DeployOrderOutput sets the deploy-order output, the affected kustomizations in
+	// dependency order with their dependencies
+	DeployOrderOutput bool
+
+	// AncestorMatch also affects the nearest kustomization above each changed file, in
+	// addition to the ones referencing it
+	AncestorMatch bool
+
+	// DiffPaths limits the git diff to these pathspecs, relative to the working directory.
+	// They're ignored with ChangedFiles.
+	DiffPaths []string
+
+	// IgnoreExtensions and IgnoreFiles are the extensions and base names of changed files,
+	// e.g. documentation, that only affect the kustomizations referencing them by name
+	IgnoreExtensions []string
+	IgnoreFiles      []string
+
+	// ErrorLines is the number of lines shown of each error on the console and in the step
+	// summary, 0 keeps the defaults and a negative value shows full errors
+	ErrorLines int
+
+	// EnableAlphaPlugins and EnableExec pass --enable-alpha-plugins and --enable-exec to
+	// kustomize build, PluginHome sets KUSTOMIZE_PLUGIN_HOME
+	EnableAlphaPlugins bool
+	EnableExec         bool
+	PluginHome         string
+
+	// FailFast stops building at the first failure, the remaining kustomizations are
+	// reported as skipped
+	FailFast bool
+
+	// FailOnUnresolved fails the run when a local dependency doesn't resolve to a
+	// discovered kustomization
+	FailOnUnresolved bool
+
+	// FailOnWarning fails successful builds that printed warnings such as deprecation notices
+	FailOnWarning bool
+
+	// FailOnUnanalyzed fails the run when kustomization files or files in kustomization
+	// directories changed but no kustomization was found affected by them
+	FailOnUnanalyzed bool
+}
+
+// Mode selects what a run does
+type Mode string
+
+const (
+	// ModeBuild builds the kustomizations affected by the changes
+	ModeBuild Mode = "build"
+	// ModeLint only checks that all kustomization files parse and their local references
+	// exist, without looking at changes or running kustomize
+	ModeLint Mode = "lint"
+)
+
+// Shard selects part Index (1-based) of Total disjoint parts of the affected kustomizations,
+// the zero value selects all of them
+type Shard struct {
+	Index int
+	Total int
+}
+
+// HelmRepo is a Helm chart repository added before building
+type HelmRepo = helm.Repo
+
+// defaultMaxOutputBytes caps the rendered output of a build well above any sane kustomization
+const defaultMaxOutputBytes = 10 << 20
+
+// DefaultConfig returns the settings the action uses when no inputs are given
+func DefaultConfig() Config {
+	return Config{
+		RootDirs:          []string{"."},
+		EnableHelm:        true,
+		FailOnError:       true,
+		MaxDepth:          -1,
+		SkipDirs:          discovery.DefaultSkipDirs,
+		IgnoreExtensions:  analyzer.DefaultIgnoreExtensions,
+		IgnoreFiles:       analyzer.DefaultIgnoreFiles,
+		Concurrency:       1,
+		Timeout:           2 * time.Minute,
+		MaxOutputBytes:    defaultMaxOutputBytes,
+		IncludeDependents: true,
+		MaxDependentDepth: -1,
+		BuildBases:        true,
+		RedactSecrets:     true,
+	}
+}
+
+var (
+	// ErrCheckFailed wraps the errors of a run that completed but found problems with the
+	// kustomizations under test, as opposed to the tool itself failing
+	ErrCheckFailed = errors.New("check failed")
+
+	// ErrBuildsFailed is returned by Run when builds failed and cfg.FailOnError is set, it wraps ErrCheckFailed
+	ErrBuildsFailed = fmt.Errorf("%w: some builds failed", ErrCheckFailed)
+)
+
+// Summary aggregates the build results of a run
+type Summary = reporter.Summary
+
+// Run executes the full check pipeline: it detects the changed files, discovers the
+// kustomizations, builds the dependency graph, builds the affected kustomizations and
+// writes the configured reports. Progress is printed to stdout, warnings to stderr.
+// Build failures are reported through the summary and, with cfg.FailOnError, ErrBuildsFailed.
+// Errors wrapping ErrCheckFailed are problems with the kustomizations, others are tool failures.
+func Run(ctx context.Context, cfg Config) (Summary, error) {
+	start := time.Now()
+	out := newConsole(cfg.Quiet, cfg.NoEmoji)
+	out.section("🔍", "Kustomize Build Check")
+	out.println()
+
+	if cfg.Query != "" {
+		return Summary{}, runQuery(ctx, cfg, out)
+	}
+	if cfg.Mode == ModeLint {
+		return Summary{}, runLint(ctx, cfg, out)
+	}
+
+	// 1. Detect changed files
+	out.section("📝", "Detecting changed files...")
+	var (
+		changedFiles []string
+		err          error
+	)
+	if len(cfg.ChangedFiles) > 0 {
+		// The changed files are already known, e.g. from a webhook payload, git isn't needed.
+		// Like git diff output they're relative to the repository root rather than root-dir.
+		// External bases may live anywhere in the repository
+		roots := cfg.RootDirs
+		if cfg.IncludeExternalBases {
+			roots = []string{repoRoot(ctx, cfg)}
+		}
+		changedFiles = filterWithinRoots(git.ResolvePaths(repoRoot(ctx, cfg), trimPaths(cfg.ChangedFiles)), roots)
+		out.printf("   Using %d changed files from the changed-files input\n", len(changedFiles))
+		if len(cfg.DiffPaths) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: diff-paths only limits the git diff and is ignored with changed-files\n")
+		}
+	} else {
+		gitAnalyzer := git.New(
+			git.WithAutoFetch(cfg.AutoFetch),
+			git.WithRecurseSubmodules(cfg.RecurseSubmodules),
+			git.WithPathspecs(cfg.DiffPaths),
+		)
+		changedFiles, err = gitAnalyzer.GetChangedFiles(ctx, cfg.BaseRef, "HEAD")
+	}
+	buildAll := false
+	switch {
+	case len(cfg.ChangedFiles) > 0:
+		// Already reported above
+	case errors.Is(err, git.ErrInitialCommit):
+		out.println("   HEAD is the initial commit, checking all kustomizations")
+		buildAll = true
+	case err != nil:
+		return Summary{}, fmt.Errorf("detecting changes: %w", err)
+	case len(changedFiles) == 0 && cfg.BaseRef == "":
+		out.println("   No base-ref provided, compared HEAD~1..HEAD and found no changes")
+	case len(changedFiles) == 0:
+		out.printf("   No changes between %s and HEAD, does base-ref point at HEAD?\n", cfg.BaseRef)
+	default:
+		out.printf("   Found %d changed files\n", len(changedFiles))
+	}
+
+	// 2. Discover all kustomizations and 3. build dependency graph
+	kustomizations, skipped, g, err := discoverGraph(ctx, cfg, out)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	// 4. Analyze impact
+	out.println()
+	out.section("📊", "Analyzing impact...")
+	g.SetNoFanout(analyzer.MatchKustomizations(kustomizations, ".", cfg.NoFanoutPaths))
+	impactAnalyzer := analyzer.New(
+		analyzer.WithIncludeDependents(cfg.IncludeDependents),
+		analyzer.WithMaxDependentDepth(cfg.MaxDependentDepth),
+		analyzer.WithBuildBases(cfg.BuildBases),
+		analyzer.WithKustomizationNames(cfg.KustomizationNames),
+		analyzer.WithTemplateSuffixes(cfg.TemplateSuffixes),
+		analyzer.WithAncestorMatch(cfg.AncestorMatch),
+		analyzer.WithIgnoredFiles(cfg.IgnoreExtensions, cfg.IgnoreFiles),
+	)
+	affected := impactAnalyzer.Analyze(changedFiles, g, kustomizations)
+	affectedPaths := affected.Paths()
+	reasons := describeReasons(affected)
+	switch {
+	case buildAll && !cfg.BuildBases:
+		// Every base is pulled in by an overlay that is built anyway
+		affectedPaths = g.GetBuildRoots()
+	case buildAll:
+		affectedPaths = affectedPaths[:0]
+		for _, kust := range kustomizations {
+			affectedPaths = append(affectedPaths, kust.Dir)
+		}
+	}
+
+	// Zero affected kustomizations despite changes inside them likely means a gap in the
+	// analysis rather than a harmless change, don't let the run pass silently
+	if len(affectedPaths) == 0 {
+		// Docs and ownership files don't end up in the rendered manifests
+		unanalyzed, _ := analyzer.FilterIgnoredFiles(unanalyzedChanges(changedFiles, kustomizations, cfg.KustomizationNames), cfg.IgnoreExtensions, cfg.IgnoreFiles)
+		if len(unanalyzed) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d changed file(s) are kustomization files or lie in kustomization directories, but no kustomization was found affected:\n", len(unanalyzed))
+			for _, file := range unanalyzed {
+				fmt.Fprintf(os.Stderr, "     - %s\n", file)
+			}
+			if cfg.FailOnUnanalyzed {
+				return Summary{}, fmt.Errorf("%w: %d changed file(s) in kustomizations affected no kustomization", ErrCheckFailed, len(unanalyzed))
+			}
+		}
+	}
+
+	// Apply the skip and force lists on top of the impact analysis
+	affectedPaths, skippedPaths := analyzer.ApplyPathFilters(affectedPaths, kustomizations, ".", cfg.SkipPaths, cfg.ForcePaths)
+	for _, path := range skippedPaths {
+		skipped = append(skipped, reporter.Skipped{Path: path, Reason: reporter.SkipReasonSkipPaths})
+	}
+
+	// Other shards build the rest of the affected kustomizations
+	if cfg.Shard.Total > 1 {
+		total := len(affectedPaths)
+		affectedPaths = analyzer.ShardPaths(affectedPaths, ".", cfg.Shard.Index, cfg.Shard.Total)
+		out.printf("   Shard %d/%d: %d of %d affected kustomization(s)\n", cfg.Shard.Index, cfg.Shard.Total, len(affectedPaths), total)
+	}
+
+	rep := reporter.New(
+		reporter.WithVerbose(cfg.Verbose),
+		reporter.WithQuiet(cfg.Quiet),
+		reporter.WithPlainText(cfg.NoEmoji),
+		reporter.WithRedaction(cfg.RedactSecrets),
+		reporter.WithShard(cfg.Shard.Index, cfg.Shard.Total),
+		reporter.WithErrorLines(cfg.ErrorLines),
+		reporter.WithReasons(reasons),
+	)
+
+	// Build bases before the overlays using them, and let deploy jobs roll them out in that order
+	order, orderErr := g.DeployOrder(affectedPaths)
+	if cfg.DeployOrderOutput {
+		err := orderErr
+		if err == nil {
+			err = rep.SetDeployOrderOutput(order)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to set deploy-order output: %v\n", err)
+		}
+	}
+
+	// Dry run: only report what would be built
+	if cfg.DryRun {
+		out.printf("   %d kustomization(s) would be built (dry run):\n", len(affectedPaths))
+		for _, path := range affectedPaths {
+			out.printf("     - %s%s\n", path, because(reasons[path]))
+		}
+
+		if err := rep.WritePlannedBuildsSummary(affectedPaths); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to write GitHub step summary: %v\n", err)
+		}
+		if err := rep.ReportSkipped(skipped); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to report skipped kustomizations: %v\n", err)
+		}
+
+		fmt.Printf("\n%s Dry run complete, no builds executed\n", out.symbols.Pass)
+		return Summary{}, nil
+	}
+
+	if len(affectedPaths) == 0 {
+		out.println("   No kustomizations affected by changes")
+		// Even if no paths affected, we should report 0 builds
+		if cfg.CoverageReport {
+			rep.SetCoverage(newCoverage(ctx, cfg, changedFiles, affectedPaths, skipped))
+		}
+		writeReports(cfg, rep, affectedPaths, skipped, nil)
+
+		if cfg.ReportOrphans {
+			if err := rep.ReportOrphans(g.GetOrphans()); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to report orphans: %v\n", err)
+			}
+		}
+
+		fmt.Printf("\n%s All checks passed\n", out.symbols.Pass)
+		return rep.GenerateSummary(nil), nil
+	}
+
+	// Guard against accidental fan-out, e.g. a shared root base queueing thousands of overlays
+	if cfg.MaxBuilds > 0 && len(affectedPaths) > cfg.MaxBuilds {
+		fmt.Fprintf(os.Stderr, "%d kustomizations are affected:\n", len(affectedPaths))
+		sorted := append([]string{}, affectedPaths...)
+		sort.Strings(sorted)
+		for i, path := range sorted {
+			if i >= 10 {
+				fmt.Fprintf(os.Stderr, "     ... and %d more\n", len(sorted)-i)
+				break
+			}
+			fmt.Fprintf(os.Stderr, "     - %s\n", path)
+		}
+		return Summary{}, fmt.Errorf("%w: %d kustomizations are affected, exceeding max-builds (%d). "+
+			"Raise max-builds if this is expected, or reduce the blast radius of the change (e.g. with exclude)", ErrCheckFailed, len(affectedPaths), cfg.MaxBuilds)
+	}
+
+	out.printf("   %d kustomization(s) need testing:\n", len(affectedPaths))
+	for _, path := range affectedPaths {
+		out.printf("     - %s%s\n", path, because(reasons[path]))
+	}
+
+	// 5. Build affected kustomizations
+	out.println()
+	out.section("🔨", "Running kustomize build...")
+	builderOpts := []builder.Option{
+		builder.WithBinary(cfg.KustomizePath),
+		builder.WithTimeout(cfg.Timeout),
+		builder.WithRetries(cfg.Retries),
+		builder.WithConcurrency(cfg.Concurrency),
+		builder.WithMaxOutputBytes(cfg.MaxOutputBytes),
+		builder.WithFailOnWarning(cfg.FailOnWarning),
+		builder.WithFailFast(cfg.FailFast),
+		builder.WithAlphaPlugins(cfg.EnableAlphaPlugins),
+		builder.WithExec(cfg.EnableExec),
+		builder.WithPluginHome(cfg.PluginHome),
+		builder.WithEnv(cfg.BuildEnv),
+		builder.WithDependencies(buildDependencies(order)),
+	}
+	progress := &buildProgress{out: out, concurrent: cfg.Concurrency > 1}
+	if cfg.JSONLOutput != "" {
+		w, closeOutput, err := openJSONLOutput(cfg.JSONLOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: jsonl-output disabled: %v\n", err)
+		} else {
+			defer closeOutput()
+			progress.results = reporter.NewJSONLWriter(w, cfg.RedactSecrets)
+		}
+	}
+	builderOpts = append(builderOpts, builder.WithProgress(progress))
+	if cfg.CacheDir != "" {
+		buildCache, err := cache.New(cfg.CacheDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: build cache disabled: %v\n", err)
+		} else {
+			builderOpts = append(builderOpts, builder.WithCache(buildCache))
+		}
+	}
+	// Share downloaded charts and repository indexes between the builds of this run
+	helmCacheDir := cfg.HelmCacheDir
+	if cfg.EnableHelm && helmCacheDir == "" {
+		dir, err := os.MkdirTemp("", "kustomize-build-check-helm-")
+		if err != nil {
+			return Summary{}, fmt.Errorf("creating helm cache dir: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		helmCacheDir = dir
+	}
+	if helmCacheDir != "" {
+		builderOpts = append(builderOpts, builder.WithHelmCacheDir(helmCacheDir))
+	}
+	bldr := builder.New(builderOpts...)
+	if err := bldr.CheckBinary(); err != nil {
+		return Summary{}, fmt.Errorf("%w, install it or set INPUT_KUSTOMIZE-PATH", err)
+	}
+	if err := helm.AddRepos(ctx, cfg.HelmRepos, helmCacheDir); err != nil {
+		return Summary{}, err
+	}
+	// Stop starting builds when the time budget runs out, so the run still gets to report
+	// instead of being killed by the runner
+	buildCtx := ctx
+	if cfg.TotalTimeout > 0 {
+		var cancel context.CancelFunc
+		buildCtx, cancel = context.WithDeadline(ctx, start.Add(cfg.TotalTimeout))
+		defer cancel()
+	}
+	buildStart := time.Now()
+	results := bldr.BuildAll(buildCtx, affectedPaths, cfg.EnableHelm)
+	rep.SetWallClock(time.Since(buildStart))
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Warning: interrupted, builds that did not finish are reported as failed")
+	}
+	var deadlineSkipped, failFastSkipped []string
+	results = slices.DeleteFunc(results, func(result builder.BuildResult) bool {
+		switch {
+		case result.Skipped && result.FailFast:
+			failFastSkipped = append(failFastSkipped, result.Path)
+			skipped = append(skipped, reporter.Skipped{Path: result.Path, Reason: reporter.SkipReasonFailFast})
+		case result.Skipped:
+			deadlineSkipped = append(deadlineSkipped, result.Path)
+			skipped = append(skipped, reporter.Skipped{Path: result.Path, Reason: reporter.SkipReasonDeadline})
+		}
+		return result.Skipped
+	})
+	if len(deadlineSkipped) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: total-timeout of %s reached, %d kustomization(s) were not built:\n", cfg.TotalTimeout, len(deadlineSkipped))
+		for _, path := range deadlineSkipped {
+			fmt.Fprintf(os.Stderr, "     - %s\n", path)
+		}
+	}
+	if len(failFastSkipped) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: fail-fast stopped the builds at the first failure, %d kustomization(s) were not built\n", len(failFastSkipped))
+	}
+
+	// 6. Report results
+	rep.PrintResults(results)
+
+	// Emit inline PR annotations for failed builds
+	if cfg.Annotations {
+		rep.WriteGitHubAnnotations(results)
+	}
+
+	if cfg.CoverageReport {
+		rep.SetCoverage(newCoverage(ctx, cfg, changedFiles, affectedPaths, skipped))
+	}
+	writeReports(cfg, rep, affectedPaths, skipped, results)
+
+	if cfg.RenderGraph {
+		if err := rep.WriteGraphSummary(g.ToMermaid(affectedPaths...)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to write graph summary: %v\n", err)
+		}
+	}
+
+	if cfg.RenderDiff {
+		writeRenderDiff(ctx, cfg, rep, bldr, results, buildAll)
+	}
+
+	if cfg.ReportOrphans {
+		if err := rep.ReportOrphans(g.GetOrphans()); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to report orphans: %v\n", err)
+		}
+	}
+
+	// Determine the result
+	summary := rep.GenerateSummary(results)
+	failed := summary.Failed
+	if cfg.RegressionsOnly && failed > 0 {
+		preexisting, err := findPreexistingFailures(ctx, cfg, bldr, results, buildAll)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to check for pre-existing failures, treating all failures as regressions: %v\n", err)
+		} else if err := rep.ReportPreexistingFailures(preexisting, baseRef(cfg)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to report pre-existing failures: %v\n", err)
+		}
+		failed -= len(preexisting)
+	}
+	if cfg.FailOnError && failed > 0 {
+		fmt.Printf("\n%s Some builds failed\n", out.symbols.Fail)
+		return summary, ErrBuildsFailed
+	}
+	if failed == 0 && summary.Failed > 0 {
+		fmt.Printf("\n%s No regressions, %d build(s) were already failing at %s\n", out.symbols.Pass, summary.Failed-failed, baseRef(cfg))
+		return summary, nil
+	}
+
+	fmt.Printf("\n%s All builds successful\n", out.symbols.Pass)
+	return summary, nil
+}
+
+// discoverGraph discovers the kustomizations and builds their dependency graph. Kustomizations
+// that failed to parse are returned as skipped unless cfg.FailOnParseError is set.
+func discoverGraph(ctx context.Context, cfg Config, out console) ([]discovery.KustomizeFile, []reporter.Skipped, graph.Graph, error) {
+	// 2. Discover all kustomizations
+	out.println()
+	out.section("🔎", "Discovering kustomization files...")
+	discOpts := []discovery.Option{
+		discovery.WithInclude(cfg.Include),
+		discovery.WithExclude(cfg.Exclude),
+		discovery.WithFollowSymlinks(cfg.FollowSymlinks),
+		discovery.WithMaxDepth(cfg.MaxDepth),
+		discovery.WithSkipDirs(cfg.SkipDirs),
+		discovery.WithKustomizationNames(cfg.KustomizationNames),
+	}
+	// Only kustomization files changed since the cached graph was written are parsed again
+	cached := loadGraphCache(cfg.GraphCache)
+	if cached != nil {
+		discOpts = append(discOpts, discovery.WithParsed(cached.CachedKustomization))
+	}
+	disc := discovery.New(discOpts...)
+	var (
+		kustomizations []discovery.KustomizeFile
+		parseErrors    []discovery.ParseError
+		err            error
+	)
+	if cfg.KustomizationList != "" {
+		dirs, err := readKustomizationList(cfg.KustomizationList)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		out.printf("   Using %d kustomization directories from the kustomization-list input\n", len(dirs))
+		kustomizations, parseErrors, err = disc.FindInDirs(dirs)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("reading kustomization list: %w", err)
+		}
+	} else {
+		kustomizations, parseErrors, err = disc.FindAllRoots(cfg.RootDirs)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("discovering kustomizations: %w", err)
+		}
+	}
+	out.printf("   Found %d kustomization files\n", len(kustomizations))
+
+	// Bases above root-dir aren't walked, without them changes there don't reach the overlays
+	var externalRefs []discovery.ExternalReference
+	if cfg.KustomizationList == "" {
+		if cfg.IncludeExternalBases {
+			external, failed := disc.FindExternal(kustomizations, cfg.RootDirs, repoRoot(ctx, cfg))
+			if len(external) > 0 {
+				out.printf("   Found %d kustomization files outside root-dir referenced as bases\n", len(external))
+			}
+			kustomizations = append(kustomizations, external...)
+			parseErrors = append(parseErrors, failed...)
+		} else if externalRefs = discovery.FindExternalReferences(kustomizations, cfg.RootDirs); len(externalRefs) > 0 {
+			for _, ref := range externalRefs {
+				fmt.Fprintf(os.Stderr, "Warning: %s references %s outside root-dir, set include-external-bases to follow it\n", ref.Kustomization, ref.Dir)
+			}
+		}
+	}
+
+	// Unparseable kustomizations can't be checked, either fail or report them as skipped
+	var skipped []reporter.Skipped
+	for _, parseErr := range parseErrors {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", parseErr)
+		skipped = append(skipped, reporter.Skipped{Path: filepath.Dir(parseErr.Path), Reason: reporter.SkipReasonParseError})
+	}
+	if cfg.FailOnParseError && len(parseErrors) > 0 {
+		return nil, nil, nil, fmt.Errorf("%w: %d kustomization file(s) failed to parse", ErrCheckFailed, len(parseErrors))
+	}
+
+	// kustomize refuses to build a directory with several kustomization files, and the graph
+	// can only hold one of them
+	if duplicates := discovery.FindDuplicateKustomizations(kustomizations); len(duplicates) > 0 {
+		for _, dup := range duplicates {
+			fmt.Fprintf(os.Stderr, "Warning: %s contains more than one kustomization file: %s\n", dup.Dir, strings.Join(dup.Paths, ", "))
+		}
+		if cfg.FailOnParseError {
+			return nil, nil, nil, fmt.Errorf("%w: %d directories contain more than one kustomization file", ErrCheckFailed, len(duplicates))
+		}
+		kustomizations = firstPerDir(kustomizations, duplicates)
+	}
+
+	// Catch references broken by deletions elsewhere, even in untouched kustomizations
+	dangling := discovery.FindDanglingReferences(kustomizations)
+	if len(dangling) > 0 {
+		fmt.Printf("   %s Found %d dangling reference(s):\n", out.symbols.Warn, len(dangling))
+		for _, ref := range dangling {
+			fmt.Printf("     - %s: %s %q does not exist\n", ref.Kustomization, ref.Field, ref.Reference)
+		}
+		if cfg.StrictRefs {
+			return nil, nil, nil, fmt.Errorf("%w: kustomizations reference paths that do not exist", ErrCheckFailed)
+		}
+	}
+
+	// 3. Build dependency graph
+	out.println()
+	out.section("🕸️ ", "Building dependency graph...")
+	g := cached
+	if g != nil {
+		err = g.Update(kustomizations)
+	} else {
+		g = graph.New()
+		err = g.Build(kustomizations)
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("building graph: %w", err)
+	}
+	if cfg.GraphCache != "" {
+		if err := saveGraphCache(cfg.GraphCache, g); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to write graph cache: %v\n", err)
+		}
+	}
+
+	// A dependency that isn't a discovered kustomization never propagates changes. Dangling
+	// and external references were already reported above, they're not repeated.
+	if unresolved := g.GetUnresolved(); len(unresolved) > 0 {
+		if unreported := unreportedDependencies(unresolved, dangling, externalRefs); len(unreported) > 0 {
+			fmt.Printf("   %s Found %d unresolved dependency reference(s):\n", out.symbols.Warn, len(unreported))
+			for _, dep := range unreported {
+				fmt.Printf("     - %s references %s, which is not a discovered kustomization\n", dep.Kustomization, dep.Dependency)
+			}
+		}
+		if cfg.FailOnUnresolved {
+			return nil, nil, nil, fmt.Errorf("%w: %d dependencies do not resolve to a kustomization", ErrCheckFailed, len(unresolved))
+		}
+	}
+
+	// Cyclic references are almost always a mistake
+	if cycles := g.DetectCycles(); len(cycles) > 0 {
+		fmt.Printf("   %s Found %d dependency cycle(s):\n", out.symbols.Warn, len(cycles))
+		for _, cycle := range cycles {
+			fmt.Printf("     - %s -> %s\n", strings.Join(cycle, " -> "), cycle[0])
+		}
+		if cfg.FailOnCycle {
+			return nil, nil, nil, fmt.Errorf("%w: dependency cycles detected", ErrCheckFailed)
+		}
+	}
+
+	// Export the graph for debugging when requested
+	if cfg.GraphOutput != "" {
+		if err := os.WriteFile(cfg.GraphOutput, []byte(g.ToDOT()), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to write graph: %v\n", err)
+		} else {
+			out.printf("   Wrote dependency graph to %s\n", cfg.GraphOutput)
+		}
+	}
+
+	return kustomizations, skipped, g, nil
+}
+
+// runLint checks that all kustomization files parse and reference existing local paths.
+// All problems are reported before failing, rather than stopping at the first kind.
+func runLint(ctx context.Context, cfg Config, out console) error {
+	// discoverGraph reports both kinds of problems when it doesn't fail on them
+	lintCfg := cfg
+	lintCfg.FailOnParseError = false
+	lintCfg.StrictRefs = false
+	kustomizations, skipped, _, err := discoverGraph(ctx, lintCfg, out)
+	if err != nil {
+		return err
+	}
+
+	parseErrors := 0
+	for _, s := range skipped {
+		if s.Reason == reporter.SkipReasonParseError {
+			parseErrors++
+		}
+	}
+	dangling := len(discovery.FindDanglingReferences(kustomizations))
+	if parseErrors > 0 || dangling > 0 {
+		fmt.Printf("\n%s Lint failed\n", out.symbols.Fail)
+		return fmt.Errorf("%w: %d kustomization file(s) failed to parse, %d dangling reference(s)", ErrCheckFailed, parseErrors, dangling)
+	}
+
+	fmt.Printf("\n%s Lint passed for %d kustomization file(s)\n", out.symbols.Pass, len(kustomizations))
+	return nil
+}
+
+// runQuery prints the direct dependencies, the direct dependents and all transitive
+// dependents of the kustomization in cfg.Query
+func runQuery(ctx context.Context, cfg Config, out console) error {
+	_, _, g, err := discoverGraph(ctx, cfg, out)
+	if err != nil {
+		return err
+	}
+
+	path, err := filepath.Abs(cfg.Query)
+	if err != nil {
+		return fmt.Errorf("resolving query path: %w", err)
+	}
+	node := g.GetNode(path)
+	if node == nil {
+		// Symlinked kustomizations are discovered at their real location
+		if realPath, err := filepath.EvalSymlinks(path); err == nil {
+			path = realPath
+			node = g.GetNode(path)
+		}
+	}
+	if node == nil {
+		return fmt.Errorf("%s is not a discovered kustomization directory", cfg.Query)
+	}
+
+	var dependencies []string
+	for _, dep := range node.Dependencies {
+		dependencies = append(dependencies, filepath.Join(node.Path, dep))
+	}
+	dependencies = append(append(dependencies, node.RemoteDeps...), node.RemoteResources...)
+	dependents := g.GetDependentOverlays(node.Path)
+	allDependents := g.GetAllDependents(node.Path)
+
+	out.println()
+	fmt.Printf("%s\n", node.Path)
+	printQueryList("Dependencies", dependencies)
+	printQueryList("Direct dependents", dependents)
+	printQueryList("All dependents", allDependents)
+	return nil
+}
+
+// printQueryList prints a sorted list of paths under a heading
+func printQueryList(heading string, paths []string) {
+	sorted := append([]string{}, paths...)
+	sort.Strings(sorted)
+	fmt.Printf("   %s (%d):\n", heading, len(sorted))
+	for _, path := range sorted {
+		fmt.Printf("     - %s\n", path)
+	}
+}
+
+// firstPerDir drops all but the first kustomization file in sorted order of the duplicated
+// directories, so each one is built once and fails with kustomize's own error
+func firstPerDir(files []discovery.KustomizeFile, duplicates []discovery.DuplicateKustomization) []discovery.KustomizeFile {
+	drop := make(map[string]bool)
+	for _, dup := range duplicates {
+		for _, path := range dup.Paths[1:] {
+			drop[path] = true
+		}
+	}
+	return slices.DeleteFunc(files, func(file discovery.KustomizeFile) bool { return drop[file.Path] })
+}
+
+// loadGraphCache loads the dependency graph cached at path, a missing or unusable cache is
+// ignored and the graph is built from scratch
+func loadGraphCache(path string) graph.Graph {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Warning: failed to read graph cache: %v\n", err)
+		}
+		return nil
+	}
+	defer f.Close()
+
+	g, err := graph.Load(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring graph cache: %v\n", err)
+		return nil
+	}
+	slog.Debug("Loaded graph cache", "path", path)
+	return g
+}
+
+// saveGraphCache writes g to path for the next run
+func saveGraphCache(path string, g graph.Graph) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := g.Serialize(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// readKustomizationList reads the directories listed one per line in the file at path,
+// or on stdin when path is "-". Blank lines and # comments are skipped.
+func readKustomizationList(path string) ([]string, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading kustomization list: %w", err)
+	}
+
+	var dirs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			dirs = append(dirs, line)
+		}
+	}
+	return dirs, nil
+}
+
+// writeRenderDiff diffs the rendered output of the successful builds against the base ref
+func writeRenderDiff(ctx context.Context, cfg Config, rep reporter.Reporter, bldr builder.Builder, results []builder.BuildResult, buildAll bool) {
+	if buildAll {
+		fmt.Fprintln(os.Stderr, "Warning: render-diff skipped, there is no base revision to diff against")
+		return
+	}
+
+	diffs, err := differ.New(bldr).Diff(ctx, baseRef(cfg), results, cfg.EnableHelm)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to render diff: %v\n", err)
+		return
+	}
+	if err := rep.WriteDiffSummary(diffs); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write diff summary: %v\n", err)
+	}
+}
+
+// findPreexistingFailures builds the failed kustomizations at the base ref and returns
+// those that failed there too. Kustomizations that didn't exist at the base are regressions.
+func findPreexistingFailures(ctx context.Context, cfg Config, bldr builder.Builder, results []builder.BuildResult, buildAll bool) ([]string, error) {
+	if buildAll {
+		return nil, errors.New("there is no base revision to compare against")
+	}
+
+	topLevel, err := git.TopLevel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	worktree, cleanup, err := git.Worktree(ctx, baseRef(cfg))
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var preexisting []string
+	for _, result := range results {
+		if result.Success {
+			continue
+		}
+		rel, err := git.RepoRelative(topLevel, result.Path)
+		if err != nil {
+			continue
+		}
+		baseDir := filepath.Join(worktree, rel)
+		if _, err := os.Stat(baseDir); err != nil {
+			continue
+		}
+		if base := bldr.Build(ctx, baseDir, cfg.EnableHelm); !base.Success {
+			preexisting = append(preexisting, result.Path)
+		}
+	}
+
+	return preexisting, nil
+}
+
+// baseRef returns the revision to compare builds against, the previous commit without a base-ref
+func baseRef(cfg Config) string {
+	if cfg.BaseRef != "" {
+		return cfg.BaseRef
+	}
+	return "HEAD~1"
+}
+
+// newCoverage computes the coverage of the affected kustomizations. The changed files are
+// hashed relative to the repository root, so the hash doesn't depend on the checkout location.
+// Changes detected with git also record the commits they were diffed between.
+func newCoverage(ctx context.Context, cfg Config, changedFiles, affectedPaths []string, skipped []reporter.Skipped) reporter.Coverage {
+	root := repoRoot(ctx, cfg)
+	relFiles := make([]string, 0, len(changedFiles))
+	for _, file := range changedFiles {
+		if rel, err := git.RepoRelative(root, file); err == nil {
+			file = filepath.ToSlash(rel)
+		}
+		relFiles = append(relFiles, file)
+	}
+	coverage := reporter.NewCoverage(relFiles, affectedPaths, skipped)
+	if len(cfg.ChangedFiles) == 0 {
+		base, baseErr := git.ResolveCommit(ctx, baseRef(cfg))
+		head, headErr := git.ResolveCommit(ctx, "HEAD")
+		if baseErr == nil && headErr == nil {
+			coverage.BaseCommit, coverage.HeadCommit = base, head
+		}
+	}
+	return coverage
+}
+
+// repoRoot returns the directory changed-files entries are relative to: the repo-root input,
+// else the git repository root, else the working directory when there's no git checkout
+func repoRoot(ctx context.Context, cfg Config) string {
+	if cfg.RepoRoot != "" {
+		if abs, err := filepath.Abs(cfg.RepoRoot); err == nil {
+			return abs
+		}
+		return cfg.RepoRoot
+	}
+	if topLevel, err := git.TopLevel(ctx); err == nil {
+		return topLevel
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+	return wd
+}
+
+// maxReasons is the number of changed files named per affected kustomization
+const maxReasons = 3
+
+// describeReasons describes for each affected kustomization which changed files made it
+// affected, e.g. "base/deployment.yaml changed (via base)"
+func describeReasons(affected analyzer.Affected) map[string]string {
+	reasons := make(map[string]string, len(affected))
+	for path, pathReasons := range affected {
+		var parts []string
+		for _, reason := range pathReasons[:min(len(pathReasons), maxReasons)] {
+			parts = append(parts, reason.String())
+		}
+		if more := len(pathReasons) - maxReasons; more > 0 {
+			parts = append(parts, fmt.Sprintf("%d more", more))
+		}
+		reasons[path] = strings.Join(parts, ", ")
+	}
+	return reasons
+}
+
+// because formats a reason from describeReasons to follow an affected path
+func because(reason string) string {
+	if reason == "" {
+		return ""
+	}
+	return " (because " + reason + ")"
+}
+
+// buildDependencies maps each kustomization in order to the ones it must be built after
+func buildDependencies(order []graph.DeployNode) map[string][]string {
+	deps := make(map[string][]string, len(order))
+	for _, node := range order {
+		deps[node.Path] = node.Dependencies
+	}
+	return deps
+}
+
+// openJSONLOutput opens the destination of the JSON Lines stream, "-" is stdout
+func openJSONLOutput(path string) (io.Writer, func(), error) {
+	if path == "-" {
+		return os.Stdout, func() {}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() {
+		if err := f.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to close jsonl-output: %v\n", err)
+		}
+	}, nil
+}
+
+// unreportedDependencies returns the unresolved dependencies that aren't dangling or
+// external references, which are reported on their own
+func unreportedDependencies(unresolved []graph.UnresolvedDependency, dangling []discovery.DanglingReference, external []discovery.ExternalReference) []graph.UnresolvedDependency {
+	// Kustomization directory and the absolute path it references
+	type reference struct{ dir, path string }
+	reported := make(map[reference]bool)
+	for _, ref := range dangling {
+		dir := filepath.Dir(ref.Kustomization)
+		reported[reference{dir, filepath.Join(dir, ref.Reference)}] = true
+	}
+	for _, ref := range external {
+		reported[reference{filepath.Dir(ref.Kustomization), filepath.Clean(ref.Dir)}] = true
+	}
+
+	var unreported []graph.UnresolvedDependency
+	for _, dep := range unresolved {
+		if !reported[reference{dep.Kustomization, filepath.Join(dep.Kustomization, dep.Dependency)}] {
+			unreported = append(unreported, dep)
+		}
+	}
+	return unreported
+}
+
+// unanalyzedChanges returns the changed files that are kustomization files or lie below the
+// directory of a discovered kustomization, sorted
+func unanalyzedChanges(changedFiles []string, kustomizations []discovery.KustomizeFile, names []string) []string {
+	dirs := make(map[string]bool, len(kustomizations))
+	for _, kust := range kustomizations {
+		if abs, err := filepath.Abs(kust.Dir); err == nil {
+			dirs[abs] = true
+		}
+	}
+
+	var unanalyzed []string
+	for _, file := range changedFiles {
+		if kustfile.Match(filepath.Base(file), names...) {
+			unanalyzed = append(unanalyzed, file)
+			continue
+		}
+		if abs, err := filepath.Abs(file); err == nil {
+			if _, ok := analyzer.NearestKustomization(abs, dirs); ok {
+				unanalyzed = append(unanalyzed, file)
+			}
+		}
+	}
+	sort.Strings(unanalyzed)
+	return unanalyzed
+}
+
+// trimPaths trims the whitespace around user-supplied paths, dropping blank ones
+func trimPaths(paths []string) []string {
+	var trimmed []string
+	for _, path := range paths {
+		if path = strings.TrimSpace(path); path != "" {
+			trimmed = append(trimmed, path)
+		}
+	}
+	return trimmed
+}
+
+// filterWithinRoots drops the files outside all root directories with a warning
+func filterWithinRoots(files, rootDirs []string) []string {
+	var roots []string
+	for _, rootDir := range rootDirs {
+		if abs, err := filepath.Abs(rootDir); err == nil {
+			roots = append(roots, abs)
+		}
+	}
+
+	var kept []string
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err == nil && slices.ContainsFunc(roots, func(root string) bool {
+			rel, err := filepath.Rel(root, abs)
+			return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+		}) {
+			kept = append(kept, file)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Warning: ignoring changed file %s outside of root-dir\n", file)
+	}
+	return kept
+}
+
+// writeReports writes the GitHub outputs, step summary and any requested report files.
+// Failures are reported as warnings since they shouldn't change the check result.
+// The GitHub-specific writers are no-ops when GITHUB_OUTPUT/GITHUB_STEP_SUMMARY are unset.
+func writeReports(cfg Config, rep reporter.Reporter, affectedPaths []string, skipped []reporter.Skipped, results []builder.BuildResult) {
+	// Set GitHub Actions outputs
+	if err := rep.SetGitHubOutputs(results); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to set GitHub outputs: %v\n", err)
+	}
+	if err := rep.SetAffectedPathsOutput(affectedPaths); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to set affected-paths output: %v\n", err)
+	}
+
+	// Write GitHub Step Summary
+	if err := rep.WriteGitHubStepSummary(results); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write GitHub step summary: %v\n", err)
+	}
+	if err := rep.ReportSkipped(skipped); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to report skipped kustomizations: %v\n", err)
+	}
+	if err := rep.WriteCoverageSummary(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write coverage summary: %v\n", err)
+	}
+
+	// Write JSON report file
+	if cfg.JSONOutput != "" {
+		if err := rep.WriteJSONReport(results, cfg.JSONOutput); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to write JSON report: %v\n", err)
+		}
+	}
+
+	// Write JUnit XML report file
+	if cfg.JUnitOutput != "" {
+		if err := rep.WriteJUnitReport(results, cfg.JUnitOutput); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to write JUnit report: %v\n", err)
+		}
+	}
+
+	// Post or update the sticky PR comment
+	if cfg.PRComment {
+		if err := rep.PostPullRequestComment(results, cfg.GitHubToken); err != nil {
+			slog.Warn("Failed to post PR comment", "error", err)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package check
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/michielvha/kustomize-build-check/internal/analyzer"
+	"github.com/michielvha/kustomize-build-check/internal/builder"
+	"github.com/michielvha/kustomize-build-check/internal/discovery"
+	"github.com/michielvha/kustomize-build-check/internal/git"
+	"github.com/michielvha/kustomize-build-check/internal/graph"
+	"github.com/michielvha/kustomize-build-check/internal/testutil"
+)
+
+func TestFilterWithinRoots(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	files := []string{
+		"deploy/app/deployment.yaml",
+		"infra/k8s/base/kustomization.yaml",
+		"deploy-legacy/app/deployment.yaml",
+		"README.md",
+	}
+
+	got := filterWithinRoots(files, []string{"deploy", "./infra/k8s/"})
+	want := []string{"deploy/app/deployment.yaml", "infra/k8s/base/kustomization.yaml"}
+	if !slices.Equal(got, want) {
+		t.Errorf("filterWithinRoots() = %v, want %v", got, want)
+	}
+
+	if got := filterWithinRoots(files, []string{"."}); !slices.Equal(got, files) {
+		t.Errorf("expected all files within the working directory, got %v", got)
+	}
+}
+
+func TestUnreportedDependencies(t *testing.T) {
+	unresolved := []graph.UnresolvedDependency{
+		{Kustomization: "/repo/apps/web", Dependency: "../../bsae"},
+		{Kustomization: "/repo/apps/web", Dependency: "../../../shared/base"},
+		{Kustomization: "/repo/apps/web", Dependency: "../../components/excluded"},
+	}
+	dangling := []discovery.DanglingReference{
+		{Kustomization: "/repo/apps/web/kustomization.yaml", Field: "resources", Reference: "../../bsae"},
+	}
+	external := []discovery.ExternalReference{
+		{Kustomization: "/repo/apps/web/kustomization.yaml", Dir: "/shared/base"},
+	}
+
+	got := unreportedDependencies(unresolved, dangling, external)
+	if len(got) != 1 || got[0].Dependency != "../../components/excluded" {
+		t.Errorf("expected only the excluded component to be reported, got %v", got)
+	}
+}
+
+func TestUnanalyzedChanges(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	kustomizations := []discovery.KustomizeFile{{Path: "app/kustomization.yaml", Dir: "app"}}
+	files := []string{
+		"README.md",
+		"app/notes.txt",
+		"app/sub/deployment.yaml",
+		"app/files/x.conf",
+		"apps/notes.txt",
+		"other/kustomization.yml",
+		"other/custom.yaml",
+	}
+
+	// Files nested below a kustomization directory count, a sibling with a common prefix doesn't
+	got := unanalyzedChanges(files, kustomizations, []string{"custom.yaml"})
+	want := []string{"app/files/x.conf", "app/notes.txt", "app/sub/deployment.yaml", "other/custom.yaml", "other/kustomization.yml"}
+	if !slices.Equal(got, want) {
+		t.Errorf("unanalyzedChanges() = %v, want %v", got, want)
+	}
+}
+
+func TestChangedFilesInMonorepo(t *testing.T) {
+	repo := t.TempDir()
+	writeFiles(t, repo, map[string]string{
+		"k8s/base/kustomization.yaml":    "resources:\n  - deployment.yaml\n",
+		"k8s/base/deployment.yaml":       "kind: Deployment\n",
+		"k8s/overlay/kustomization.yaml": "resources:\n  - ../base\n",
+	})
+
+	// Discovery is rooted at k8s/ while the changed paths carry the k8s/ prefix
+	t.Chdir(filepath.Join(repo, "k8s"))
+	cfg := Config{RootDirs: []string{"."}, RepoRoot: repo}
+
+	changed := filterWithinRoots(git.ResolvePaths(repoRoot(t.Context(), cfg), []string{"k8s/base/deployment.yaml", "docs/README.md"}), cfg.RootDirs)
+
+	kustomizations, _, err := discovery.New().FindAllRoots(cfg.RootDirs)
+	if err != nil {
+		t.Fatalf("FindAllRoots failed: %v", err)
+	}
+	g := graph.New()
+	if err := g.Build(kustomizations); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	affected := analyzer.New().GetAffectedKustomizations(changed, g, kustomizations)
+	sort.Strings(affected)
+
+	want := []string{filepath.Join(repo, "k8s", "base"), filepath.Join(repo, "k8s", "overlay")}
+	if !slices.Equal(affected, want) {
+		t.Errorf("expected %v to be affected, got %v", want, affected)
+	}
+}
+
+func TestIncludeExternalBases(t *testing.T) {
+	repo := t.TempDir()
+	writeFiles(t, repo, map[string]string{
+		"shared/base/kustomization.yaml":       "resources:\n  - deployment.yaml\n",
+		"shared/base/deployment.yaml":          "kind: Deployment\n",
+		"deploy/overlay/kustomization.yaml":    "resources:\n  - ../../shared/base\n",
+		"deploy/standalone/kustomization.yaml": "resources: []\n",
+	})
+	t.Chdir(repo)
+
+	cfg := Config{RootDirs: []string{"deploy"}, RepoRoot: repo, MaxDepth: -1, IncludeExternalBases: true}
+	changed := filterWithinRoots(git.ResolvePaths(repo, []string{"shared/base/deployment.yaml"}), []string{repo})
+	kustomizations, _, g, err := discoverGraph(t.Context(), cfg, newConsole(true, false))
+	if err != nil {
+		t.Fatalf("discoverGraph failed: %v", err)
+	}
+
+	affected := analyzer.New(analyzer.WithBuildBases(false)).GetAffectedKustomizations(changed, g, kustomizations)
+	if want := []string{filepath.Join(repo, "deploy", "overlay")}; !slices.Equal(affected, want) {
+		t.Errorf("expected the change to the base above root-dir to affect %v, got %v", want, affected)
+	}
+}
+
+func TestFindPreexistingFailures(t *testing.T) {
+	repo := testutil.InitRepo(t)
+	writeFiles(t, repo, map[string]string{"old-broken/BROKEN": "", "regressed/kustomization.yaml": ""})
+	testutil.GitCmd(t, repo, "add", "-A")
+	testutil.GitCmd(t, repo, "commit", "-q", "-m", "base")
+	writeFiles(t, repo, map[string]string{"regressed/BROKEN": "", "new-broken/BROKEN": ""})
+	testutil.GitCmd(t, repo, "add", "-A")
+	testutil.GitCmd(t, repo, "commit", "-q", "-m", "change")
+	t.Chdir(repo)
+
+	b := testutil.Builder{FailMarker: "BROKEN"}
+	results := b.BuildAll(t.Context(), []string{
+		filepath.Join(repo, "old-broken"),
+		filepath.Join(repo, "regressed"),
+		filepath.Join(repo, "new-broken"),
+	}, false)
+
+	preexisting, err := findPreexistingFailures(t.Context(), Config{}, b, results, false)
+	if err != nil {
+		t.Fatalf("findPreexistingFailures failed: %v", err)
+	}
+
+	if want := []string{filepath.Join(repo, "old-broken")}; !slices.Equal(preexisting, want) {
+		t.Errorf("expected %v to be pre-existing failures, got %v", want, preexisting)
+	}
+
+	if _, err := findPreexistingFailures(t.Context(), Config{}, b, results, true); err == nil {
+		t.Error("expected an error without a base revision")
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		changed []string
+		setup   func(t *testing.T, cfg *Config)
+		wantErr error
+	}{
+		{
+			name:    "no affected kustomizations",
+			changed: []string{"README.md"},
+		},
+		{
+			// Without ignoring them, ancestor matching queues app and fail-on-unanalyzed fails the run
+			name:    "ignored doc changes",
+			changed: []string{"app/README.md", "app/OWNERS"},
+			setup: func(_ *testing.T, cfg *Config) {
+				cfg.AncestorMatch = true
+				cfg.FailOnUnanalyzed = true
+			},
+		},
+		{
+			name:    "kustomize not installed",
+			changed: []string{"app/kustomization.yaml"},
+			setup: func(t *testing.T, _ *Config) {
+				t.Setenv("PATH", t.TempDir())
+			},
+			wantErr: builder.ErrKustomizeNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"app/kustomization.yaml": "resources: []\n"})
+			t.Chdir(dir)
+			t.Setenv("GITHUB_OUTPUT", "")
+			t.Setenv("GITHUB_STEP_SUMMARY", "")
+
+			cfg := DefaultConfig()
+			cfg.Quiet = true
+			cfg.ChangedFiles = tt.changed
+			cfg.RepoRoot = dir
+			if tt.setup != nil {
+				tt.setup(t, &cfg)
+			}
+
+			summary, err := Run(t.Context(), cfg)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected Run to fail with %v, got %v", tt.wantErr, err)
+				}
+				if errors.Is(err, ErrCheckFailed) {
+					t.Error("expected a tool error, not a check failure")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if summary.Total != 0 {
+				t.Errorf("expected no builds, got %+v", summary)
+			}
+		})
+	}
+}
+
+func TestReadKustomizationList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kustomizations.txt")
+	if err := os.WriteFile(path, []byte("# computed by the platform step\napps/web\n\n  apps/api  \n"), 0o644); err != nil {
+		t.Fatalf("failed to write list: %v", err)
+	}
+
+	dirs, err := readKustomizationList(path)
+	if err != nil {
+		t.Fatalf("readKustomizationList failed: %v", err)
+	}
+	if want := []string{"apps/web", "apps/api"}; !slices.Equal(dirs, want) {
+		t.Errorf("readKustomizationList() = %v, want %v", dirs, want)
+	}
+
+	if _, err := readKustomizationList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("expected an error for a missing list file")
+	}
+}
+
+func TestRunQuery(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"base/kustomization.yaml": "resources: []\n",
+		"dev/kustomization.yaml":  "resources:\n- ../base\n",
+	})
+	// Queries need neither git nor kustomize
+	t.Chdir(dir)
+	t.Setenv("PATH", t.TempDir())
+
+	cfg := DefaultConfig()
+	cfg.Quiet = true
+	cfg.Query = "base"
+	if _, err := Run(t.Context(), cfg); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	cfg.Query = "missing"
+	if _, err := Run(t.Context(), cfg); err == nil {
+		t.Error("expected an error for a path that isn't a kustomization")
+	}
+}
+
+func TestRunLint(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"base/kustomization.yaml": "resources:\n- deployment.yaml\n",
+		"base/deployment.yaml":    "kind: Deployment\n",
+	})
+	// Lint needs neither git nor kustomize
+	t.Chdir(dir)
+	t.Setenv("PATH", t.TempDir())
+
+	cfg := DefaultConfig()
+	cfg.Quiet = true
+	cfg.Mode = ModeLint
+	if _, err := Run(t.Context(), cfg); err != nil {
+		t.Fatalf("expected lint to pass, got %v", err)
+	}
+
+	writeFiles(t, dir, map[string]string{
+		"dev/kustomization.yaml":    "resources:\n- ../missing\n",
+		"broken/kustomization.yaml": "resources: [\n",
+	})
+	_, err := Run(t.Context(), cfg)
+	if !errors.Is(err, ErrCheckFailed) {
+		t.Fatalf("expected lint to fail the check, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "1 kustomization file(s) failed to parse, 1 dangling reference(s)") {
+		t.Errorf("expected both problems to be reported, got %v", err)
+	}
+}
+
+// writeFiles creates each file (relative to root) with its content, including parent directories
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create dir for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
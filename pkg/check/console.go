@@ -0,0 +1,88 @@
+package check
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/michielvha/kustomize-build-check/internal/builder"
+	"github.com/michielvha/kustomize-build-check/internal/reporter"
+)
+
+// console prints progress output, which is suppressed entirely in quiet mode.
+// Warnings, errors and the final result line are always printed directly.
+type console struct {
+	quiet   bool
+	plain   bool
+	symbols reporter.Symbols
+}
+
+func newConsole(quiet, plain bool) console {
+	return console{quiet: quiet, plain: plain, symbols: reporter.ConsoleSymbols(plain)}
+}
+
+// section prints a progress banner, using icon unless plain text output is requested
+func (c console) section(icon, title string) {
+	if c.plain {
+		icon = "==>"
+	}
+	c.printf("%s %s\n", icon, title)
+}
+
+// println prints a progress line
+func (c console) println(a ...any) {
+	if c.quiet {
+		return
+	}
+	fmt.Println(a...)
+}
+
+// printf prints formatted progress output
+func (c console) printf(format string, a ...any) {
+	if c.quiet {
+		return
+	}
+	fmt.Printf(format, a...)
+}
+
+// buildProgress prints a line as each build starts, and in concurrent mode
+// as each finishes with the running tally. Finished results are streamed to results if set.
+type buildProgress struct {
+	out        console
+	concurrent bool
+	passed     int
+	failed     int
+
+	results     *reporter.JSONLWriter
+	resultsFail bool
+}
+
+func (p *buildProgress) Started(started, total int, path string) {
+	p.out.printf("   [%d/%d] building %s...\n", started, total, path)
+}
+
+func (p *buildProgress) Finished(finished, total int, result builder.BuildResult) {
+	// Builds skipped at the deadline or by fail-fast are reported with the other skipped kustomizations
+	if result.Skipped {
+		return
+	}
+	if p.results != nil && !p.resultsFail {
+		if err := p.results.Write(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to stream result to jsonl-output: %v\n", err)
+			p.resultsFail = true
+		}
+	}
+	if result.Success {
+		p.passed++
+	} else {
+		p.failed++
+	}
+	if !p.concurrent {
+		return
+	}
+
+	symbol := p.out.symbols.Pass
+	if !result.Success {
+		symbol = p.out.symbols.Fail
+	}
+	p.out.printf("   [%d/%d] %s %s (%d passed, %d failed)\n", finished, total, symbol, result.Path, p.passed, p.failed)
+}